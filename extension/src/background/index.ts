@@ -198,6 +198,10 @@ async function handleError(tabId: number, error: unknown): Promise<void> {
         title = 'No app configured';
         message = `No application is set to open ${error.fileType} files`;
         break;
+      case 'content_mismatch':
+        title = 'Download was not a document';
+        message = `The downloaded file is not a valid ${error.fileType} file. You may need to sign in again.`;
+        break;
       default:
         message = error.message;
     }
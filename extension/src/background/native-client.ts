@@ -61,7 +61,7 @@ function sendNativeMessage(request: NativeRequest): Promise<NativeResponse> {
           if (errorMessage.includes('not found')) {
             reject(
               new NativeMessagingError(
-                'Native host not found. Please run the installer.',
+                'Native host not found. Please run the installer, or run "reclaim-openwith doctor" to see what is wrong.',
                 'host_not_found'
               )
             );
@@ -24,13 +24,29 @@ export interface GetDefaultsRequest {
   action: 'getDefaults';
 }
 
+export interface HelloRequest {
+  action: 'hello';
+  protocolVersion: number;
+}
+
 export interface OpenRequest {
   action: 'open';
   filePath: string;
   fileType: FileType;
 }
 
-export type NativeRequest = GetDefaultsRequest | OpenRequest;
+// Saves generated content (base64) in the host's own directory instead of
+// Downloads. Requests over 1 MB must be sent over a port as a stream.
+export interface WriteFileRequest {
+  action: 'writeFile';
+  title: string;
+  fileType: FileType;
+  data: string;
+  open?: boolean;
+  appId?: string;
+}
+
+export type NativeRequest = HelloRequest | GetDefaultsRequest | OpenRequest | WriteFileRequest;
 
 // Native messaging response types
 export interface GetDefaultsResponse {
@@ -38,13 +54,66 @@ export interface GetDefaultsResponse {
   defaults: DefaultApps;
 }
 
+export interface ContentWarning {
+  code:
+    | 'macros'
+    | 'activex'
+    | 'ole_object'
+    | 'external_relationship'
+    | 'dde'
+    | 'javascript'
+    | 'launch'
+    | 'open_action'
+    | 'embedded_file'
+    | 'rich_media'
+    | 'xfa'
+    | 'incomplete';
+  part?: string;
+  message: string;
+}
+
+export interface HostInfo {
+  protocolVersion: number;
+  minProtocolVersion: number;
+  version: string;
+  commit: string;
+  os: string;
+  actions: string[];
+  fileTypes: string[];
+}
+
+export interface HelloResponse {
+  success: true;
+  host: HostInfo;
+}
+
 export interface OpenResponse {
   success: true;
+  warnings?: ContentWarning[];
+  // Where writeFile saved the file
+  filePath?: string;
 }
 
 export type NativeErrorCode =
   | 'no_default_app'
+  | 'unsupported_type'
+  | 'app_not_found'
+  | 'open_failed'
+  | 'set_default_failed'
   | 'file_not_found'
+  | 'content_mismatch'
+  | 'active_content_blocked'
+  | 'incompatible_version'
+  | 'canceled'
+  | 'busy'
+  | 'duplicate_id'
+  | 'not_found'
+  | 'invalid_request'
+  | 'stream_failed'
+  | 'write_failed'
+  | 'internal'
+  | 'forbidden'
+  | 'rate_limited'
   | 'permission_denied'
   | 'download_failed'
   | 'unknown';
@@ -53,18 +122,51 @@ export interface ErrorResponse {
   success: false;
   error: NativeErrorCode;
   fileType?: FileType;
+  filePath?: string;
   message?: string;
+  // Payload field that failed validation, for invalid_request
+  field?: string;
+  // The host's actions, for unknown
+  actions?: string[];
+  warnings?: ContentWarning[];
+  host?: HostInfo;
+}
+
+// Interim frame sent over a connectNative port before a request's result.
+// Only requests that carry an id receive these.
+export interface ProgressFrame {
+  id: string;
+  type: 'progress';
+  success: true;
+  progress: { stage: string };
 }
 
-export type NativeResponse = GetDefaultsResponse | OpenResponse | ErrorResponse;
+// Responses over 1 MB arrive over a port as a stream: a streamBegin frame,
+// streamChunk frames with base64 data in seq order, then a streamEnd frame
+// with the SHA-256 (hex) of the reassembled JSON. Every frame carries the
+// response's id. Requests over 1 MB are sent the same way, as actions with
+// these fields in their payload.
+export type StreamFrame =
+  | { id?: string; type: 'streamBegin'; success: true; stream: { streamId: string; size: number; chunks: number } }
+  | { id?: string; type: 'streamChunk'; success: true; stream: { streamId: string; seq: number; data: string } }
+  | { id?: string; type: 'streamEnd'; success: true; stream: { streamId: string; sha256: string } };
+
+export type NativeResponse = HelloResponse | GetDefaultsResponse | OpenResponse | ErrorResponse;
 
 // Type guard for successful responses
 export function isSuccessResponse(
   response: NativeResponse
-): response is GetDefaultsResponse | OpenResponse {
+): response is HelloResponse | GetDefaultsResponse | OpenResponse {
   return response.success === true;
 }
 
+// Type guard for HelloResponse
+export function isHelloResponse(
+  response: NativeResponse
+): response is HelloResponse {
+  return response.success === true && 'host' in response;
+}
+
 // Type guard for GetDefaultsResponse
 export function isGetDefaultsResponse(
   response: NativeResponse
@@ -76,7 +178,7 @@ export function isGetDefaultsResponse(
 export function isOpenResponse(
   response: NativeResponse
 ): response is OpenResponse {
-  return response.success === true && !('defaults' in response);
+  return response.success === true && !('defaults' in response) && !('host' in response);
 }
 
 // Type guard for ErrorResponse
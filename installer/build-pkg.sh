@@ -8,6 +8,9 @@ SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
 PROJECT_ROOT="$(dirname "$SCRIPT_DIR")"
 
 VERSION="${VERSION:-1.0.0}"
+# The store extension's ID, compiled in so the host accepts it as a caller
+EXTENSION_ID="${EXTENSION_ID:-}"
+FIREFOX_EXTENSION_ID="${FIREFOX_EXTENSION_ID:-}"
 IDENTIFIER="com.reclaim.openwith"
 OUTPUT_DIR="$SCRIPT_DIR/dist"
 NATIVE_HOST_DIR="$PROJECT_ROOT/native-host"
@@ -52,12 +55,15 @@ mkdir -p "$OUTPUT_DIR/scripts"
 echo "Building native host binary..."
 cd "$NATIVE_HOST_DIR"
 
+COMMIT="$(git rev-parse --short HEAD 2>/dev/null || echo unknown)"
+LDFLAGS="-s -w -X github.com/reclaim/openwith/internal/version.Version=${VERSION} -X github.com/reclaim/openwith/internal/version.Commit=${COMMIT} -X github.com/reclaim/openwith/internal/version.ExtensionID=${EXTENSION_ID} -X github.com/reclaim/openwith/internal/version.FirefoxExtensionID=${FIREFOX_EXTENSION_ID}"
+
 if [ "$BUILD_UNIVERSAL" = true ]; then
     echo "Building universal binary (amd64 + arm64)..."
 
     # Build for both architectures
-    CGO_ENABLED=0 GOOS=darwin GOARCH=amd64 go build -ldflags="-s -w" -o "bin/${BINARY_NAME}-amd64" ./cmd/reclaim-openwith
-    CGO_ENABLED=0 GOOS=darwin GOARCH=arm64 go build -ldflags="-s -w" -o "bin/${BINARY_NAME}-arm64" ./cmd/reclaim-openwith
+    CGO_ENABLED=0 GOOS=darwin GOARCH=amd64 go build -ldflags="$LDFLAGS" -o "bin/${BINARY_NAME}-amd64" ./cmd/reclaim-openwith
+    CGO_ENABLED=0 GOOS=darwin GOARCH=arm64 go build -ldflags="$LDFLAGS" -o "bin/${BINARY_NAME}-arm64" ./cmd/reclaim-openwith
 
     # Create universal binary with lipo
     lipo -create -output "bin/${BINARY_NAME}" "bin/${BINARY_NAME}-amd64" "bin/${BINARY_NAME}-arm64"
@@ -68,7 +74,7 @@ if [ "$BUILD_UNIVERSAL" = true ]; then
     echo "Created universal binary"
 else
     # Build for current architecture only
-    make build
+    make build VERSION="$VERSION" COMMIT="$COMMIT" EXTENSION_ID="$EXTENSION_ID" FIREFOX_EXTENSION_ID="$FIREFOX_EXTENSION_ID"
 fi
 
 cd "$SCRIPT_DIR"
@@ -3,9 +3,9 @@ set -e
 
 # Reclaim: Open With - Uninstaller
 # Removes the native host binary and all manifests
+# The binary finds and removes its own manifests; see `reclaim-openwith uninstall -h`
 
 BINARY_PATH="/usr/local/bin/reclaim-openwith"
-MANIFEST_NAME="com.reclaim.openwith.json"
 IDENTIFIER="com.reclaim.openwith"
 
 echo "Uninstalling Reclaim: Open With..."
@@ -16,14 +16,6 @@ if [ "$EUID" -ne 0 ]; then
     exit 1
 fi
 
-# Remove binary
-if [ -f "$BINARY_PATH" ]; then
-    rm -f "$BINARY_PATH"
-    echo "Removed binary: $BINARY_PATH"
-else
-    echo "Binary not found (already removed?): $BINARY_PATH"
-fi
-
 # Get all user home directories
 get_user_homes() {
     dscl . -list /Users UniqueID | while read user uid; do
@@ -36,35 +28,21 @@ get_user_homes() {
     done
 }
 
-# Remove manifests from all browser directories
-remove_manifests() {
-    local user_home="$1"
-
-    local browsers=(
-        "$user_home/Library/Application Support/Google/Chrome/NativeMessagingHosts"
-        "$user_home/Library/Application Support/Google/Chrome Beta/NativeMessagingHosts"
-        "$user_home/Library/Application Support/Google/Chrome Canary/NativeMessagingHosts"
-        "$user_home/Library/Application Support/BraveSoftware/Brave-Browser/NativeMessagingHosts"
-        "$user_home/Library/Application Support/Microsoft Edge/NativeMessagingHosts"
-        "$user_home/Library/Application Support/Chromium/NativeMessagingHosts"
-        "$user_home/Library/Application Support/Vivaldi/NativeMessagingHosts"
-        "$user_home/Library/Application Support/Arc/User Data/NativeMessagingHosts"
-    )
-
-    for browser_dir in "${browsers[@]}"; do
-        local manifest_path="$browser_dir/$MANIFEST_NAME"
-        if [ -f "$manifest_path" ]; then
-            rm -f "$manifest_path"
-            echo "Removed manifest: $manifest_path"
-        fi
+# Remove manifests from all users, before the binary that knows where they are
+if [ -x "$BINARY_PATH" ]; then
+    for user_home in $(get_user_homes); do
+        echo "Cleaning up for user: $user_home"
+        HOME="$user_home" "$BINARY_PATH" uninstall --path "$BINARY_PATH" || true
     done
-}
+else
+    echo "Binary not found, so manifests can't be cleaned up: $BINARY_PATH"
+fi
 
-# Remove from all users
-for user_home in $(get_user_homes); do
-    echo "Cleaning up for user: $user_home"
-    remove_manifests "$user_home"
-done
+# Remove binary
+if [ -f "$BINARY_PATH" ]; then
+    rm -f "$BINARY_PATH"
+    echo "Removed binary: $BINARY_PATH"
+fi
 
 # Forget the package receipt (so macOS doesn't think it's still installed)
 if pkgutil --pkg-info "$IDENTIFIER" >/dev/null 2>&1; then
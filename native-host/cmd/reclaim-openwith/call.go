@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/reclaim/openwith/internal/manifest"
+	"github.com/reclaim/openwith/internal/messaging"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/nativehost"
+	"github.com/reclaim/openwith/nativehost/client"
+)
+
+// runCall starts a host the way Chrome does, sends it one request and
+// prints the response. It exits 1 if the host reports an error.
+func runCall(args []string) int {
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	host := fs.String("host", "", "host binary to run (default: this one)")
+	origin := fs.String("origin", "", "caller origin to pass to the host (default: the store extension, or the first extension the host is installed for)")
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for the response")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reclaim-openwith call [flags] <action> [payload JSON]")
+		fmt.Fprintln(fs.Output(), `Example: reclaim-openwith call listApps '{"fileType":"xlsx"}'`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	action := fs.Arg(0)
+	var payload interface{}
+	if fs.NArg() == 2 {
+		raw := json.RawMessage(fs.Arg(1))
+		if !json.Valid(raw) {
+			fmt.Fprintln(os.Stderr, "The payload is not valid JSON")
+			return 2
+		}
+		payload = raw
+	}
+
+	path := *host
+	if path == "" {
+		self, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't find this binary: %v\n", err)
+			return 1
+		}
+		path = self
+	}
+	if *origin == "" {
+		*origin = defaultOrigin(path)
+	}
+
+	cmd := client.Command(path, *origin)
+	cmd.Stderr = os.Stderr
+	c, err := client.Start(cmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer c.Close()
+	c.ProtocolVersion = messaging.ProtocolVersion
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	resp, err := c.Call(ctx, action, payload, func(p nativehost.Progress) {
+		fmt.Fprintf(os.Stderr, "%s...\n", p.Stage)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", action, err)
+		return 1
+	}
+
+	out, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	if resp.Error == "forbidden" {
+		fmt.Fprintf(os.Stderr, "The host doesn't allow %s to use %s; pass -origin with an origin policy.json allows\n", *origin, action)
+	}
+	if !resp.Success {
+		return 1
+	}
+	return 0
+}
+
+// defaultOrigin calls as the store extension when this build knows its ID.
+// Development builds call as the first extension the host at hostPath is
+// installed for, which install allows in policy.json, or failing that as
+// a placeholder that policy.json must allow.
+func defaultOrigin(hostPath string) string {
+	if origin := policy.StoreOrigin(); origin != "" {
+		return origin
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if origins := manifest.InstalledOrigins(runtime.GOOS, home, hostPath); len(origins) > 0 {
+			return origins[0]
+		}
+	}
+	return client.DefaultOrigin
+}
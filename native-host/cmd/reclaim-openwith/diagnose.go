@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/reclaim/openwith/internal/diagnose"
+	"github.com/reclaim/openwith/internal/doctor"
+	"github.com/reclaim/openwith/internal/files"
+	"github.com/reclaim/openwith/internal/filetypes"
+	"github.com/reclaim/openwith/internal/manifest"
+	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/internal/socket"
+	"github.com/reclaim/openwith/internal/version"
+)
+
+// runDiagnose writes a zip with everything needed to look into a bug
+// report, with document titles removed from the log
+func runDiagnose(args []string) int {
+	fs := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	out := fs.String("bundle", "", "zip file to write")
+	lines := fs.Int("lines", 500, "how many of the most recent log lines to include")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reclaim-openwith diagnose --bundle <out.zip> [--lines N]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *out == "" || fs.NArg() > 0 || *lines < 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var b diagnose.Bundle
+	b.Add("version.txt", []byte(fmt.Sprintf("reclaim-openwith %s (%s)\n%s/%s, %s\n",
+		version.Version, version.BuildCommit(), runtime.GOOS, runtime.GOARCH, runtime.Version())))
+
+	if env, err := doctorEnv(nil); err != nil {
+		b.Add("doctor.txt", []byte(err.Error()+"\n"))
+	} else {
+		addJSON(&b, "doctor.json", doctor.Run(env))
+	}
+
+	b.Add("log.txt", recentLog(*lines))
+	addJSON(&b, "config.json", effectiveConfig())
+	addJSON(&b, "defaults.json", defaultApps(platform.New()))
+	addManifests(&b)
+
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := b.WriteZip(f); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", *out, err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", *out, err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s with %s\n", *out, strings.Join(b.Names(), ", "))
+	fmt.Println("Document titles are removed from the log; file paths and app names remain.")
+	return 0
+}
+
+// recentLog returns the end of the host's log with titles redacted
+func recentLog(n int) []byte {
+	path := filepath.Join(logDirectory(), "reclaim-openwith.log")
+	lines, err := diagnose.Tail(path, n)
+	if err != nil {
+		return []byte(fmt.Sprintf("Can't read the log: %v\n", err))
+	}
+	var sb strings.Builder
+	for _, line := range lines {
+		sb.WriteString(diagnose.RedactTitles(line))
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String())
+}
+
+// config is the settings the host runs with and where they come from
+type config struct {
+	StoreOrigins     []string                    `json:"storeOrigins,omitempty"`
+	LogDir           string                      `json:"logDir"`
+	FilesDir         string                      `json:"filesDir,omitempty"`
+	Socket           string                      `json:"socket,omitempty"`
+	PolicyPath       string                      `json:"policyPath,omitempty"`
+	Policy           policy.Policy               `json:"policy"`
+	PolicyError      string                      `json:"policyError,omitempty"`
+	PreferencesPath  string                      `json:"preferencesPath,omitempty"`
+	Preferences      map[string]prefs.Preference `json:"preferences,omitempty"`
+	PreferencesError string                      `json:"preferencesError,omitempty"`
+}
+
+// effectiveConfig gathers the settings the host would run with now. A
+// file that can't be loaded is reported, along with the defaults used
+// in its place.
+func effectiveConfig() config {
+	c := config{StoreOrigins: policy.StoreOrigins(), LogDir: logDirectory(), Policy: policy.Default()}
+	if dir, err := files.DefaultDir(); err == nil {
+		c.FilesDir = dir
+	}
+	if path, err := socket.DefaultPath(); err == nil {
+		c.Socket = path
+	}
+
+	if path, err := policy.DefaultPath(); err != nil {
+		c.PolicyError = err.Error()
+	} else if pol, err := policy.Load(path); err != nil {
+		c.PolicyPath, c.PolicyError = path, err.Error()
+	} else {
+		c.PolicyPath, c.Policy = path, pol
+	}
+
+	if path, err := prefs.DefaultPath(); err != nil {
+		c.PreferencesError = err.Error()
+	} else if store, err := prefs.Open(path); err != nil {
+		c.PreferencesPath, c.PreferencesError = path, err.Error()
+	} else {
+		c.PreferencesPath, c.Preferences = path, store.All()
+	}
+	return c
+}
+
+// addJSON adds v to b as name, or the reason it couldn't be encoded in
+// its place, as addManifests does for manifests it can't read
+func addJSON(b *diagnose.Bundle, name string, v interface{}) {
+	if err := b.AddJSON(name, v); err != nil {
+		b.Add(strings.TrimSuffix(name, ".json")+".txt", []byte(err.Error()+"\n"))
+	}
+}
+
+// defaultApp is one row of the default-app table
+type defaultApp struct {
+	Name     string `json:"name,omitempty"`
+	BundleID string `json:"bundleId,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// defaultApps looks up the system default app for every file type the
+// host accepts, keeping the lookup errors getDefaults leaves out
+func defaultApps(plat platform.Platform) map[string]defaultApp {
+	apps := make(map[string]defaultApp)
+	for _, ext := range filetypes.Extensions() {
+		app, err := plat.GetDefaultApp(ext)
+		row := defaultApp{Name: app.Name, BundleID: app.BundleID, Path: app.Path}
+		if err != nil {
+			row.Error = err.Error()
+		}
+		apps[ext] = row
+	}
+	return apps
+}
+
+// addManifests adds the manifest of every browser that has one, as it is
+// on disk
+func addManifests(b *diagnose.Bundle) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	for _, f := range manifest.Find(runtime.GOOS, home) {
+		name := "manifests/" + f.Browser.ID
+		if f.System {
+			name += "-system"
+		}
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			b.Add(name+".txt", []byte(fmt.Sprintf("%s: %v\n", f.Path, err)))
+			continue
+		}
+		b.Add(name+".json", data)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/doctor"
+	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/version"
+)
+
+// runDoctor checks the installation and prints what's wrong and how to fix
+// it. It exits 1 if any check fails.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	var ids listFlag
+	fs.Var(&ids, "extension-id", "ID of a Chrome extension or Firefox add-on the manifests must allow; may be repeated (default: the store extensions)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reclaim-openwith doctor [--json] [--extension-id <id>]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	env, err := doctorEnv(ids)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	report := doctor.Run(env)
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printReport(report)
+	}
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// doctorEnv describes this installation for the checks. The manifests
+// must allow the extensions with the given IDs, or the store extensions.
+func doctorEnv(ids []string) (doctor.Env, error) {
+	self, err := selfPath("")
+	if err != nil {
+		return doctor.Env{}, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return doctor.Env{}, fmt.Errorf("can't find your home directory: %w", err)
+	}
+
+	var origins []string
+	for _, id := range ids {
+		origin, err := caller.Origin(id)
+		if err != nil {
+			return doctor.Env{}, err
+		}
+		origins = append(origins, origin)
+	}
+	if len(origins) == 0 {
+		origins = policy.StoreOrigins()
+	}
+
+	// Without a config directory there's no policy file to check
+	policyPath, _ := policy.DefaultPath()
+
+	return doctor.Env{
+		GOOS:       runtime.GOOS,
+		Home:       home,
+		Self:       self,
+		Version:    version.Version,
+		Origins:    origins,
+		PolicyPath: policyPath,
+		LogDir:     logDirectory(),
+		Tools:      platform.Tools,
+	}, nil
+}
+
+func printReport(report doctor.Report) {
+	fmt.Printf("reclaim-openwith %s (%s)\n\n", report.Version, version.BuildCommit())
+	failed, warned := 0, 0
+	for _, c := range report.Checks {
+		fmt.Printf("%-4s  %s", strings.ToUpper(string(c.Status)), c.Name)
+		if c.Detail != "" {
+			fmt.Printf(": %s", c.Detail)
+		}
+		fmt.Println()
+		if c.Fix != "" {
+			fmt.Printf("      Fix: %s\n", c.Fix)
+		}
+		switch c.Status {
+		case doctor.Fail:
+			failed++
+		case doctor.Warn:
+			warned++
+		}
+	}
+
+	fmt.Println()
+	switch {
+	case failed > 0:
+		fmt.Printf("%d of %d checks failed\n", failed, len(report.Checks))
+	case warned > 0:
+		fmt.Printf("Nothing failed, but %d of %d checks have warnings\n", warned, len(report.Checks))
+	default:
+		fmt.Println("Everything looks fine")
+	}
+}
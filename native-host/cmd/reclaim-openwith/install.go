@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	openwith "github.com/reclaim/openwith"
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/manifest"
+	"github.com/reclaim/openwith/internal/policy"
+)
+
+// listFlag collects a flag given several times or as a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// runInstall writes the host manifest for each browser, pointing at this
+// binary, and reports every file it wrote
+func runInstall(args []string) int {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	var ids, browsers listFlag
+	fs.Var(&ids, "extension-id", "ID of a Chrome extension or Firefox add-on allowed to start the host; may be repeated (default: the store extensions)")
+	fs.Var(&browsers, "browser", "browser to install for; may be repeated (default: every installed browser): "+strings.Join(manifest.BrowserIDs(runtime.GOOS), ", "))
+	system := fs.Bool("system", false, "install for every user (needs root)")
+	hostPath := fs.String("path", "", "host binary the manifest points at (default: this one)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reclaim-openwith install --extension-id <id> [--browser <browser>] [--system]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	origins := policy.StoreOrigins()
+	if len(ids) > 0 {
+		origins = nil
+	}
+	for _, id := range ids {
+		origin, err := caller.Origin(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v; copy it from chrome://extensions or about:debugging\n", err)
+			return 2
+		}
+		origins = append(origins, origin)
+	}
+	if len(origins) == 0 {
+		fmt.Fprintln(os.Stderr, "This build doesn't know the store extension's ID; pass --extension-id")
+		return 2
+	}
+
+	path, err := selfPath(*hostPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	home, err := os.UserHomeDir()
+	if err != nil && !*system {
+		fmt.Fprintf(os.Stderr, "Can't find your home directory: %v\n", err)
+		return 1
+	}
+
+	m, err := manifest.Render(openwith.ManifestTemplate, path, origins)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	written, err := manifest.Install(m, manifest.Options{
+		GOOS:     runtime.GOOS,
+		Home:     home,
+		System:   *system,
+		Browsers: browsers,
+	})
+	for _, w := range written {
+		fmt.Printf("Installed for %s: %s\n", w.Browser.Name, w.Path)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, os.ErrPermission) && *system {
+			fmt.Fprintln(os.Stderr, "System-wide installs need root; try again with sudo")
+		}
+		return 1
+	}
+
+	// A system-wide install runs as root, whose policy isn't the users'
+	if *system {
+		return 0
+	}
+	if err := allowCallers(origins); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't update the policy: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// allowCallers adds the origins the policy doesn't know yet to its
+// callers, with the default actions, and reports each one it added
+func allowCallers(origins []string) error {
+	path, err := policy.DefaultPath()
+	if err != nil {
+		return err
+	}
+	pol, err := policy.Load(path)
+	if err != nil {
+		return err
+	}
+
+	var added []string
+	for _, origin := range origins {
+		if pol.Allow(origin) {
+			added = append(added, origin)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if err := pol.Save(path); err != nil {
+		return err
+	}
+	for _, origin := range added {
+		fmt.Printf("Allowed %s in %s\n", origin, path)
+	}
+	return nil
+}
+
+// selfPath returns path made absolute, or this binary's path with
+// symlinks resolved if path is empty
+func selfPath(path string) (string, error) {
+	if path != "" {
+		return filepath.Abs(path)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("can't find this binary: %w", err)
+	}
+	return filepath.EvalSymlinks(self)
+}
@@ -1,30 +1,95 @@
 package main
 
 import (
-	"io"
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/files"
 	"github.com/reclaim/openwith/internal/handlers"
 	"github.com/reclaim/openwith/internal/messaging"
 	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/internal/version"
+	"github.com/reclaim/openwith/nativehost"
 )
 
+// commands are the subcommands; with no subcommand, or with the caller
+// origin a browser passes, the binary runs as the native messaging host
+var commands = map[string]func(args []string) int{
+	"call":      runCall,
+	"diagnose":  runDiagnose,
+	"doctor":    runDoctor,
+	"install":   runInstall,
+	"serve":     runServe,
+	"uninstall": runUninstall,
+	"version":   runVersion,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+	runHost(os.Args[1:])
+}
+
+// runVersion prints the host's version and commit. doctor runs it to check
+// the binary a manifest points at.
+func runVersion(args []string) int {
+	fmt.Printf("reclaim-openwith %s (%s)\n", version.Version, version.BuildCommit())
+	return 0
+}
+
+// runHost serves the browser over stdin and stdout until it disconnects.
+// args are the arguments the browser launched the host with.
+func runHost(args []string) {
+	router, pol, closeLog := setupHost()
+	defer closeLog()
+
+	// The browser names the extension that started us; the policy decides
+	// what it may do, and an unknown caller is refused every request
+	ctx := context.Background()
+	c, err := caller.Parse(args)
+	if err != nil {
+		log.Printf("Unidentified caller, refusing all requests: %v", err)
+	} else {
+		if !pol.Known(c.Origin) {
+			log.Printf("Unknown caller %s, refusing all requests", c.Origin)
+		} else {
+			log.Printf("Caller: %s", c.Origin)
+		}
+		ctx = nativehost.WithOrigin(ctx, c.Origin)
+	}
+
+	// Bad messages are answered and skipped; Serve only returns when
+	// stdin can't be read any further
+	if err := router.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Printf("Error reading from the browser, exiting: %v", err)
+	}
+}
+
+// setupHost starts logging and loads everything the actions need. It
+// returns the router, the policy it enforces and a func that closes the
+// log.
+func setupHost() (*nativehost.Router, policy.Policy, func()) {
 	// Set up logging to a file in the user's cache directory
 	// We can't use stderr as it may interfere with native messaging
 	// Use user-specific directory and restricted permissions (owner read/write only)
-	cacheDir, err := os.UserCacheDir()
-	if err != nil {
-		cacheDir = os.TempDir()
-	}
-	logDir := filepath.Join(cacheDir, "reclaim-openwith")
+	logDir := logDirectory()
 	_ = os.MkdirAll(logDir, 0700) // Create with restricted permissions
 	logPath := filepath.Join(logDir, "reclaim-openwith.log")
+	closeLog := func() {}
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 	if err == nil {
-		defer logFile.Close()
+		closeLog = func() { logFile.Close() }
 		log.SetOutput(logFile)
 	}
 
@@ -33,37 +98,148 @@ func main() {
 	// Initialize platform-specific implementation
 	plat := platform.New()
 
-	for {
-		msg, err := messaging.ReadMessage(os.Stdin)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			break
-		}
+	// Load per-file-type app preferences; without them we use system defaults
+	store := loadPreferences()
 
-		response := handleMessage(msg, plat)
-		if err := messaging.WriteMessage(os.Stdout, response); err != nil {
-			log.Printf("Error writing response: %v", err)
-			break
-		}
+	// Load the security policy; a broken file falls back to the defaults
+	pol := loadPolicy()
+
+	// Generated documents are written here by writeFile
+	filesDir := filesDirectory()
+
+	return newRouter(plat, store, pol, filesDir, logDir), pol, closeLog
+}
+
+// logDirectory returns where the host keeps its log and crash reports
+func logDirectory() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "reclaim-openwith")
+}
+
+// loadPreferences opens the preferences store, starting empty if the
+// saved file can't be read
+func loadPreferences() *prefs.Store {
+	path, err := prefs.DefaultPath()
+	if err != nil {
+		log.Printf("Preferences disabled: %v", err)
+		return nil
+	}
+	store, err := prefs.Open(path)
+	if err != nil {
+		log.Printf("Error loading preferences, starting empty: %v", err)
+		return prefs.New(path)
+	}
+	return store
+}
+
+// loadPolicy reads the security policy, using the defaults if the saved
+// file can't be read
+func loadPolicy() policy.Policy {
+	path, err := policy.DefaultPath()
+	if err != nil {
+		log.Printf("Using default policy: %v", err)
+		return policy.Default()
+	}
+	pol, err := policy.Load(path)
+	if err != nil {
+		log.Printf("Error loading policy, using defaults: %v", err)
+		return policy.Default()
 	}
+	return pol
+}
+
+// filesDirectory returns where writeFile saves documents, or "" if there
+// is nowhere to put them
+func filesDirectory() string {
+	dir, err := files.DefaultDir()
+	if err != nil {
+		log.Printf("writeFile disabled: %v", err)
+		return ""
+	}
+	return dir
+}
+
+const (
+	// slowRequest is how long a request can take before it's logged as slow
+	slowRequest = 2 * time.Second
+	// requestsPerSecond and requestBurst limit how fast a caller can send
+	// requests; the extension sends a handful per document
+	requestsPerSecond = 10
+	requestBurst      = 30
+)
+
+// newRouter registers every action the host supports behind the
+// middleware they all run through. Crash reports go to crashDir.
+func newRouter(plat platform.Platform, store *prefs.Store, pol policy.Policy, filesDir, crashDir string) *nativehost.Router {
+	r := nativehost.NewRouter()
+	r.Use(
+		nativehost.Logging(),
+		nativehost.Timing(slowRequest),
+		nativehost.Recover(crashDir, fmt.Sprintf("%s (%s)", version.Version, version.BuildCommit())),
+		nativehost.RateLimit(requestsPerSecond, requestBurst),
+		nativehost.Authorize(pol.Allows),
+		checkVersion,
+	)
+
+	r.Handle("getDefaults", nativehost.Typed(func(ctx context.Context, req messaging.EmptyRequest) nativehost.Response {
+		return handlers.HandleGetDefaults(plat, store)
+	}))
+	r.Handle("open", nativehost.Typed(func(ctx context.Context, req messaging.OpenRequest) nativehost.Response {
+		return handlers.HandleOpen(ctx, req, plat, store, pol)
+	}))
+	r.Handle("openWith", nativehost.Typed(func(ctx context.Context, req messaging.OpenWithRequest) nativehost.Response {
+		return handlers.HandleOpenWith(ctx, req, plat, pol)
+	}))
+	r.Handle("listApps", nativehost.Typed(func(ctx context.Context, req messaging.ListAppsRequest) nativehost.Response {
+		return handlers.HandleListApps(req, plat)
+	}))
+	r.Handle("setSystemDefault", nativehost.Typed(func(ctx context.Context, req messaging.SetSystemDefaultRequest) nativehost.Response {
+		return handlers.HandleSetSystemDefault(req, plat)
+	}))
+	r.Handle("setPreferredApp", nativehost.Typed(func(ctx context.Context, req messaging.SetPreferredAppRequest) nativehost.Response {
+		return handlers.HandleSetPreferredApp(req, plat, store)
+	}))
+	r.Handle("clearPreferredApp", nativehost.Typed(func(ctx context.Context, req messaging.ClearPreferredAppRequest) nativehost.Response {
+		return handlers.HandleClearPreferredApp(req, store)
+	}))
+	r.Handle("writeFile", nativehost.Typed(func(ctx context.Context, req messaging.WriteFileRequest) nativehost.Response {
+		return handlers.HandleWriteFile(ctx, req, filesDir, plat, store, pol)
+	}))
+	r.Handle("ping", nativehost.Typed(func(ctx context.Context, req messaging.EmptyRequest) nativehost.Response {
+		return nativehost.Response{Success: true, Message: "pong"}
+	}))
+
+	// hello's payload isn't decoded, so newer extensions can send fields
+	// this host doesn't know yet
+	r.Handle("hello", func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		return handlers.HandleHello(msg, hostActions(r))
+	})
+
+	return r
+}
+
+// hostActions lists the router's actions along with cancel and the stream
+// frames, which the server answers without reaching the router
+func hostActions(r *nativehost.Router) []string {
+	names := append(r.Actions(), nativehost.ActionCancel,
+		nativehost.ActionStreamBegin, nativehost.ActionStreamChunk, nativehost.ActionStreamEnd)
+	sort.Strings(names)
+	return names
 }
 
-func handleMessage(msg *messaging.Message, plat platform.Platform) messaging.Response {
-	switch msg.Action {
-	case "getDefaults":
-		return handlers.HandleGetDefaults(plat)
-	case "open":
-		return handlers.HandleOpen(msg, plat)
-	case "ping":
-		return messaging.Response{Success: true, Message: "pong"}
-	default:
-		return messaging.Response{
-			Success: false,
-			Error:   "unknown",
-			Message: "Unknown action: " + msg.Action,
+// checkVersion refuses messages sent with a protocol version the host
+// doesn't speak. hello reports the mismatch itself, along with the host
+// info.
+func checkVersion(next nativehost.Handler) nativehost.Handler {
+	return func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		if msg.Action != "hello" {
+			if resp := handlers.CheckProtocolVersion(msg); resp != nil {
+				return *resp
+			}
 		}
+		return next(ctx, msg)
 	}
 }
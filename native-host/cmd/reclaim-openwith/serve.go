@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/socket"
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// runServe serves local clients, such as editor extensions and scripts,
+// over a Unix socket until it's interrupted. They send the same framed
+// messages a browser does and go through the same router.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	useSocket := fs.Bool("socket", false, "serve on a Unix socket")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reclaim-openwith serve --socket [path]")
+		if path, err := socket.DefaultPath(); err == nil {
+			fmt.Fprintf(fs.Output(), "The socket defaults to %s\n", path)
+		}
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !*useSocket || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		var err error
+		if path, err = socket.DefaultPath(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	l, err := socket.Listen(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	router, _, closeLog := setupHost()
+	defer closeLog()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Serving on %s", path)
+	fmt.Fprintf(os.Stderr, "Serving on %s\n", path)
+	err = socket.Serve(ctx, l, func(ctx context.Context, conn net.Conn) {
+		ctx = nativehost.WithOrigin(ctx, caller.SocketOrigin)
+		if err := router.Serve(ctx, conn, conn); err != nil && ctx.Err() == nil {
+			log.Printf("Error reading from socket client: %v", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Socket server stopped: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/reclaim/openwith/internal/files"
+	"github.com/reclaim/openwith/internal/manifest"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/internal/socket"
+)
+
+// runUninstall removes the manifests that point at this binary from every
+// browser directory, and with --purge everything the host has saved
+func runUninstall(args []string) int {
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	purge := fs.Bool("purge", false, "also remove the host's cache, log and config directories")
+	hostPath := fs.String("path", "", "host binary whose manifests to remove (default: this one)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: reclaim-openwith uninstall [--dry-run] [--purge]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	path, err := selfPath(*hostPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't find your home directory: %v\n", err)
+		return 1
+	}
+
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+
+	status := 0
+	removed, kept, err := manifest.Uninstall(runtime.GOOS, home, path, *dryRun)
+	for _, f := range removed {
+		fmt.Printf("%s %s manifest: %s\n", verb, f.Browser.Name, f.Path)
+	}
+	for _, f := range kept {
+		switch {
+		case f.Err != nil:
+			fmt.Printf("Kept %s: %v\n", f.Path, f.Err)
+		case f.PointsAt(path):
+			// Removing it failed; err says why
+		default:
+			fmt.Printf("Kept %s: it's for %s\n", f.Path, f.Manifest.Path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		status = 1
+	}
+	if len(removed) == 0 && err == nil {
+		fmt.Println("No manifests for this binary were found")
+	}
+
+	if !*purge {
+		return status
+	}
+	for _, dir := range hostDirs() {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if !*dryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", dir, err)
+				status = 1
+				continue
+			}
+		}
+		fmt.Printf("%s %s\n", verb, dir)
+	}
+	return status
+}
+
+// hostDirs lists the directories the host saves things in: its log, crash
+// reports and generated files, its preferences and policy, and its socket
+func hostDirs() []string {
+	dirs := []string{logDirectory()}
+	if path, err := files.DefaultDir(); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	if path, err := prefs.DefaultPath(); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	if path, err := policy.DefaultPath(); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	if path, err := socket.DefaultPath(); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+
+	var unique []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
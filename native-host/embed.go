@@ -0,0 +1,11 @@
+// Package openwith holds files from the root of the native host module
+// that the binary embeds.
+package openwith
+
+import _ "embed"
+
+// ManifestTemplate is manifest.json, the native messaging host manifest.
+// Its path and allowed origins are placeholders that install fills in.
+//
+//go:embed manifest.json
+var ManifestTemplate []byte
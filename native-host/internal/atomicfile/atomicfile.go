@@ -0,0 +1,45 @@
+// Package atomicfile writes files so that readers never see them half
+// written: the data goes to a temporary file in the same directory, is
+// flushed to disk, and only then takes the final name.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces path with data, creating it with perm if it's
+// missing. path's directory must exist.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return Place(filepath.Dir(path), "."+filepath.Base(path), data, perm, func(tmp string) error {
+		return os.Rename(tmp, path)
+	})
+}
+
+// Place writes data with perm to a temporary file in dir, named after
+// prefix, and calls place to give it its final name. The temporary name
+// is removed afterwards, so place may rename it or link it elsewhere.
+func Place(dir, prefix string, data []byte, perm os.FileMode, place func(tmp string) error) error {
+	tmp, err := os.CreateTemp(dir, prefix+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return place(tmp.Name())
+}
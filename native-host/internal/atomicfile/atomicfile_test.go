@@ -0,0 +1,63 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	if err := WriteFile(path, []byte("one"), 0600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	if err := WriteFile(path, []byte("two"), 0644); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "two" {
+		t.Errorf("File contains %q, want %q", data, "two")
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected file mode 0644, got %o", info.Mode().Perm())
+	}
+
+	// No temp files left behind
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the written file, found %d entries", len(entries))
+	}
+
+	if err := WriteFile(filepath.Join(dir, "missing", "config.json"), nil, 0600); err == nil {
+		t.Error("WriteFile() expected error for a missing directory, got nil")
+	}
+}
+
+func TestPlace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "linked")
+
+	err := Place(dir, ".write", []byte("data"), 0600, func(tmp string) error {
+		return os.Link(tmp, path)
+	})
+	if err != nil {
+		t.Fatalf("Place() error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Errorf("Linked file contains %q", data)
+	}
+
+	// A failed placement leaves nothing behind
+	failed := errors.New("taken")
+	err = Place(dir, ".write", []byte("data"), 0600, func(tmp string) error { return failed })
+	if !errors.Is(err, failed) {
+		t.Errorf("Place() error = %v, want %v", err, failed)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the linked file, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,127 @@
+// Package caller identifies the browser extension that launched the host
+// from the arguments the browser passes on the command line.
+package caller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Browser names the browser family a caller runs in
+type Browser string
+
+const (
+	// Chrome is Chrome and the browsers built on Chromium
+	Chrome Browser = "chrome"
+	// Firefox is Firefox and its derivatives
+	Firefox Browser = "firefox"
+)
+
+// SocketOrigin is the origin of clients connecting over the host's Unix
+// socket rather than from a browser. They all run as the host's user.
+const SocketOrigin = "unix-socket:"
+
+const (
+	// chromeScheme starts the origin Chrome passes as the first argument
+	chromeScheme = "chrome-extension://"
+	// firefoxScheme starts the origin the host gives Firefox callers.
+	// Firefox has no origin to pass; its moz-extension:// URLs differ per
+	// install, so the stable add-on ID stands in.
+	firefoxScheme = "firefox-extension://"
+)
+
+// Caller is the extension that launched the host
+type Caller struct {
+	Browser     Browser
+	ExtensionID string
+	Origin      string // e.g. "chrome-extension://<id>/", the key for policy rules
+}
+
+// ChromeOrigin returns the origin of the Chrome extension with the given ID
+func ChromeOrigin(id string) string {
+	return chromeScheme + id + "/"
+}
+
+// FirefoxOrigin returns the origin the host uses for the Firefox add-on
+// with the given ID
+func FirefoxOrigin(id string) string {
+	return firefoxScheme + id + "/"
+}
+
+// Origin returns the origin of the extension with the given ID, which may
+// be a Chrome extension ID or a Firefox add-on ID
+func Origin(id string) (string, error) {
+	switch {
+	case IsChromeID(id):
+		return ChromeOrigin(id), nil
+	case IsFirefoxID(id):
+		return FirefoxOrigin(id), nil
+	}
+	return "", fmt.Errorf("%q isn't a Chrome extension ID or a Firefox add-on ID", id)
+}
+
+// Parse identifies the caller from the host's arguments, without the
+// program name. Chrome passes the extension's origin first; on Windows it
+// adds a --parent-window argument, which is ignored. Firefox passes the
+// path of the host manifest and then the add-on's ID.
+func Parse(args []string) (Caller, error) {
+	if len(args) == 0 {
+		return Caller{}, fmt.Errorf("no caller origin argument; the host must be launched by a browser")
+	}
+
+	if strings.HasPrefix(args[0], chromeScheme) {
+		return FromOrigin(args[0])
+	}
+	if len(args) >= 2 && strings.HasSuffix(args[0], ".json") {
+		if !IsFirefoxID(args[1]) {
+			return Caller{}, fmt.Errorf("invalid Firefox add-on ID %q", args[1])
+		}
+		return Caller{Browser: Firefox, ExtensionID: args[1], Origin: FirefoxOrigin(args[1])}, nil
+	}
+
+	return Caller{}, fmt.Errorf("unrecognized caller argument %q", args[0])
+}
+
+// FromOrigin identifies the caller with the given origin, as returned by
+// ChromeOrigin or FirefoxOrigin
+func FromOrigin(origin string) (Caller, error) {
+	if id, ok := strings.CutPrefix(origin, chromeScheme); ok {
+		id = strings.TrimSuffix(id, "/")
+		if !IsChromeID(id) {
+			return Caller{}, fmt.Errorf("invalid Chrome extension origin %q", origin)
+		}
+		return Caller{Browser: Chrome, ExtensionID: id, Origin: ChromeOrigin(id)}, nil
+	}
+	if id, ok := strings.CutPrefix(origin, firefoxScheme); ok {
+		id = strings.TrimSuffix(id, "/")
+		if !IsFirefoxID(id) {
+			return Caller{}, fmt.Errorf("invalid Firefox add-on origin %q", origin)
+		}
+		return Caller{Browser: Firefox, ExtensionID: id, Origin: FirefoxOrigin(id)}, nil
+	}
+	return Caller{}, fmt.Errorf("unrecognized origin %q", origin)
+}
+
+// IsChromeID reports whether id looks like a Chrome extension ID: 32
+// letters from a to p
+func IsChromeID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if c < 'a' || c > 'p' {
+			return false
+		}
+	}
+	return true
+}
+
+// firefoxIDPattern matches the two forms of add-on ID Firefox accepts: an
+// email-like name or a braced GUID
+var firefoxIDPattern = regexp.MustCompile(`^([A-Za-z0-9._+-]*@[A-Za-z0-9._-]+|\{[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\})$`)
+
+// IsFirefoxID reports whether id looks like a Firefox add-on ID
+func IsFirefoxID(id string) bool {
+	return len(id) <= 80 && firefoxIDPattern.MatchString(id)
+}
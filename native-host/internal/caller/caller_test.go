@@ -0,0 +1,99 @@
+package caller
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	const id = "abcdefghijklmnopabcdefghijklmnop"
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    Caller
+		wantErr bool
+	}{
+		{
+			name: "chrome",
+			args: []string{"chrome-extension://" + id + "/"},
+			want: Caller{Browser: Chrome, ExtensionID: id, Origin: "chrome-extension://" + id + "/"},
+		},
+		{
+			name: "chrome on windows",
+			args: []string{"chrome-extension://" + id + "/", "--parent-window=6752"},
+			want: Caller{Browser: Chrome, ExtensionID: id, Origin: "chrome-extension://" + id + "/"},
+		},
+		{
+			name: "no trailing slash",
+			args: []string{"chrome-extension://" + id},
+			want: Caller{Browser: Chrome, ExtensionID: id, Origin: "chrome-extension://" + id + "/"},
+		},
+		{
+			name: "firefox",
+			args: []string{"/home/a/.mozilla/native-messaging-hosts/com.reclaim.openwith.json", "openwith@reclaim.app"},
+			want: Caller{Browser: Firefox, ExtensionID: "openwith@reclaim.app", Origin: "firefox-extension://openwith@reclaim.app/"},
+		},
+		{
+			name: "firefox guid",
+			args: []string{`C:\Program Files\Reclaim\com.reclaim.openwith.json`, "{0ad88674-2b41-4cfb-99e3-e206c74a0076}"},
+			want: Caller{Browser: Firefox, ExtensionID: "{0ad88674-2b41-4cfb-99e3-e206c74a0076}", Origin: "firefox-extension://{0ad88674-2b41-4cfb-99e3-e206c74a0076}/"},
+		},
+		{name: "firefox bad id", args: []string{"/m/com.reclaim.openwith.json", "not an id"}, wantErr: true},
+		{name: "firefox without id", args: []string{"/m/com.reclaim.openwith.json"}, wantErr: true},
+		{name: "no arguments", wantErr: true},
+		{name: "bad id", args: []string{"chrome-extension://not-an-id/"}, wantErr: true},
+		{name: "uppercase id", args: []string{"chrome-extension://ABCDEFGHIJKLMNOPABCDEFGHIJKLMNOP/"}, wantErr: true},
+		{name: "web origin", args: []string{"https://example.com/"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse() expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromOrigin(t *testing.T) {
+	for _, origin := range []string{
+		"chrome-extension://abcdefghijklmnopabcdefghijklmnop/",
+		"firefox-extension://openwith@reclaim.app/",
+	} {
+		c, err := FromOrigin(origin)
+		if err != nil || c.Origin != origin {
+			t.Errorf("FromOrigin(%q) = %+v, %v", origin, c, err)
+		}
+	}
+	for _, origin := range []string{"chrome-extension://EXTENSION_ID_PLACEHOLDER/", "firefox-extension://nope/", "moz-extension://x/"} {
+		if c, err := FromOrigin(origin); err == nil {
+			t.Errorf("FromOrigin(%q) = %+v, expected an error", origin, c)
+		}
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	tests := map[string]string{
+		"abcdefghijklmnopabcdefghijklmnop": "chrome-extension://abcdefghijklmnopabcdefghijklmnop/",
+		"openwith@reclaim.app":             "firefox-extension://openwith@reclaim.app/",
+		"@reclaim":                         "firefox-extension://@reclaim/",
+	}
+	for id, want := range tests {
+		if got, err := Origin(id); err != nil || got != want {
+			t.Errorf("Origin(%q) = %q, %v; want %q", id, got, err, want)
+		}
+	}
+	for _, id := range []string{"", "ABC", "a/b@c", "{not-a-guid}"} {
+		if got, err := Origin(id); err == nil {
+			t.Errorf("Origin(%q) = %q, expected an error", id, got)
+		}
+	}
+}
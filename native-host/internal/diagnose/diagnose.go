@@ -0,0 +1,138 @@
+// Package diagnose builds the diagnostic bundle a user attaches to a bug
+// report: a zip of the host's version, health checks, recent log lines
+// and settings, with document titles taken out of the log.
+package diagnose
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+)
+
+// Bundle collects the files of a diagnostic bundle, in the order added
+type Bundle struct {
+	files []file
+}
+
+type file struct {
+	name string
+	data []byte
+}
+
+// Add adds a file
+func (b *Bundle) Add(name string, data []byte) {
+	b.files = append(b.files, file{name: name, data: data})
+}
+
+// AddJSON adds a file holding v as indented JSON
+func (b *Bundle) AddJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.Add(name, append(data, '\n'))
+	return nil
+}
+
+// Names lists the files added so far
+func (b *Bundle) Names() []string {
+	var names []string
+	for _, f := range b.files {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// WriteZip writes the bundle to w as a zip archive
+func (b *Bundle) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	for _, f := range b.files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// tailChunk is how much of the log Tail reads at a time, from the end
+const tailChunk = 64 * 1024
+
+// Tail returns the last n lines of the file at path without reading all
+// of it
+func Tail(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read chunks backwards until there are more than n line breaks, so
+	// the first line kept is whole
+	var data []byte
+	offset := info.Size()
+	for offset > 0 && bytes.Count(data, []byte("\n")) <= n {
+		size := int64(tailChunk)
+		if size > offset {
+			size = offset
+		}
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		data = append(chunk, data...)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if offset > 0 {
+		// The first line may have been cut off
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	return lines, nil
+}
+
+// titlePattern matches the name of a file the host opened or wrote, from
+// the prefix the extension gives downloads to the first extension the host
+// accepts, with the " (2)" Write adds on a collision. A name without one
+// ends at the next ": " or the end of the line, so the error that usually
+// follows it stays readable.
+var titlePattern = regexp.MustCompile(`open-with-[^/\\\n]*?(?:(?: \(\d+\))?(\.(?:` +
+	strings.Join(quoteAll(filetypes.Extensions()), "|") + `))\b|(: |$))`)
+
+// quoteAll escapes each string for use in a regular expression
+func quoteAll(ss []string) []string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = regexp.QuoteMeta(s)
+	}
+	return quoted
+}
+
+// RedactTitles replaces the document titles in a log line, keeping the
+// files' extensions
+func RedactTitles(line string) string {
+	return titlePattern.ReplaceAllString(line, "open-with-[title]$1$2")
+}
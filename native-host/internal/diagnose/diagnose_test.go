@@ -0,0 +1,109 @@
+package diagnose
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.log")
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d %s", i, strings.Repeat("x", 40)))
+	}
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+
+	// More than one chunk back
+	got, err := Tail(path, 2000)
+	if err != nil {
+		t.Fatalf("Tail() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, lines[3000:]) {
+		t.Errorf("Tail(2000) returned %d lines, starting %q", len(got), got[0])
+	}
+
+	// More than the file has
+	got, _ = Tail(path, 10000)
+	if len(got) != len(lines) {
+		t.Errorf("Tail(10000) returned %d lines, want %d", len(got), len(lines))
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.log")
+	os.WriteFile(empty, nil, 0600)
+	if got, err := Tail(empty, 10); err != nil || len(got) != 0 {
+		t.Errorf("Tail(empty) = %q, %v", got, err)
+	}
+
+	if _, err := Tail(filepath.Join(t.TempDir(), "missing.log"), 10); err == nil {
+		t.Error("Expected an error for a missing log")
+	}
+}
+
+func TestRedactTitles(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			"Wrote 120 bytes to /home/a/.cache/reclaim-openwith/files/open-with-Q4 Budget (2).xlsx",
+			"Wrote 120 bytes to /home/a/.cache/reclaim-openwith/files/open-with-[title].xlsx",
+		},
+		{
+			// The error after the name survives
+			"Active content in /Users/a/Downloads/open-with-Board v1.2.docx: macro in word/vbaProject.bin",
+			"Active content in /Users/a/Downloads/open-with-[title].docx: macro in word/vbaProject.bin",
+		},
+		{
+			`Content check failed for C:\Users\a\open-with-Notes.pdf: bad header`,
+			`Content check failed for C:\Users\a\open-with-[title].pdf: bad header`,
+		},
+		{
+			// A name without an accepted extension ends at the error
+			"Refused /tmp/open-with-Salaries 2026.exe: unsupported type",
+			"Refused /tmp/open-with-[title]: unsupported type",
+		},
+		{"Opening /tmp/open-with-minutes", "Opening /tmp/open-with-[title]"},
+		{"open (id 3): ok", "open (id 3): ok"},
+	}
+	for _, tt := range tests {
+		if got := RedactTitles(tt.line); got != tt.want {
+			t.Errorf("RedactTitles(%q)\n got %q\nwant %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestBundle_WriteZip(t *testing.T) {
+	var b Bundle
+	b.Add("version.txt", []byte("1.0.0\n"))
+	if err := b.AddJSON("config.json", map[string]string{"a": "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.WriteZip(&buf); err != nil {
+		t.Fatalf("WriteZip() error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Not a zip: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+	want := map[string]string{"version.txt": "1.0.0\n", "config.json": "{\n  \"a\": \"b\"\n}\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Zip holds %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,448 @@
+// Package doctor checks that the host is installed so browsers can start
+// it: that each browser's manifest is there, points at this version of the
+// host and names the right extensions, that the policy lets those
+// extensions in, and that the host has what it needs at run time.
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/manifest"
+	"github.com/reclaim/openwith/internal/policy"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	// Pass means the check found nothing wrong
+	Pass Status = "pass"
+	// Warn means something is missing that the user may not need, such
+	// as the manifest for a browser they don't use the extension in
+	Warn Status = "warn"
+	// Fail means the host may not work until the problem is fixed
+	Fail Status = "fail"
+)
+
+// Check is one line of the report
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"` // A command that fixes a failure or warning
+}
+
+// Report is the result of every check
+type Report struct {
+	Version string  `json:"version"`
+	OK      bool    `json:"ok"`
+	Checks  []Check `json:"checks"`
+}
+
+// versionTimeout is how long a manifest's binary has to report its version
+const versionTimeout = 5 * time.Second
+
+// Env is what the checks look at. Tests fill it in with fakes.
+type Env struct {
+	GOOS    string
+	Home    string
+	Self    string // This binary; fix-up commands run it
+	Version string // This binary's version
+
+	// Origins are the extensions manifests must allow: Chrome extension
+	// origins in allowed_origins and Firefox add-ons, by their
+	// caller.FirefoxOrigin, in allowed_extensions. When empty, any valid
+	// extension will do.
+	Origins []string
+
+	PolicyPath string // The host's policy file; "" skips the policy check
+	LogDir     string
+	Tools      []string // Commands the platform needs
+
+	// LookPath finds a tool; exec.LookPath if nil
+	LookPath func(file string) (string, error)
+	// HostVersion returns the version of the host binary at path; if nil,
+	// the binary's version subcommand is run
+	HostVersion func(path string) (string, error)
+}
+
+// Run runs every check
+func Run(env Env) Report {
+	if env.LookPath == nil {
+		env.LookPath = exec.LookPath
+	}
+	if env.HostVersion == nil {
+		env.HostVersion = hostVersion
+	}
+
+	var checks []Check
+	checks = append(checks, checkManifests(env)...)
+	if env.PolicyPath != "" {
+		checks = append(checks, checkPolicy(env))
+	}
+	checks = append(checks, checkLogDir(env.LogDir))
+	checks = append(checks, checkTools(env))
+
+	report := Report{Version: env.Version, OK: true, Checks: checks}
+	for _, c := range checks {
+		if c.Status == Fail {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+// checkManifests checks every manifest that exists, and warns about
+// browsers that have a profile but no manifest, per user or system-wide
+func checkManifests(env Env) []Check {
+	found := manifest.Find(env.GOOS, env.Home)
+	var checks []Check
+	for _, f := range found {
+		checks = append(checks, checkManifest(env, f))
+	}
+
+	for _, b := range manifest.Browsers {
+		dir := b.Dir(env.GOOS, env.Home, false)
+		if dir == "" || covered(env, found, b) || !b.Installed(env.GOOS, env.Home) {
+			continue
+		}
+		checks = append(checks, Check{
+			Name:   b.Name + " manifest",
+			Status: Warn,
+			Detail: "not installed in " + dir + "; the extension can't use the host from " + b.Name,
+			Fix:    installCommand(env, b, false, nil),
+		})
+	}
+
+	if len(found) == 0 {
+		checks = append(checks, Check{
+			Name:   "Manifests",
+			Status: Fail,
+			Detail: "no supported browser has the host manifest",
+			Fix:    installCommand(env, manifest.Browser{}, false, nil),
+		})
+	}
+	return checks
+}
+
+// covered reports whether one of the manifests found is where b looks,
+// per user or system-wide. Browsers can share a system directory, and
+// Find reports a shared manifest for only one of them.
+func covered(env Env, found []manifest.Found, b manifest.Browser) bool {
+	for _, f := range found {
+		for _, system := range []bool{false, true} {
+			if dir := b.Dir(env.GOOS, env.Home, system); dir != "" && f.Path == filepath.Join(dir, manifest.FileName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkManifest checks one manifest, stopping at the first problem
+func checkManifest(env Env, f manifest.Found) Check {
+	name := f.Browser.Name + " manifest"
+	if f.System {
+		name = f.Browser.Name + " system manifest"
+	}
+	fail := func(format string, args ...interface{}) Check {
+		return Check{
+			Name:   name,
+			Status: Fail,
+			Detail: f.Path + ": " + fmt.Sprintf(format, args...),
+			Fix:    installCommand(env, f.Browser, f.System, f.Manifest.Origins()),
+		}
+	}
+
+	if f.Err != nil {
+		return fail("%v", f.Err)
+	}
+	m := f.Manifest
+	if m.Name != manifest.HostName {
+		return fail("name is %q, want %q", m.Name, manifest.HostName)
+	}
+	if m.Type != "stdio" {
+		return fail("type is %q, want \"stdio\"", m.Type)
+	}
+
+	if !filepath.IsAbs(m.Path) {
+		return fail("path %q isn't absolute", m.Path)
+	}
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return fail("path %s doesn't exist", m.Path)
+	}
+	if !info.Mode().IsRegular() || (env.GOOS != "windows" && info.Mode().Perm()&0111 == 0) {
+		return fail("path %s isn't an executable", m.Path)
+	}
+	if !f.PointsAt(env.Self) {
+		v, err := env.HostVersion(m.Path)
+		if err != nil {
+			return fail("can't tell the version of %s: %v", m.Path, err)
+		}
+		if v != env.Version {
+			return fail("path %s is version %s, this is %s", m.Path, v, env.Version)
+		}
+	}
+
+	// Firefox lists add-on IDs where Chrome lists origins
+	list, allowed := "allowed_origins", m.AllowedOrigins
+	if f.Browser.Firefox {
+		list, allowed = "allowed_extensions", m.AllowedExtensions
+	}
+	if len(allowed) == 0 {
+		return fail("%s is empty", list)
+	}
+	for _, entry := range allowed {
+		if !validEntry(f.Browser, entry) {
+			return fail("%s has %q, which isn't an extension %s", list, entry, entryKind(f.Browser))
+		}
+	}
+	for _, want := range expected(env, f.Browser) {
+		if contains(m.Origins(), want.Origin) {
+			continue
+		}
+		if f.Browser.Firefox {
+			return fail("%s doesn't include %s", list, want.ExtensionID)
+		}
+		return fail("%s doesn't include %s", list, want.Origin)
+	}
+
+	return Check{Name: name, Status: Pass, Detail: f.Path}
+}
+
+// checkPolicy checks that the policy file can be read and lets the
+// extensions the manifests name open files. install adds them to the
+// policy's callers; the host refuses any extension without an entry.
+func checkPolicy(env Env) Check {
+	origins := append([]string(nil), env.Origins...)
+	for _, f := range manifest.Find(env.GOOS, env.Home) {
+		for _, origin := range f.Manifest.Origins() {
+			if f.PointsAt(env.Self) && !contains(origins, origin) {
+				origins = append(origins, origin)
+			}
+		}
+	}
+	// install writes the entries for exactly these extensions
+	allow := installCommand(Env{Self: env.Self}, manifest.Browser{}, false, origins)
+
+	check := Check{Name: "Policy", Detail: env.PolicyPath}
+	pol, err := policy.Load(env.PolicyPath)
+	if err != nil {
+		check.Status = Fail
+		check.Detail = fmt.Sprintf("%v; the host is using the default policy", err)
+		check.Fix = fmt.Sprintf("mv %s %s && %s", quote(env.PolicyPath), quote(env.PolicyPath+".bak"), allow)
+		return check
+	}
+
+	// install only adds entries, so one that lists actions without open
+	// has to be edited by hand
+	var refused, unknown []string
+	var edits []string
+	for _, origin := range origins {
+		if pol.Allows(origin, "open") {
+			continue
+		}
+		refused = append(refused, origin)
+		entry, ok := pol.Entry(origin)
+		if !ok {
+			unknown = append(unknown, origin)
+			continue
+		}
+		fixed := entry
+		fixed.Actions = append(append([]string(nil), entry.Actions...), "open")
+		edits = append(edits, fmt.Sprintf("in %s, replace %s with %s", env.PolicyPath, entryJSON(entry), entryJSON(fixed)))
+	}
+	if len(refused) > 0 {
+		check.Status = Fail
+		check.Detail = fmt.Sprintf("%s doesn't let %s open files", env.PolicyPath, strings.Join(refused, ", "))
+		if len(unknown) > 0 {
+			edits = append([]string{installCommand(Env{Self: env.Self}, manifest.Browser{}, false, unknown)}, edits...)
+		}
+		check.Fix = strings.Join(edits, "; ")
+		return check
+	}
+	check.Status = Pass
+	return check
+}
+
+// entryJSON formats a callers entry as it appears in the policy file
+func entryJSON(c policy.Caller) string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// checkLogDir checks that the host can write its log
+func checkLogDir(dir string) Check {
+	check := Check{Name: "Log directory", Detail: dir}
+	err := os.MkdirAll(dir, 0700)
+	if err == nil {
+		var tmp *os.File
+		tmp, err = os.CreateTemp(dir, ".doctor-*")
+		if err == nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		check.Status = Fail
+		check.Detail = fmt.Sprintf("%s isn't writable: %v", dir, err)
+		check.Fix = fmt.Sprintf("mkdir -p %s && chmod 700 %s", quote(dir), quote(dir))
+		return check
+	}
+	check.Status = Pass
+	return check
+}
+
+// checkTools checks that the commands the platform runs can be found
+func checkTools(env Env) Check {
+	check := Check{Name: "Platform tools", Status: Pass}
+	if len(env.Tools) == 0 {
+		check.Detail = "none needed"
+		return check
+	}
+
+	// A tool that's only missing from PATH is usually in a system directory
+	// the browser's environment left out; one that isn't there has to be
+	// installed
+	var problems []string
+	var offPath bool
+	for _, tool := range env.Tools {
+		if _, err := env.LookPath(tool); err == nil {
+			continue
+		}
+		if dir := systemDir(env, tool); dir != "" {
+			problems = append(problems, fmt.Sprintf("%s is in %s but not on PATH", tool, dir))
+			offPath = true
+		} else {
+			problems = append(problems, fmt.Sprintf("%s isn't installed", tool))
+		}
+	}
+	if len(problems) > 0 {
+		check.Status = Fail
+		check.Detail = strings.Join(problems, "; ")
+		if offPath {
+			check.Fix = "export PATH=/usr/bin:/bin:$PATH"
+		}
+		return check
+	}
+	check.Detail = strings.Join(env.Tools, ", ")
+	return check
+}
+
+// systemDir returns the system directory holding tool, or "" if it's in
+// neither /usr/bin nor /bin
+func systemDir(env Env, tool string) string {
+	for _, dir := range []string{"/usr/bin", "/bin"} {
+		if _, err := env.LookPath(filepath.Join(dir, tool)); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// validEntry reports whether entry belongs in b's allowed list
+func validEntry(b manifest.Browser, entry string) bool {
+	if b.Firefox {
+		return caller.IsFirefoxID(entry)
+	}
+	c, err := caller.FromOrigin(entry)
+	return err == nil && c.Browser == caller.Chrome
+}
+
+func entryKind(b manifest.Browser) string {
+	if b.Firefox {
+		return "ID"
+	}
+	return "origin"
+}
+
+// expected returns the callers in env.Origins that b's manifest must
+// allow, leaving out those of the other browser family
+func expected(env Env, b manifest.Browser) []caller.Caller {
+	var callers []caller.Caller
+	for _, origin := range env.Origins {
+		c, err := caller.FromOrigin(origin)
+		if err == nil && (c.Browser == caller.Firefox) == b.Firefox {
+			callers = append(callers, c)
+		}
+	}
+	return callers
+}
+
+// installCommand returns the command that installs this binary's manifest
+// for a browser, or every browser if b is the zero Browser. It allows the
+// extensions in env.Origins, or failing those the origins given.
+func installCommand(env Env, b manifest.Browser, system bool, origins []string) string {
+	if len(env.Origins) > 0 {
+		origins = env.Origins
+	}
+
+	var args []string
+	if system {
+		args = append(args, "sudo")
+	}
+	args = append(args, quote(env.Self), "install")
+	ids := 0
+	for _, origin := range origins {
+		c, err := caller.FromOrigin(origin)
+		if err != nil || (b.ID != "" && (c.Browser == caller.Firefox) != b.Firefox) {
+			continue
+		}
+		args = append(args, "--extension-id", quote(c.ExtensionID))
+		ids++
+	}
+	if ids == 0 {
+		args = append(args, "--extension-id", "<extension-id>")
+	}
+	if b.ID != "" {
+		args = append(args, "--browser", b.ID)
+	}
+	if system {
+		args = append(args, "--system")
+	}
+	return strings.Join(args, " ")
+}
+
+// hostVersion runs the binary's version subcommand. An older host without
+// one starts serving instead, and exits at once on the empty input.
+func hostVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return "", err
+	}
+	// "reclaim-openwith 1.2.3 (commit)"
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 || fields[0] != "reclaim-openwith" {
+		return "", errors.New("it doesn't report a version")
+	}
+	return fields[1], nil
+}
+
+// quote quotes s for a POSIX shell if it needs it
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`*?[]{}()<>|&;~#!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,356 @@
+package doctor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reclaim/openwith/internal/manifest"
+	"github.com/reclaim/openwith/internal/policy"
+)
+
+const (
+	storeOrigin = "chrome-extension://abcdefghijklmnopabcdefghijklmnop/"
+	devOrigin   = "chrome-extension://ponmlkjihgfedcbaponmlkjihgfedcba/"
+)
+
+// testEnv returns an environment with a fake home, this binary at self,
+// and another copy of the host at other
+func testEnv(t *testing.T) (env Env, other string) {
+	t.Helper()
+	dir := t.TempDir()
+	self := filepath.Join(dir, "reclaim-openwith")
+	other = filepath.Join(dir, "old-reclaim-openwith")
+	os.WriteFile(self, nil, 0755)
+	os.WriteFile(other, nil, 0755)
+
+	env = Env{
+		GOOS:       "linux",
+		Home:       t.TempDir(),
+		Self:       self,
+		Version:    "1.2.0",
+		Origins:    []string{storeOrigin},
+		PolicyPath: filepath.Join(t.TempDir(), "policy.json"),
+		LogDir:     filepath.Join(t.TempDir(), "logs"),
+		Tools:      []string{"osascript"},
+		LookPath: func(file string) (string, error) {
+			return "/usr/bin/" + file, nil
+		},
+		HostVersion: func(path string) (string, error) {
+			if path == other {
+				return "1.1.0", nil
+			}
+			return "", errors.New("not a host")
+		},
+	}
+	return env, other
+}
+
+func install(t *testing.T, env Env, browser, path string, origins ...string) string {
+	t.Helper()
+	m := manifest.Manifest{Name: manifest.HostName, Type: "stdio", Path: path, AllowedOrigins: origins}
+	written, err := manifest.Install(m, manifest.Options{GOOS: env.GOOS, Home: env.Home, Browsers: []string{browser}})
+	if err != nil {
+		t.Fatalf("Install() error: %v", err)
+	}
+	allowPolicy(t, env, origins...)
+	return written[0].Path
+}
+
+// allowPolicy adds callers entries for origins to the policy, as install
+// does
+func allowPolicy(t *testing.T, env Env, origins ...string) {
+	t.Helper()
+	pol, err := policy.Load(env.PolicyPath)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	for _, origin := range origins {
+		pol.Allow(origin)
+	}
+	if err := pol.Save(env.PolicyPath); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+}
+
+func find(t *testing.T, r Report, name string) Check {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("No %q check in %+v", name, r.Checks)
+	return Check{}
+}
+
+func TestRun_Healthy(t *testing.T) {
+	env, _ := testEnv(t)
+	install(t, env, "chrome", env.Self, storeOrigin, devOrigin)
+
+	r := Run(env)
+	if !r.OK {
+		t.Errorf("Expected a healthy report, got %+v", r.Checks)
+	}
+	for _, name := range []string{"Google Chrome manifest", "Policy", "Log directory", "Platform tools"} {
+		if c := find(t, r, name); c.Status != Pass {
+			t.Errorf("%s = %+v", name, c)
+		}
+	}
+}
+
+func TestRun_NothingInstalled(t *testing.T) {
+	env, _ := testEnv(t)
+
+	r := Run(env)
+	c := find(t, r, "Manifests")
+	if r.OK || c.Status != Fail {
+		t.Fatalf("Expected a failure with no manifests, got %+v", r)
+	}
+	want := env.Self + " install --extension-id abcdefghijklmnopabcdefghijklmnop"
+	if c.Fix != want {
+		t.Errorf("Fix = %q, want %q", c.Fix, want)
+	}
+}
+
+func TestRun_Manifests(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(env Env, other string) // Installs for Chromium
+		detail string
+	}{
+		{
+			name: "corrupt",
+			setup: func(env Env, other string) {
+				path := install(t, env, "chromium", env.Self, storeOrigin)
+				os.WriteFile(path, []byte("{oops"), 0644)
+			},
+			detail: "failed to parse manifest",
+		},
+		{
+			name: "missing binary",
+			setup: func(env Env, other string) {
+				install(t, env, "chromium", "/nonexistent/reclaim-openwith", storeOrigin)
+			},
+			detail: "doesn't exist",
+		},
+		{
+			name: "not executable",
+			setup: func(env Env, other string) {
+				os.Chmod(other, 0644)
+				install(t, env, "chromium", other, storeOrigin)
+			},
+			detail: "isn't an executable",
+		},
+		{
+			name: "other version",
+			setup: func(env Env, other string) {
+				install(t, env, "chromium", other, storeOrigin)
+			},
+			detail: "is version 1.1.0, this is 1.2.0",
+		},
+		{
+			name: "wrong extension",
+			setup: func(env Env, other string) {
+				install(t, env, "chromium", env.Self, devOrigin)
+			},
+			detail: "doesn't include " + storeOrigin,
+		},
+		{
+			name: "placeholder",
+			setup: func(env Env, other string) {
+				install(t, env, "chromium", env.Self, "chrome-extension://EXTENSION_ID_PLACEHOLDER/")
+			},
+			detail: "isn't an extension origin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, other := testEnv(t)
+			tt.setup(env, other)
+
+			r := Run(env)
+			c := find(t, r, "Chromium manifest")
+			if r.OK || c.Status != Fail {
+				t.Fatalf("Expected a failure, got %+v", c)
+			}
+			if !strings.Contains(c.Detail, tt.detail) {
+				t.Errorf("Detail = %q, want it to mention %q", c.Detail, tt.detail)
+			}
+			want := env.Self + " install --extension-id abcdefghijklmnopabcdefghijklmnop --browser chromium"
+			if c.Fix != want {
+				t.Errorf("Fix = %q, want %q", c.Fix, want)
+			}
+		})
+	}
+}
+
+func TestRun_BrowserWithoutManifest(t *testing.T) {
+	env, _ := testEnv(t)
+	install(t, env, "chrome", env.Self, storeOrigin)
+	os.MkdirAll(filepath.Join(env.Home, ".config", "chromium"), 0700)
+
+	r := Run(env)
+	c := find(t, r, "Chromium manifest")
+	if !r.OK || c.Status != Warn {
+		t.Fatalf("Expected a warning that doesn't fail the report, got %+v", r)
+	}
+	want := env.Self + " install --extension-id abcdefghijklmnopabcdefghijklmnop --browser chromium"
+	if !strings.Contains(c.Detail, "not installed") || c.Fix != want {
+		t.Errorf("Chromium manifest = %+v", c)
+	}
+
+	// With no manifest anywhere, the report fails
+	env, _ = testEnv(t)
+	os.MkdirAll(filepath.Join(env.Home, ".config", "chromium"), 0700)
+	r = Run(env)
+	if c := find(t, r, "Manifests"); r.OK || c.Status != Fail {
+		t.Errorf("Expected a failure with no manifests, got %+v", r)
+	}
+}
+
+func TestCovered(t *testing.T) {
+	env, _ := testEnv(t)
+	chrome, _ := manifest.LookupBrowser("chrome")
+	brave, _ := manifest.LookupBrowser("brave")
+	edge, _ := manifest.LookupBrowser("edge")
+
+	// Chrome and Brave share a system directory on Linux, and Find
+	// reports a manifest there as Chrome's
+	found := []manifest.Found{{
+		Browser: chrome,
+		Path:    filepath.Join(chrome.Dir("linux", env.Home, true), manifest.FileName),
+		System:  true,
+	}}
+	if !covered(env, found, chrome) || !covered(env, found, brave) {
+		t.Error("Expected a system manifest to cover the browsers that read it")
+	}
+	if covered(env, found, edge) {
+		t.Error("Expected Edge not to be covered by Chrome's manifest")
+	}
+}
+
+func TestRun_Policy(t *testing.T) {
+	env, _ := testEnv(t)
+	install(t, env, "chrome", env.Self, storeOrigin, devOrigin)
+	allow := env.Self + " install --extension-id abcdefghijklmnopabcdefghijklmnop --extension-id ponmlkjihgfedcbaponmlkjihgfedcba"
+
+	// Installed extensions without a callers entry are refused
+	os.Remove(env.PolicyPath)
+	r := Run(env)
+	c := find(t, r, "Policy")
+	if r.OK || c.Status != Fail || !strings.Contains(c.Detail, devOrigin) || c.Fix != allow {
+		t.Errorf("Policy without entries = %+v", c)
+	}
+
+	os.WriteFile(env.PolicyPath, []byte(`{oops`), 0600)
+	r = Run(env)
+	c = find(t, r, "Policy")
+	if r.OK || c.Status != Fail || c.Fix != "mv "+env.PolicyPath+" "+env.PolicyPath+".bak && "+allow {
+		t.Errorf("Corrupt policy = %+v", c)
+	}
+
+	// An entry that leaves out open needs a hand edit, since install keeps it
+	entry := `{"origin":"` + devOrigin + `","actions":["writeFile"]}`
+	os.WriteFile(env.PolicyPath, []byte(`{"callers":[`+entry+`]}`), 0600)
+	allowPolicy(t, env, storeOrigin)
+	c = find(t, Run(env), "Policy")
+	edit := "in " + env.PolicyPath + ", replace " + entry + ` with {"origin":"` + devOrigin + `","actions":["writeFile","open"]}`
+	if c.Status != Fail || c.Fix != edit {
+		t.Errorf("Policy without open = %+v", c)
+	}
+
+	os.Remove(env.PolicyPath)
+	allowPolicy(t, env, storeOrigin, devOrigin)
+	if c := find(t, Run(env), "Policy"); c.Status != Pass {
+		t.Errorf("Policy = %+v", c)
+	}
+}
+
+func TestRun_AnyOrigin(t *testing.T) {
+	env, _ := testEnv(t)
+	env.Origins = nil
+	install(t, env, "chrome", env.Self, devOrigin)
+
+	if r := Run(env); !r.OK {
+		t.Errorf("Expected any valid origin to pass, got %+v", r.Checks)
+	}
+}
+
+func TestRun_Environment(t *testing.T) {
+	env, _ := testEnv(t)
+	install(t, env, "chrome", env.Self, storeOrigin)
+	env.LookPath = func(file string) (string, error) { return "", errors.New("not found") }
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0600)
+	env.LogDir = filepath.Join(file, "logs")
+
+	r := Run(env)
+	if c := find(t, r, "Platform tools"); c.Status != Fail || !strings.Contains(c.Detail, "osascript") || c.Fix != "" {
+		t.Errorf("Platform tools = %+v", c)
+	}
+	if c := find(t, r, "Log directory"); c.Status != Fail || c.Fix == "" {
+		t.Errorf("Log directory = %+v", c)
+	}
+}
+
+func TestRun_ToolsOffPath(t *testing.T) {
+	env, _ := testEnv(t)
+	install(t, env, "chrome", env.Self, storeOrigin)
+	env.LookPath = func(file string) (string, error) {
+		if file == "/usr/bin/osascript" {
+			return file, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	c := find(t, Run(env), "Platform tools")
+	if c.Status != Fail || !strings.Contains(c.Detail, "osascript is in /usr/bin") || !strings.Contains(c.Fix, "PATH=/usr/bin") {
+		t.Errorf("Platform tools = %+v", c)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"/usr/local/bin/reclaim-openwith":      "/usr/local/bin/reclaim-openwith",
+		"/Users/a/Library/Application Support": "'/Users/a/Library/Application Support'",
+		"it's":                                 `'it'\''s'`,
+	}
+	for in, want := range tests {
+		if got := quote(in); got != want {
+			t.Errorf("quote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRun_Firefox(t *testing.T) {
+	const addon = "openwith@reclaim.app"
+	env, _ := testEnv(t)
+	env.Origins = []string{storeOrigin, "firefox-extension://" + addon + "/"}
+	install(t, env, "chrome", env.Self, storeOrigin)
+
+	// A Firefox profile without the manifest
+	os.MkdirAll(filepath.Join(env.Home, ".mozilla", "firefox"), 0700)
+	r := Run(env)
+	c := find(t, r, "Firefox manifest")
+	if c.Status != Warn || c.Fix != env.Self+" install --extension-id openwith@reclaim.app --browser firefox" {
+		t.Errorf("Firefox without a manifest = %+v", c)
+	}
+
+	// The Firefox variant is checked against allowed_extensions
+	m := manifest.Manifest{Name: manifest.HostName, Type: "stdio", Path: env.Self, AllowedExtensions: []string{"other@reclaim.app"}}
+	manifest.Install(m, manifest.Options{GOOS: env.GOOS, Home: env.Home, Browsers: []string{"firefox"}})
+	if c := find(t, Run(env), "Firefox manifest"); c.Status != Fail || !strings.Contains(c.Detail, "allowed_extensions doesn't include "+addon) {
+		t.Errorf("Firefox with the wrong add-on = %+v", c)
+	}
+
+	m.AllowedExtensions = []string{addon}
+	manifest.Install(m, manifest.Options{GOOS: env.GOOS, Home: env.Home, Browsers: []string{"firefox"}})
+	allowPolicy(t, env, "firefox-extension://"+addon+"/")
+	if r := Run(env); !r.OK {
+		t.Errorf("Expected a healthy report, got %+v", r.Checks)
+	}
+}
@@ -0,0 +1,117 @@
+// Package files writes documents the extension generates in memory into a
+// directory the host owns, so they can be opened without going through
+// the browser's downloads.
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/reclaim/openwith/internal/atomicfile"
+)
+
+// Prefix starts every file name, as the open handlers require
+const Prefix = "open-with-"
+
+// errTaken means every name Write tried is in use
+var errTaken = errors.New("every name is taken")
+
+const (
+	// maxTitleBytes keeps names well under the usual 255-byte limit once
+	// the prefix, a collision suffix and the extension are added
+	maxTitleBytes = 200
+	// maxCollisions is how many " (n)" suffixes are tried before giving up
+	maxCollisions = 1000
+)
+
+// DefaultDir returns the directory generated files are written to
+// (e.g. ~/.cache/reclaim-openwith/files)
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "reclaim-openwith", "files"), nil
+}
+
+// SanitizeTitle turns a document title into something safe to use in a
+// file name. It drops characters that are reserved on any of the desktop
+// platforms, control characters and leading dots, collapses whitespace,
+// and caps the length. It returns "" if nothing usable is left.
+func SanitizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range title {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r) && !unicode.IsSpace(r),
+			strings.ContainsRune(`\/:*?"<>|`, r):
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	s := b.String()
+	if len(s) > maxTitleBytes {
+		s = s[:maxTitleBytes]
+		for !utf8.ValidString(s) {
+			s = s[:len(s)-1]
+		}
+	}
+	// Leading dots would hide the file; trailing ones and spaces are
+	// dropped by Windows and confuse other tools
+	s = strings.TrimLeft(s, ".")
+	return strings.TrimRight(s, ". ")
+}
+
+// Write saves data as open-with-{title}.{ext} in dir, adding " (2)",
+// " (3)" and so on if the name is taken, and returns the path written.
+// The file is written to a temporary name and linked into place, so it
+// never appears half-written and never replaces an existing file. dir is
+// created 0700 and the file 0600.
+func Write(dir, title, ext string, data []byte) (string, error) {
+	title = SanitizeTitle(title)
+	if title == "" {
+		title = "untitled"
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create files directory: %w", err)
+	}
+
+	// Unlike rename, link fails rather than replacing an existing file
+	var path string
+	err := atomicfile.Place(dir, ".write", data, 0600, func(tmp string) error {
+		for n := 1; n <= maxCollisions; n++ {
+			name := Prefix + title + "." + ext
+			if n > 1 {
+				name = fmt.Sprintf("%s%s (%d).%s", Prefix, title, n, ext)
+			}
+			path = filepath.Join(dir, name)
+
+			err := os.Link(tmp, path)
+			if !errors.Is(err, os.ErrExist) {
+				return err
+			}
+		}
+		return errTaken
+	})
+	if errors.Is(err, errTaken) {
+		return "", fmt.Errorf("failed to write file: %d files named %q already exist", maxCollisions, title)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,102 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Q3 Budget", "Q3 Budget"},
+		{"  Q3   Budget\t\n", "Q3 Budget"},
+		{"../../etc/passwd", "etcpasswd"},
+		{`a\b:c*d?e"f<g>h|i`, "abcdefghi"},
+		{"..hidden", "hidden"},
+		{"trailing dots. . .", "trailing dots"},
+		{"bell\x07and\x00nul", "bellandnul"},
+		{"Résumé – 2024", "Résumé – 2024"},
+		{"///", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeTitle(tt.title); got != tt.want {
+			t.Errorf("SanitizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeTitle_Length(t *testing.T) {
+	got := SanitizeTitle(strings.Repeat("é", maxTitleBytes))
+	if len(got) > maxTitleBytes || !utf8.ValidString(got) {
+		t.Errorf("SanitizeTitle() = %d bytes, valid UTF-8 %v", len(got), utf8.ValidString(got))
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "files")
+
+	path, err := Write(dir, "Q3: Budget", "txt", []byte("hello"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if filepath.Base(path) != "open-with-Q3 Budget.txt" {
+		t.Errorf("Write() = %q", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("File holds %q, %v", data, err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected file mode 0600, got %o", info.Mode().Perm())
+	}
+	info, _ = os.Stat(dir)
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Expected directory mode 0700, got %o", info.Mode().Perm())
+	}
+
+	// Only the finished file is left behind
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected one file in %s, found %d", dir, len(entries))
+	}
+}
+
+func TestWrite_Collisions(t *testing.T) {
+	dir := t.TempDir()
+
+	want := []string{"open-with-Report.txt", "open-with-Report (2).txt", "open-with-Report (3).txt"}
+	for i, name := range want {
+		path, err := Write(dir, "Report", "txt", []byte{byte('a' + i)})
+		if err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+		if filepath.Base(path) != name {
+			t.Errorf("Write() #%d = %q, want %q", i+1, filepath.Base(path), name)
+		}
+	}
+
+	// The first file was not replaced
+	data, _ := os.ReadFile(filepath.Join(dir, want[0]))
+	if string(data) != "a" {
+		t.Errorf("First file now holds %q", data)
+	}
+}
+
+func TestWrite_EmptyTitle(t *testing.T) {
+	path, err := Write(t.TempDir(), "???", "txt", []byte("x"))
+	if err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if filepath.Base(path) != "open-with-untitled.txt" {
+		t.Errorf("Write() = %q", path)
+	}
+}
@@ -0,0 +1,249 @@
+// Package filetypes is the single registry of file types the native host
+// knows about. Path validation, getDefaults and MIME lookups all derive
+// from it, so adding a type is a one-line change here.
+package filetypes
+
+import "strings"
+
+// Risk classifies how much a file type can do when it is opened
+type Risk string
+
+const (
+	// RiskLow is inert data: plain text and raster images
+	RiskLow Risk = "low"
+	// RiskMedium is documents that can carry macros or scripts the
+	// opening app may run (Office, PDF)
+	RiskMedium Risk = "medium"
+	// RiskHigh is formats that run embedded script in their usual
+	// handler, typically a web browser
+	RiskHigh Risk = "high"
+)
+
+// Content says how a file's bytes are checked against its extension
+type Content int
+
+const (
+	// ContentMagic files must start with one of Magic
+	ContentMagic Content = iota
+	// ContentText files must be valid UTF-8; Magic, if set, must follow
+	// any byte order mark and leading whitespace
+	ContentText
+	// ContentOOXML files are ZIP containers whose [Content_Types].xml
+	// declares one of ContentTypes
+	ContentOOXML
+	// ContentZIPMimetype files are ZIP containers whose "mimetype" entry
+	// holds the canonical MIME type (OpenDocument, EPUB)
+	ContentZIPMimetype
+)
+
+// FileType describes one file extension
+type FileType struct {
+	Ext          string   // Extension without the dot, lowercase
+	MIMETypes    []string // MIME types, canonical first
+	Magic        [][]byte // Accepted leading bytes; nil if the format has no fixed header
+	Content      Content  // How the file body is checked before opening
+	ContentTypes []string // OOXML main part content types, macro-enabled variants included
+	Risk         Risk
+	Enabled      bool // Whether the host accepts files of this type
+}
+
+// MIMEType returns the canonical MIME type
+func (t FileType) MIMEType() string {
+	if len(t.MIMETypes) == 0 {
+		return ""
+	}
+	return t.MIMETypes[0]
+}
+
+// Leading bytes shared by several formats
+var (
+	magicZIP = []byte("PK\x03\x04")
+	magicPDF = []byte("%PDF-")
+)
+
+// registry lists every known type. Order is preserved in responses.
+var registry = []FileType{
+	{
+		Ext:       "xlsx",
+		MIMETypes: []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentOOXML,
+		ContentTypes: []string{
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml",
+			"application/vnd.ms-excel.sheet.macroEnabled.main+xml",
+		},
+		Risk:    RiskMedium,
+		Enabled: true,
+	},
+	{
+		Ext:       "docx",
+		MIMETypes: []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentOOXML,
+		ContentTypes: []string{
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+			"application/vnd.ms-word.document.macroEnabled.main+xml",
+		},
+		Risk:    RiskMedium,
+		Enabled: true,
+	},
+	{
+		Ext:       "pptx",
+		MIMETypes: []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentOOXML,
+		ContentTypes: []string{
+			"application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml",
+			"application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml",
+		},
+		Risk:    RiskMedium,
+		Enabled: true,
+	},
+	{
+		Ext:       "txt",
+		MIMETypes: []string{"text/plain"},
+		Content:   ContentText,
+		Risk:      RiskLow,
+		Enabled:   true,
+	},
+	{
+		Ext:       "pdf",
+		MIMETypes: []string{"application/pdf"},
+		Magic:     [][]byte{magicPDF},
+		Content:   ContentMagic,
+		Risk:      RiskMedium,
+		Enabled:   true,
+	},
+	{
+		Ext:       "csv",
+		MIMETypes: []string{"text/csv"},
+		Content:   ContentText,
+		Risk:      RiskLow,
+		Enabled:   true,
+	},
+	{
+		Ext:       "odt",
+		MIMETypes: []string{"application/vnd.oasis.opendocument.text"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentZIPMimetype,
+		Risk:      RiskMedium,
+		Enabled:   true,
+	},
+	{
+		Ext:       "ods",
+		MIMETypes: []string{"application/vnd.oasis.opendocument.spreadsheet"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentZIPMimetype,
+		Risk:      RiskMedium,
+		Enabled:   true,
+	},
+	{
+		Ext:       "odp",
+		MIMETypes: []string{"application/vnd.oasis.opendocument.presentation"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentZIPMimetype,
+		Risk:      RiskMedium,
+		Enabled:   true,
+	},
+	{
+		Ext:       "rtf",
+		MIMETypes: []string{"application/rtf", "text/rtf"},
+		Magic:     [][]byte{[]byte(`{\rtf`)},
+		Content:   ContentMagic,
+		Risk:      RiskMedium,
+		Enabled:   true,
+	},
+	{
+		Ext:       "md",
+		MIMETypes: []string{"text/markdown", "text/x-markdown"},
+		Content:   ContentText,
+		Risk:      RiskLow,
+		Enabled:   true,
+	},
+	{
+		// Opens in a browser with script enabled
+		Ext:       "html",
+		MIMETypes: []string{"text/html"},
+		Content:   ContentText,
+		Risk:      RiskHigh,
+		Enabled:   false,
+	},
+	{
+		Ext:       "png",
+		MIMETypes: []string{"image/png"},
+		Magic:     [][]byte{[]byte("\x89PNG\r\n\x1a\n")},
+		Content:   ContentMagic,
+		Risk:      RiskLow,
+		Enabled:   true,
+	},
+	{
+		Ext:       "jpg",
+		MIMETypes: []string{"image/jpeg"},
+		Magic:     [][]byte{[]byte("\xff\xd8\xff")},
+		Content:   ContentMagic,
+		Risk:      RiskLow,
+		Enabled:   true,
+	},
+	{
+		// SVG is XML that can embed script, and browsers are common handlers
+		Ext:       "svg",
+		MIMETypes: []string{"image/svg+xml"},
+		Content:   ContentText,
+		Risk:      RiskHigh,
+		Enabled:   false,
+	},
+	{
+		Ext:       "ics",
+		MIMETypes: []string{"text/calendar"},
+		Magic:     [][]byte{[]byte("BEGIN:VCALENDAR")},
+		Content:   ContentText,
+		Risk:      RiskLow,
+		Enabled:   true,
+	},
+	{
+		Ext:       "epub",
+		MIMETypes: []string{"application/epub+zip"},
+		Magic:     [][]byte{magicZIP},
+		Content:   ContentZIPMimetype,
+		Risk:      RiskMedium,
+		Enabled:   true,
+	},
+}
+
+// Lookup returns the registered type for an extension, with or without the
+// leading dot. Disabled types are returned too; see Supported.
+func Lookup(ext string) (FileType, bool) {
+	ext = strings.TrimPrefix(ext, ".")
+	for _, t := range registry {
+		if t.Ext == ext {
+			return t, true
+		}
+	}
+	return FileType{}, false
+}
+
+// Supported reports whether the host accepts files with this extension
+func Supported(ext string) bool {
+	t, ok := Lookup(ext)
+	return ok && t.Enabled
+}
+
+// Enabled returns the types the host accepts, in registry order
+func Enabled() []FileType {
+	var types []FileType
+	for _, t := range registry {
+		if t.Enabled {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Extensions returns the extensions the host accepts, in registry order
+func Extensions() []string {
+	var exts []string
+	for _, t := range Enabled() {
+		exts = append(exts, t.Ext)
+	}
+	return exts
+}
@@ -0,0 +1,94 @@
+package filetypes
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRegistryIsConsistent(t *testing.T) {
+	extPattern := regexp.MustCompile(`^[a-z0-9]+$`)
+	seen := make(map[string]bool)
+
+	for _, ft := range registry {
+		if !extPattern.MatchString(ft.Ext) {
+			t.Errorf("%q: extension must be lowercase alphanumeric", ft.Ext)
+		}
+		if seen[ft.Ext] {
+			t.Errorf("%q: registered twice", ft.Ext)
+		}
+		seen[ft.Ext] = true
+
+		if ft.MIMEType() == "" || !strings.Contains(ft.MIMEType(), "/") {
+			t.Errorf("%q: invalid canonical MIME type %q", ft.Ext, ft.MIMEType())
+		}
+		for _, magic := range ft.Magic {
+			if len(magic) == 0 {
+				t.Errorf("%q: empty magic signature", ft.Ext)
+			}
+		}
+		switch ft.Risk {
+		case RiskLow, RiskMedium, RiskHigh:
+		default:
+			t.Errorf("%q: unknown risk class %q", ft.Ext, ft.Risk)
+		}
+		if ft.Risk == RiskHigh && ft.Enabled {
+			t.Errorf("%q: high-risk types must not be enabled by default", ft.Ext)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ext           string
+		wantFound     bool
+		wantSupported bool
+		wantMIME      string
+	}{
+		{ext: "xlsx", wantFound: true, wantSupported: true, wantMIME: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{ext: ".pdf", wantFound: true, wantSupported: true, wantMIME: "application/pdf"},
+		{ext: "ods", wantFound: true, wantSupported: true, wantMIME: "application/vnd.oasis.opendocument.spreadsheet"},
+		{ext: "rtf", wantFound: true, wantSupported: true, wantMIME: "application/rtf"},
+		{ext: "html", wantFound: true, wantSupported: false, wantMIME: "text/html"},
+		{ext: "svg", wantFound: true, wantSupported: false, wantMIME: "image/svg+xml"},
+		{ext: "XLSX", wantFound: false},
+		{ext: "exe", wantFound: false},
+		{ext: "", wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			ft, ok := Lookup(tt.ext)
+			if ok != tt.wantFound {
+				t.Fatalf("Lookup(%q) found = %v, want %v", tt.ext, ok, tt.wantFound)
+			}
+			if ok && ft.MIMEType() != tt.wantMIME {
+				t.Errorf("Lookup(%q).MIMEType() = %q, want %q", tt.ext, ft.MIMEType(), tt.wantMIME)
+			}
+			if got := Supported(tt.ext); got != tt.wantSupported {
+				t.Errorf("Supported(%q) = %v, want %v", tt.ext, got, tt.wantSupported)
+			}
+		})
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	exts := Extensions()
+
+	// The original types keep their order at the front of responses
+	want := []string{"xlsx", "docx", "pptx", "txt", "pdf"}
+	if len(exts) < len(want) || strings.Join(exts[:len(want)], ",") != strings.Join(want, ",") {
+		t.Errorf("Extensions() = %v, want prefix %v", exts, want)
+	}
+
+	for _, ext := range []string{"csv", "odt", "ods", "odp", "rtf", "md", "png", "jpg", "ics", "epub"} {
+		if !Supported(ext) {
+			t.Errorf("Expected %q to be supported", ext)
+		}
+	}
+	for _, ext := range exts {
+		if ext == "html" || ext == "svg" {
+			t.Errorf("Extensions() includes disabled type %q", ext)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+	"github.com/reclaim/openwith/internal/messaging"
+	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// HandleListApps returns every application registered for the requested file
+// type, marking the one the system would use by default
+func HandleListApps(req messaging.ListAppsRequest, plat platform.Platform) nativehost.Response {
+	if !filetypes.Supported(req.FileType) {
+		return nativehost.Response{
+			Success: false,
+			Error:   "unsupported_type",
+			Message: "Unsupported file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	apps, err := plat.ListApps(req.FileType)
+	if err != nil {
+		return nativehost.Response{
+			Success: false,
+			Error:   "unknown",
+			Message: "Could not list applications for this file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	// A missing default is fine; no entry is marked in that case
+	defaultApp, defaultErr := plat.GetDefaultApp(req.FileType)
+
+	list := make([]messaging.App, 0, len(apps))
+	for _, app := range apps {
+		list = append(list, messaging.App{
+			Name:      app.Name,
+			ID:        app.BundleID,
+			Path:      app.Path,
+			IsDefault: defaultErr == nil && sameApp(app, defaultApp),
+		})
+	}
+
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			FileType: req.FileType,
+			Apps:     list,
+		},
+	}
+}
+
+// HandleSetSystemDefault makes the chosen app the OS-wide default for a file
+// type, so a missing association can be fixed from the error screen. The
+// response reports the default in effect afterwards.
+func HandleSetSystemDefault(req messaging.SetSystemDefaultRequest, plat platform.Platform) nativehost.Response {
+	if !filetypes.Supported(req.FileType) {
+		return nativehost.Response{
+			Success: false,
+			Error:   "unsupported_type",
+			Message: "Unsupported file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	app, ok := resolveApp(plat, req.FileType, req.AppID)
+	if !ok {
+		return nativehost.Response{
+			Success: false,
+			Error:   "app_not_found",
+			Message: "The selected application cannot open this file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	if err := plat.SetDefaultApp(req.FileType, app); err != nil {
+		log.Printf("Error setting default app for %s: %v", req.FileType, err)
+		return nativehost.Response{
+			Success: false,
+			Error:   "set_default_failed",
+			Message: "Could not change the default application",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	var entry messaging.DefaultApp
+	if current, err := plat.GetDefaultApp(req.FileType); err == nil {
+		entry.Name = current.Name
+		entry.BundleID = current.BundleID
+	}
+
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			FileType: req.FileType,
+			Defaults: map[string]messaging.DefaultApp{req.FileType: entry},
+		},
+	}
+}
+
+// resolveApp finds the app with the given ID among those the platform lists
+// for ext. IDs that were not discovered this way are rejected.
+func resolveApp(plat platform.Platform, ext string, id string) (platform.AppInfo, bool) {
+	if id == "" {
+		return platform.AppInfo{}, false
+	}
+
+	apps, err := plat.ListApps(ext)
+	if err != nil {
+		return platform.AppInfo{}, false
+	}
+	for _, app := range apps {
+		if app.BundleID == id && app.Path != "" {
+			return app, true
+		}
+	}
+	return platform.AppInfo{}, false
+}
+
+// sameApp compares by ID when both apps have one, by path otherwise
+func sameApp(a, b platform.AppInfo) bool {
+	if a.BundleID != "" && b.BundleID != "" {
+		return a.BundleID == b.BundleID
+	}
+	return a.Path != "" && a.Path == b.Path
+}
@@ -1,35 +1,37 @@
 package handlers
 
 import (
+	"github.com/reclaim/openwith/internal/filetypes"
 	"github.com/reclaim/openwith/internal/messaging"
 	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/nativehost"
 )
 
-// supportedExtensions lists all file extensions we support
-var supportedExtensions = []string{"xlsx", "docx", "pptx", "txt", "pdf"}
+// HandleGetDefaults returns the default applications for all supported file types.
+// Types with a preferred app also carry preferredName/preferredId, which is
+// what HandleOpen will use.
+func HandleGetDefaults(plat platform.Platform, store *prefs.Store) nativehost.Response {
+	defaults := make(map[string]messaging.DefaultApp)
 
-// HandleGetDefaults returns the default applications for all supported file types
-func HandleGetDefaults(plat platform.Platform) messaging.Response {
-	defaults := make(map[string]interface{})
-
-	for _, ext := range supportedExtensions {
-		app, err := plat.GetDefaultApp(ext)
-		if err != nil {
-			// If no default app, include in response with empty values
-			defaults[ext] = map[string]string{
-				"name":     "",
-				"bundleId": "",
-			}
-			continue
+	for _, ext := range filetypes.Extensions() {
+		var entry messaging.DefaultApp
+		// If no default app, include in response with empty values
+		if app, err := plat.GetDefaultApp(ext); err == nil {
+			entry.Name = app.Name
+			entry.BundleID = app.BundleID
 		}
-		defaults[ext] = map[string]string{
-			"name":     app.Name,
-			"bundleId": app.BundleID,
+		if app, ok := preferredApp(plat, store, ext); ok {
+			entry.PreferredName = app.Name
+			entry.PreferredID = app.BundleID
 		}
+		defaults[ext] = entry
 	}
 
-	return messaging.Response{
-		Success:  true,
-		Defaults: defaults,
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			Defaults: defaults,
+		},
 	}
 }
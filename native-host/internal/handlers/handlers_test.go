@@ -1,19 +1,29 @@
 package handlers
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/base64"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/reclaim/openwith/internal/messaging"
 	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/nativehost"
 )
 
 // MockPlatform implements platform.Platform for testing
 type MockPlatform struct {
 	DefaultApps     map[string]platform.AppInfo
+	Apps            map[string][]platform.AppInfo
 	GetDefaultErr   error
+	ListErr         error
+	SetDefaultErr   error
 	OpenErr         error
 	OpenedFiles     []string
 	OpenWithAppPath string
@@ -29,6 +39,24 @@ func (m *MockPlatform) GetDefaultApp(ext string) (platform.AppInfo, error) {
 	return platform.AppInfo{}, errors.New("no default app")
 }
 
+func (m *MockPlatform) ListApps(ext string) ([]platform.AppInfo, error) {
+	if m.ListErr != nil {
+		return nil, m.ListErr
+	}
+	return m.Apps[ext], nil
+}
+
+func (m *MockPlatform) SetDefaultApp(ext string, app platform.AppInfo) error {
+	if m.SetDefaultErr != nil {
+		return m.SetDefaultErr
+	}
+	if m.DefaultApps == nil {
+		m.DefaultApps = make(map[string]platform.AppInfo)
+	}
+	m.DefaultApps[ext] = app
+	return nil
+}
+
 func (m *MockPlatform) OpenWithDefault(path string) error {
 	if m.OpenErr != nil {
 		return m.OpenErr
@@ -42,6 +70,49 @@ func (m *MockPlatform) OpenWith(path string, appPath string) error {
 	return m.OpenWithDefault(path)
 }
 
+// workbookContentTypes declares a plain .xlsx workbook
+const workbookContentTypes = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+</Types>`
+
+// writeTestFile creates a file whose content matches its extension: a
+// minimal workbook for .xlsx, plain text otherwise
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+
+	if filepath.Ext(path) != ".xlsx" {
+		if err := os.WriteFile(path, []byte("test content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return
+	}
+	writeZip(t, path, "[Content_Types].xml", workbookContentTypes)
+}
+
+// writeZip creates a ZIP file from name/content pairs
+func writeZip(t *testing.T, path string, entries ...string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+}
+
 func TestHandleGetDefaults_AllAppsConfigured(t *testing.T) {
 	mock := &MockPlatform{
 		DefaultApps: map[string]platform.AppInfo{
@@ -53,26 +124,26 @@ func TestHandleGetDefaults_AllAppsConfigured(t *testing.T) {
 		},
 	}
 
-	resp := HandleGetDefaults(mock)
+	resp := HandleGetDefaults(mock, nil)
 
 	if !resp.Success {
 		t.Errorf("Expected success=true, got false")
 	}
 
-	if resp.Defaults == nil {
+	if messaging.ResultOf(resp).Defaults == nil {
 		t.Fatal("Expected defaults to be set")
 	}
 
 	// Check xlsx
-	xlsx, ok := resp.Defaults["xlsx"].(map[string]string)
+	xlsx, ok := messaging.ResultOf(resp).Defaults["xlsx"]
 	if !ok {
 		t.Fatal("Expected xlsx to be map[string]string")
 	}
-	if xlsx["name"] != "Microsoft Excel" {
-		t.Errorf("Expected xlsx name 'Microsoft Excel', got '%s'", xlsx["name"])
+	if xlsx.Name != "Microsoft Excel" {
+		t.Errorf("Expected xlsx name 'Microsoft Excel', got '%s'", xlsx.Name)
 	}
-	if xlsx["bundleId"] != "com.microsoft.Excel" {
-		t.Errorf("Expected xlsx bundleId 'com.microsoft.Excel', got '%s'", xlsx["bundleId"])
+	if xlsx.BundleID != "com.microsoft.Excel" {
+		t.Errorf("Expected xlsx bundleId 'com.microsoft.Excel', got '%s'", xlsx.BundleID)
 	}
 }
 
@@ -84,25 +155,25 @@ func TestHandleGetDefaults_SomeMissing(t *testing.T) {
 		},
 	}
 
-	resp := HandleGetDefaults(mock)
+	resp := HandleGetDefaults(mock, nil)
 
 	if !resp.Success {
 		t.Errorf("Expected success=true even with missing apps")
 	}
 
 	// xlsx should have values
-	xlsx := resp.Defaults["xlsx"].(map[string]string)
-	if xlsx["name"] != "Microsoft Excel" {
-		t.Errorf("Expected xlsx name, got '%s'", xlsx["name"])
+	xlsx := messaging.ResultOf(resp).Defaults["xlsx"]
+	if xlsx.Name != "Microsoft Excel" {
+		t.Errorf("Expected xlsx name, got '%s'", xlsx.Name)
 	}
 
 	// docx should have empty values
-	docx := resp.Defaults["docx"].(map[string]string)
-	if docx["name"] != "" {
-		t.Errorf("Expected empty docx name, got '%s'", docx["name"])
+	docx := messaging.ResultOf(resp).Defaults["docx"]
+	if docx.Name != "" {
+		t.Errorf("Expected empty docx name, got '%s'", docx.Name)
 	}
-	if docx["bundleId"] != "" {
-		t.Errorf("Expected empty docx bundleId, got '%s'", docx["bundleId"])
+	if docx.BundleID != "" {
+		t.Errorf("Expected empty docx bundleId, got '%s'", docx.BundleID)
 	}
 }
 
@@ -112,19 +183,16 @@ func TestHandleOpen_Success(t *testing.T) {
 
 	// Create a test file with valid filename pattern (open-with-{title}.{ext})
 	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
-	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
-	}
+	writeTestFile(t, testFile)
 
 	mock := &MockPlatform{}
 
-	msg := &messaging.Message{
-		Action:   "open",
+	req := messaging.OpenRequest{
 		FilePath: testFile,
 		FileType: "xlsx",
 	}
 
-	resp := HandleOpen(msg, mock)
+	resp := HandleOpen(context.Background(), req, mock, nil, policy.Default())
 
 	if !resp.Success {
 		t.Errorf("Expected success=true, got false: %s", resp.Message)
@@ -150,13 +218,12 @@ func TestHandleOpen_FileNotFound(t *testing.T) {
 	mock := &MockPlatform{}
 
 	// Use valid filename format but non-existent path
-	msg := &messaging.Message{
-		Action:   "open",
+	req := messaging.OpenRequest{
 		FilePath: "/nonexistent/open-with-Test Document.xlsx",
 		FileType: "xlsx",
 	}
 
-	resp := HandleOpen(msg, mock)
+	resp := HandleOpen(context.Background(), req, mock, nil, policy.Default())
 
 	if resp.Success {
 		t.Error("Expected success=false for non-existent file")
@@ -170,13 +237,12 @@ func TestHandleOpen_FileNotFound(t *testing.T) {
 func TestHandleOpen_EmptyFilePath(t *testing.T) {
 	mock := &MockPlatform{}
 
-	msg := &messaging.Message{
-		Action:   "open",
+	req := messaging.OpenRequest{
 		FilePath: "",
 		FileType: "xlsx",
 	}
 
-	resp := HandleOpen(msg, mock)
+	resp := HandleOpen(context.Background(), req, mock, nil, policy.Default())
 
 	if resp.Success {
 		t.Error("Expected success=false for empty file path")
@@ -192,21 +258,18 @@ func TestHandleOpen_OpenError(t *testing.T) {
 
 	// Use valid filename format
 	testFile := filepath.Join(tempDir, "open-with-Meeting Notes.xlsx")
-	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
-	}
+	writeTestFile(t, testFile)
 
 	mock := &MockPlatform{
 		OpenErr: errors.New("failed to open"),
 	}
 
-	msg := &messaging.Message{
-		Action:   "open",
+	req := messaging.OpenRequest{
 		FilePath: testFile,
 		FileType: "xlsx",
 	}
 
-	resp := HandleOpen(msg, mock)
+	resp := HandleOpen(context.Background(), req, mock, nil, policy.Default())
 
 	if resp.Success {
 		t.Error("Expected success=false when open fails")
@@ -216,8 +279,8 @@ func TestHandleOpen_OpenError(t *testing.T) {
 		t.Errorf("Expected error 'no_default_app', got '%s'", resp.Error)
 	}
 
-	if resp.FileType != "xlsx" {
-		t.Errorf("Expected fileType 'xlsx', got '%s'", resp.FileType)
+	if messaging.ResultOf(resp).FileType != "xlsx" {
+		t.Errorf("Expected fileType 'xlsx', got '%s'", messaging.ResultOf(resp).FileType)
 	}
 }
 
@@ -227,19 +290,16 @@ func TestHandleOpen_InvalidFilenameFormat(t *testing.T) {
 
 	// Create a file with invalid filename format (not matching open-with-* pattern)
 	testFile := filepath.Join(tempDir, "malicious-file.xlsx")
-	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
-	}
+	writeTestFile(t, testFile)
 
 	mock := &MockPlatform{}
 
-	msg := &messaging.Message{
-		Action:   "open",
+	req := messaging.OpenRequest{
 		FilePath: testFile,
 		FileType: "xlsx",
 	}
 
-	resp := HandleOpen(msg, mock)
+	resp := HandleOpen(context.Background(), req, mock, nil, policy.Default())
 
 	if resp.Success {
 		t.Error("Expected success=false for invalid filename format")
@@ -254,13 +314,12 @@ func TestHandleOpen_SystemDirectoryBlocked(t *testing.T) {
 	mock := &MockPlatform{}
 
 	// Try to access a file in a system directory (even with valid filename)
-	msg := &messaging.Message{
-		Action:   "open",
+	req := messaging.OpenRequest{
 		FilePath: "/usr/local/open-with-System File.xlsx",
 		FileType: "xlsx",
 	}
 
-	resp := HandleOpen(msg, mock)
+	resp := HandleOpen(context.Background(), req, mock, nil, policy.Default())
 
 	if resp.Success {
 		t.Error("Expected success=false for system directory access")
@@ -270,3 +329,757 @@ func TestHandleOpen_SystemDirectoryBlocked(t *testing.T) {
 		t.Errorf("Expected error 'file_not_found', got '%s'", resp.Error)
 	}
 }
+
+func TestHandleListApps_Success(t *testing.T) {
+	mock := &MockPlatform{
+		DefaultApps: map[string]platform.AppInfo{
+			"xlsx": {Name: "LibreOffice Calc", BundleID: "libreoffice-calc.desktop"},
+		},
+		Apps: map[string][]platform.AppInfo{
+			"xlsx": {
+				{Name: "LibreOffice Calc", BundleID: "libreoffice-calc.desktop", Path: "/usr/share/applications/libreoffice-calc.desktop"},
+				{Name: "Gnumeric", BundleID: "org.gnome.Gnumeric.desktop", Path: "/usr/share/applications/org.gnome.Gnumeric.desktop"},
+			},
+		},
+	}
+
+	resp := HandleListApps(messaging.ListAppsRequest{FileType: "xlsx"}, mock)
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if len(messaging.ResultOf(resp).Apps) != 2 {
+		t.Fatalf("Expected 2 apps, got %d", len(messaging.ResultOf(resp).Apps))
+	}
+	if !messaging.ResultOf(resp).Apps[0].IsDefault || messaging.ResultOf(resp).Apps[0].ID != "libreoffice-calc.desktop" {
+		t.Errorf("Expected LibreOffice Calc to be the default, got %+v", messaging.ResultOf(resp).Apps[0])
+	}
+	if messaging.ResultOf(resp).Apps[1].IsDefault {
+		t.Errorf("Expected Gnumeric not to be the default, got %+v", messaging.ResultOf(resp).Apps[1])
+	}
+	if messaging.ResultOf(resp).Apps[1].Path != "/usr/share/applications/org.gnome.Gnumeric.desktop" {
+		t.Errorf("Expected Gnumeric path, got '%s'", messaging.ResultOf(resp).Apps[1].Path)
+	}
+}
+
+func TestHandleListApps_NoDefault(t *testing.T) {
+	mock := &MockPlatform{
+		Apps: map[string][]platform.AppInfo{
+			"pdf": {{Name: "Preview", BundleID: "com.apple.Preview", Path: "/System/Applications/Preview.app"}},
+		},
+	}
+
+	resp := HandleListApps(messaging.ListAppsRequest{FileType: "pdf"}, mock)
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if len(messaging.ResultOf(resp).Apps) != 1 || messaging.ResultOf(resp).Apps[0].IsDefault {
+		t.Errorf("Expected one non-default app, got %+v", messaging.ResultOf(resp).Apps)
+	}
+}
+
+func TestHandleListApps_UnsupportedType(t *testing.T) {
+	mock := &MockPlatform{}
+
+	resp := HandleListApps(messaging.ListAppsRequest{FileType: "exe"}, mock)
+
+	if resp.Success {
+		t.Error("Expected success=false for unsupported type")
+	}
+	if resp.Error != "unsupported_type" {
+		t.Errorf("Expected error 'unsupported_type', got '%s'", resp.Error)
+	}
+}
+
+func TestHandleListApps_PlatformError(t *testing.T) {
+	mock := &MockPlatform{ListErr: errors.New("query failed")}
+
+	resp := HandleListApps(messaging.ListAppsRequest{FileType: "docx"}, mock)
+
+	if resp.Success {
+		t.Error("Expected success=false when listing fails")
+	}
+	if resp.Error != "unknown" {
+		t.Errorf("Expected error 'unknown', got '%s'", resp.Error)
+	}
+}
+
+func TestHandleOpenWith_Success(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
+	writeTestFile(t, testFile)
+
+	mock := &MockPlatform{
+		Apps: map[string][]platform.AppInfo{
+			"xlsx": {
+				{Name: "LibreOffice Calc", BundleID: "libreoffice-calc.desktop", Path: "/usr/share/applications/libreoffice-calc.desktop"},
+			},
+		},
+	}
+
+	req := messaging.OpenWithRequest{
+		FilePath: testFile,
+		FileType: "xlsx",
+		AppID:    "libreoffice-calc.desktop",
+	}
+
+	resp := HandleOpenWith(context.Background(), req, mock, policy.Default())
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if mock.OpenWithAppPath != "/usr/share/applications/libreoffice-calc.desktop" {
+		t.Errorf("Expected app path to be resolved from ID, got '%s'", mock.OpenWithAppPath)
+	}
+	if len(mock.OpenedFiles) != 1 || mock.OpenedFiles[0] != testFile {
+		t.Errorf("Expected %s to be opened, got %v", testFile, mock.OpenedFiles)
+	}
+}
+
+func TestHandleOpenWith_UndiscoveredApp(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
+	writeTestFile(t, testFile)
+
+	mock := &MockPlatform{
+		Apps: map[string][]platform.AppInfo{
+			"xlsx": {{Name: "Microsoft Excel", BundleID: "com.microsoft.Excel", Path: "/Applications/Microsoft Excel.app"}},
+			"txt":  {{Name: "Terminal", BundleID: "com.apple.Terminal", Path: "/System/Applications/Utilities/Terminal.app"}},
+		},
+	}
+
+	// Registered for another type, an app path, and no ID at all
+	for _, appID := range []string{"com.apple.Terminal", "/System/Applications/Utilities/Terminal.app", ""} {
+		req := messaging.OpenWithRequest{
+			FilePath: testFile,
+			FileType: "xlsx",
+			AppID:    appID,
+		}
+
+		resp := HandleOpenWith(context.Background(), req, mock, policy.Default())
+
+		if resp.Success {
+			t.Errorf("Expected success=false for app ID %q", appID)
+		}
+		if resp.Error != "app_not_found" {
+			t.Errorf("Expected error 'app_not_found' for app ID %q, got '%s'", appID, resp.Error)
+		}
+	}
+
+	if len(mock.OpenedFiles) != 0 {
+		t.Errorf("Expected no files to be opened, got %v", mock.OpenedFiles)
+	}
+}
+
+func TestHandleOpenWith_InvalidFile(t *testing.T) {
+	mock := &MockPlatform{
+		Apps: map[string][]platform.AppInfo{
+			"xlsx": {{Name: "Microsoft Excel", BundleID: "com.microsoft.Excel", Path: "/Applications/Microsoft Excel.app"}},
+		},
+	}
+
+	req := messaging.OpenWithRequest{
+		FilePath: "/usr/local/open-with-System File.xlsx",
+		FileType: "xlsx",
+		AppID:    "com.microsoft.Excel",
+	}
+
+	resp := HandleOpenWith(context.Background(), req, mock, policy.Default())
+
+	if resp.Error != "file_not_found" {
+		t.Errorf("Expected error 'file_not_found', got '%s'", resp.Error)
+	}
+}
+
+func TestHandleOpenWith_OpenError(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "open-with-Notes.txt")
+	writeTestFile(t, testFile)
+
+	mock := &MockPlatform{
+		Apps: map[string][]platform.AppInfo{
+			"txt": {{Name: "TextEdit", BundleID: "com.apple.TextEdit", Path: "/System/Applications/TextEdit.app"}},
+		},
+		OpenErr: errors.New("failed to open"),
+	}
+
+	req := messaging.OpenWithRequest{
+		FilePath: testFile,
+		FileType: "txt",
+		AppID:    "com.apple.TextEdit",
+	}
+
+	resp := HandleOpenWith(context.Background(), req, mock, policy.Default())
+
+	if resp.Error != "open_failed" {
+		t.Errorf("Expected error 'open_failed', got '%s'", resp.Error)
+	}
+}
+
+// spreadsheetApps registers two apps for xlsx, with Excel as the default
+func spreadsheetApps() *MockPlatform {
+	return &MockPlatform{
+		DefaultApps: map[string]platform.AppInfo{
+			"xlsx": {Name: "Microsoft Excel", BundleID: "com.microsoft.Excel", Path: "/Applications/Microsoft Excel.app"},
+		},
+		Apps: map[string][]platform.AppInfo{
+			"xlsx": {
+				{Name: "Microsoft Excel", BundleID: "com.microsoft.Excel", Path: "/Applications/Microsoft Excel.app"},
+				{Name: "Numbers", BundleID: "com.apple.iWork.Numbers", Path: "/Applications/Numbers.app"},
+			},
+		},
+	}
+}
+
+func TestHandleSetPreferredApp(t *testing.T) {
+	mock := spreadsheetApps()
+	store := prefs.New(filepath.Join(t.TempDir(), "preferences.json"))
+
+	resp := HandleSetPreferredApp(messaging.SetPreferredAppRequest{
+		FileType: "xlsx",
+		AppID:    "com.apple.iWork.Numbers",
+	}, mock, store)
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	pref, ok := store.Get("xlsx")
+	if !ok || pref.AppID != "com.apple.iWork.Numbers" || pref.Name != "Numbers" {
+		t.Errorf("Expected Numbers to be stored, got %+v", pref)
+	}
+
+	// Apps the platform doesn't list for the type are rejected
+	resp = HandleSetPreferredApp(messaging.SetPreferredAppRequest{
+		FileType: "xlsx",
+		AppID:    "com.apple.Terminal",
+	}, mock, store)
+
+	if resp.Error != "app_not_found" {
+		t.Errorf("Expected error 'app_not_found', got '%s'", resp.Error)
+	}
+	if pref, _ := store.Get("xlsx"); pref.AppID != "com.apple.iWork.Numbers" {
+		t.Errorf("Expected rejected app not to replace preference, got %+v", pref)
+	}
+}
+
+func TestHandleClearPreferredApp(t *testing.T) {
+	store := prefs.New(filepath.Join(t.TempDir(), "preferences.json"))
+	if err := store.Set("xlsx", prefs.Preference{AppID: "com.apple.iWork.Numbers"}); err != nil {
+		t.Fatalf("Failed to set preference: %v", err)
+	}
+
+	resp := HandleClearPreferredApp(messaging.ClearPreferredAppRequest{FileType: "xlsx"}, store)
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if _, ok := store.Get("xlsx"); ok {
+		t.Error("Expected preference to be cleared")
+	}
+
+	resp = HandleClearPreferredApp(messaging.ClearPreferredAppRequest{FileType: "exe"}, store)
+	if resp.Error != "unsupported_type" {
+		t.Errorf("Expected error 'unsupported_type', got '%s'", resp.Error)
+	}
+}
+
+func TestHandleOpen_PreferredApp(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
+	writeTestFile(t, testFile)
+
+	mock := spreadsheetApps()
+	store := prefs.New(filepath.Join(tempDir, "preferences.json"))
+	if err := store.Set("xlsx", prefs.Preference{AppID: "com.apple.iWork.Numbers"}); err != nil {
+		t.Fatalf("Failed to set preference: %v", err)
+	}
+
+	resp := HandleOpen(context.Background(), messaging.OpenRequest{FilePath: testFile, FileType: "xlsx"}, mock, store, policy.Default())
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if mock.OpenWithAppPath != "/Applications/Numbers.app" {
+		t.Errorf("Expected file to open with Numbers, got '%s'", mock.OpenWithAppPath)
+	}
+}
+
+func TestHandleOpen_StalePreference(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
+	writeTestFile(t, testFile)
+
+	// The preferred app was uninstalled since it was chosen
+	mock := spreadsheetApps()
+	store := prefs.New(filepath.Join(tempDir, "preferences.json"))
+	if err := store.Set("xlsx", prefs.Preference{AppID: "org.gnome.Gnumeric.desktop"}); err != nil {
+		t.Fatalf("Failed to set preference: %v", err)
+	}
+
+	resp := HandleOpen(context.Background(), messaging.OpenRequest{FilePath: testFile, FileType: "xlsx"}, mock, store, policy.Default())
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if mock.OpenWithAppPath != "" {
+		t.Errorf("Expected default app to be used, got OpenWith '%s'", mock.OpenWithAppPath)
+	}
+	if len(mock.OpenedFiles) != 1 {
+		t.Errorf("Expected 1 opened file, got %d", len(mock.OpenedFiles))
+	}
+}
+
+func TestHandleGetDefaults_PreferredApp(t *testing.T) {
+	mock := spreadsheetApps()
+	store := prefs.New(filepath.Join(t.TempDir(), "preferences.json"))
+	if err := store.Set("xlsx", prefs.Preference{AppID: "com.apple.iWork.Numbers"}); err != nil {
+		t.Fatalf("Failed to set preference: %v", err)
+	}
+
+	resp := HandleGetDefaults(mock, store)
+
+	xlsx := messaging.ResultOf(resp).Defaults["xlsx"]
+	if xlsx.Name != "Microsoft Excel" || xlsx.BundleID != "com.microsoft.Excel" {
+		t.Errorf("Expected system default Excel, got %v", xlsx)
+	}
+	if xlsx.PreferredName != "Numbers" || xlsx.PreferredID != "com.apple.iWork.Numbers" {
+		t.Errorf("Expected preferred Numbers, got %v", xlsx)
+	}
+
+	docx := messaging.ResultOf(resp).Defaults["docx"]
+	if docx.PreferredID != "" || docx.PreferredName != "" {
+		t.Errorf("Expected no preference for docx, got %v", docx)
+	}
+}
+
+func TestHandleSetSystemDefault(t *testing.T) {
+	mock := spreadsheetApps()
+
+	resp := HandleSetSystemDefault(messaging.SetSystemDefaultRequest{
+		FileType: "xlsx",
+		AppID:    "com.apple.iWork.Numbers",
+	}, mock)
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	xlsx, ok := messaging.ResultOf(resp).Defaults["xlsx"]
+	if !ok {
+		t.Fatal("Expected xlsx to be map[string]string")
+	}
+	if xlsx.Name != "Numbers" || xlsx.BundleID != "com.apple.iWork.Numbers" {
+		t.Errorf("Expected new default Numbers, got %v", xlsx)
+	}
+}
+
+func TestHandleSetSystemDefault_NoDefaultYet(t *testing.T) {
+	// The situation behind a no_default_app error: handlers exist, no default
+	mock := &MockPlatform{
+		Apps: map[string][]platform.AppInfo{
+			"docx": {{Name: "LibreOffice Writer", BundleID: "libreoffice-writer.desktop", Path: "/usr/share/applications/libreoffice-writer.desktop"}},
+		},
+	}
+
+	resp := HandleSetSystemDefault(messaging.SetSystemDefaultRequest{
+		FileType: "docx",
+		AppID:    "libreoffice-writer.desktop",
+	}, mock)
+
+	if !resp.Success {
+		t.Fatalf("Expected success=true, got false: %s", resp.Message)
+	}
+	if mock.DefaultApps["docx"].BundleID != "libreoffice-writer.desktop" {
+		t.Errorf("Expected default to be set, got %+v", mock.DefaultApps["docx"])
+	}
+}
+
+func TestHandleSetSystemDefault_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileType  string
+		appID     string
+		setErr    error
+		wantError string
+	}{
+		{name: "unsupported type", fileType: "sh", appID: "com.microsoft.Excel", wantError: "unsupported_type"},
+		{name: "undiscovered app", fileType: "xlsx", appID: "com.apple.Terminal", wantError: "app_not_found"},
+		{name: "platform failure", fileType: "xlsx", appID: "com.apple.iWork.Numbers", setErr: errors.New("denied"), wantError: "set_default_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := spreadsheetApps()
+			mock.SetDefaultErr = tt.setErr
+
+			resp := HandleSetSystemDefault(messaging.SetSystemDefaultRequest{
+				FileType: tt.fileType,
+				AppID:    tt.appID,
+			}, mock)
+
+			if resp.Success {
+				t.Error("Expected success=false")
+			}
+			if resp.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, resp.Error)
+			}
+			if mock.DefaultApps["xlsx"].BundleID != "com.microsoft.Excel" {
+				t.Errorf("Expected default to be unchanged, got %+v", mock.DefaultApps["xlsx"])
+			}
+		})
+	}
+}
+
+func TestValidateFilePath_Registry(t *testing.T) {
+	tempDir := t.TempDir()
+	tests := []struct {
+		filename string
+		wantErr  string
+	}{
+		{filename: "open-with-Budget.xlsx", wantErr: ""},
+		{filename: "open-with-Export.csv", wantErr: ""},
+		{filename: "open-with-Minutes.odt", wantErr: ""},
+		{filename: "open-with-Chart.png", wantErr: ""},
+		{filename: "open-with-Book.epub", wantErr: ""},
+		{filename: "open-with-Page.html", wantErr: "Unsupported file type"},
+		{filename: "open-with-Logo.svg", wantErr: "Unsupported file type"},
+		{filename: "open-with-Setup.exe", wantErr: "Unsupported file type"},
+		{filename: "open-with-.xlsx", wantErr: "Invalid filename format"},
+		{filename: "open-with-README", wantErr: "Invalid filename format"},
+		{filename: "Budget.xlsx", wantErr: "Invalid filename format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := validateFilePath(filepath.Join(tempDir, tt.filename)); got != tt.wantErr {
+				t.Errorf("validateFilePath(%q) = %q, want %q", tt.filename, got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandleGetDefaults_RegistryTypes(t *testing.T) {
+	mock := &MockPlatform{
+		DefaultApps: map[string]platform.AppInfo{
+			"csv": {Name: "LibreOffice Calc", BundleID: "libreoffice-calc.desktop"},
+		},
+	}
+
+	resp := HandleGetDefaults(mock, nil)
+
+	csv, ok := messaging.ResultOf(resp).Defaults["csv"]
+	if !ok || csv.Name != "LibreOffice Calc" {
+		t.Errorf("Expected csv default LibreOffice Calc, got %v", messaging.ResultOf(resp).Defaults["csv"])
+	}
+	if _, ok := messaging.ResultOf(resp).Defaults["html"]; ok {
+		t.Error("Expected disabled html type to be left out")
+	}
+}
+
+func TestHandleOpen_ContentMismatch(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A sign-in page saved under the export's file name
+	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
+	if err := os.WriteFile(testFile, []byte("<!DOCTYPE html><html><body>Sign in</body></html>"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := spreadsheetApps()
+
+	resp := HandleOpen(context.Background(), messaging.OpenRequest{FilePath: testFile}, mock, nil, policy.Default())
+	if resp.Success {
+		t.Fatal("Expected failure for mismatched content")
+	}
+	if resp.Error != "content_mismatch" {
+		t.Errorf("Expected error 'content_mismatch', got '%s'", resp.Error)
+	}
+	if messaging.ResultOf(resp).FileType != "xlsx" {
+		t.Errorf("Expected fileType 'xlsx', got '%s'", messaging.ResultOf(resp).FileType)
+	}
+	if len(mock.OpenedFiles) != 0 {
+		t.Errorf("Expected nothing opened, got %v", mock.OpenedFiles)
+	}
+
+	resp = HandleOpenWith(context.Background(), messaging.OpenWithRequest{FilePath: testFile, AppID: "com.apple.iWork.Numbers"}, mock, policy.Default())
+	if resp.Error != "content_mismatch" {
+		t.Errorf("Expected openWith error 'content_mismatch', got '%s'", resp.Error)
+	}
+}
+
+func TestHandleOpen_ActiveContent(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testFile := filepath.Join(tempDir, "open-with-Q4 Budget.xlsx")
+	writeZip(t, testFile,
+		"[Content_Types].xml", workbookContentTypes,
+		"xl/vbaProject.bin", "\xd0\xcf\x11\xe0",
+	)
+	req := messaging.OpenRequest{FilePath: testFile}
+
+	t.Run("warn", func(t *testing.T) {
+		mock := &MockPlatform{}
+		resp := HandleOpen(context.Background(), req, mock, nil, policy.Policy{ActiveContent: policy.Warn})
+		if !resp.Success {
+			t.Fatalf("Expected success, got error: %s", resp.Error)
+		}
+		if len(mock.OpenedFiles) != 1 {
+			t.Errorf("Expected file to be opened, got %v", mock.OpenedFiles)
+		}
+		if len(messaging.ResultOf(resp).Warnings) != 1 || messaging.ResultOf(resp).Warnings[0].Code != "macros" || messaging.ResultOf(resp).Warnings[0].Part != "xl/vbaProject.bin" {
+			t.Errorf("Expected a macros warning for xl/vbaProject.bin, got %+v", messaging.ResultOf(resp).Warnings)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		mock := &MockPlatform{}
+		resp := HandleOpen(context.Background(), req, mock, nil, policy.Policy{ActiveContent: policy.Block})
+		if resp.Success {
+			t.Fatal("Expected failure when policy blocks active content")
+		}
+		if resp.Error != "active_content_blocked" {
+			t.Errorf("Expected error 'active_content_blocked', got '%s'", resp.Error)
+		}
+		if len(messaging.ResultOf(resp).Warnings) != 1 {
+			t.Errorf("Expected the finding in the response, got %+v", messaging.ResultOf(resp).Warnings)
+		}
+		if len(mock.OpenedFiles) != 0 {
+			t.Errorf("Expected nothing opened, got %v", mock.OpenedFiles)
+		}
+	})
+
+	t.Run("clean file under block", func(t *testing.T) {
+		clean := filepath.Join(tempDir, "open-with-Clean.xlsx")
+		writeTestFile(t, clean)
+
+		mock := &MockPlatform{}
+		resp := HandleOpen(context.Background(), messaging.OpenRequest{FilePath: clean}, mock, nil, policy.Policy{ActiveContent: policy.Block})
+		if !resp.Success {
+			t.Fatalf("Expected success, got error: %s", resp.Error)
+		}
+		if len(messaging.ResultOf(resp).Warnings) != 0 {
+			t.Errorf("Expected no warnings, got %+v", messaging.ResultOf(resp).Warnings)
+		}
+	})
+
+	t.Run("incomplete scan under block", func(t *testing.T) {
+		malformed := filepath.Join(tempDir, "open-with-Malformed.xlsx")
+		writeZip(t, malformed,
+			"[Content_Types].xml", workbookContentTypes,
+			"xl/worksheets/sheet1.xml", "<worksheet><sheetData",
+		)
+
+		mock := &MockPlatform{}
+		resp := HandleOpen(context.Background(), messaging.OpenRequest{FilePath: malformed}, mock, nil, policy.Policy{ActiveContent: policy.Block})
+		if resp.Error != "active_content_blocked" {
+			t.Fatalf("Expected error 'active_content_blocked', got '%s'", resp.Error)
+		}
+		if len(messaging.ResultOf(resp).Warnings) != 1 || messaging.ResultOf(resp).Warnings[0].Code != "incomplete" {
+			t.Errorf("Expected an incomplete warning, got %+v", messaging.ResultOf(resp).Warnings)
+		}
+		if len(mock.OpenedFiles) != 0 {
+			t.Errorf("Expected nothing opened, got %v", mock.OpenedFiles)
+		}
+	})
+}
+
+func TestHandleOpen_PDFActiveContent(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "open-with-Invoice.pdf")
+	pdf := "%PDF-1.7\n1 0 obj\n<< /Type /Catalog /OpenAction 2 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /S /Launch /F (cmd.exe) >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n"
+	if err := os.WriteFile(testFile, []byte(pdf), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &MockPlatform{}
+	resp := HandleOpen(context.Background(), messaging.OpenRequest{FilePath: testFile}, mock, nil, policy.Policy{ActiveContent: policy.Block})
+	if resp.Error != "active_content_blocked" {
+		t.Fatalf("Expected error 'active_content_blocked', got '%s'", resp.Error)
+	}
+	if len(mock.OpenedFiles) != 0 {
+		t.Errorf("Expected nothing opened, got %v", mock.OpenedFiles)
+	}
+
+	codes := map[string]bool{}
+	for _, w := range messaging.ResultOf(resp).Warnings {
+		codes[w.Code] = true
+	}
+	if !codes["launch"] || !codes["open_action"] {
+		t.Errorf("Expected launch and open_action warnings, got %+v", messaging.ResultOf(resp).Warnings)
+	}
+}
+
+func TestHandleHello(t *testing.T) {
+	actions := []string{"getDefaults", "hello", "open"}
+
+	resp := HandleHello(&nativehost.Message{Action: "hello", ProtocolVersion: messaging.ProtocolVersion}, actions)
+	if !resp.Success {
+		t.Fatalf("Expected success, got error: %s", resp.Error)
+	}
+	if messaging.ResultOf(resp).Host == nil {
+		t.Fatal("Expected host info")
+	}
+	if messaging.ResultOf(resp).Host.ProtocolVersion != messaging.ProtocolVersion {
+		t.Errorf("ProtocolVersion = %d, want %d", messaging.ResultOf(resp).Host.ProtocolVersion, messaging.ProtocolVersion)
+	}
+	if messaging.ResultOf(resp).Host.Version == "" || messaging.ResultOf(resp).Host.Commit == "" || messaging.ResultOf(resp).Host.OS == "" {
+		t.Errorf("Expected version, commit and OS, got %+v", messaging.ResultOf(resp).Host)
+	}
+	if len(messaging.ResultOf(resp).Host.Actions) != len(actions) {
+		t.Errorf("Actions = %v, want %v", messaging.ResultOf(resp).Host.Actions, actions)
+	}
+	if len(messaging.ResultOf(resp).Host.FileTypes) == 0 || messaging.ResultOf(resp).Host.FileTypes[0] != "xlsx" {
+		t.Errorf("FileTypes = %v, want the registry's types", messaging.ResultOf(resp).Host.FileTypes)
+	}
+
+	// Extensions that predate the handshake send no version
+	resp = HandleHello(&nativehost.Message{Action: "hello"}, actions)
+	if !resp.Success {
+		t.Errorf("Expected success without a version, got error: %s", resp.Error)
+	}
+}
+
+func TestHandleHello_IncompatibleVersion(t *testing.T) {
+	resp := HandleHello(&nativehost.Message{Action: "hello", ProtocolVersion: messaging.ProtocolVersion + 1}, nil)
+	if resp.Success {
+		t.Fatal("Expected failure for a newer protocol version")
+	}
+	if resp.Error != "incompatible_version" {
+		t.Errorf("Expected error 'incompatible_version', got '%s'", resp.Error)
+	}
+	if messaging.ResultOf(resp).Host == nil || messaging.ResultOf(resp).Host.Version == "" {
+		t.Error("Expected host info with the error")
+	}
+}
+
+func TestCheckProtocolVersion(t *testing.T) {
+	if resp := CheckProtocolVersion(&nativehost.Message{Action: "open"}); resp != nil {
+		t.Errorf("Expected no error without a version, got %+v", resp)
+	}
+	if resp := CheckProtocolVersion(&nativehost.Message{Action: "open", ProtocolVersion: messaging.ProtocolVersion}); resp != nil {
+		t.Errorf("Expected no error for the current version, got %+v", resp)
+	}
+	resp := CheckProtocolVersion(&nativehost.Message{Action: "open", ProtocolVersion: 99})
+	if resp == nil || resp.Error != "incompatible_version" {
+		t.Errorf("Expected incompatible_version, got %+v", resp)
+	}
+}
+
+func TestHandleOpen_Canceled(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "open-with-Q4 Budget.xlsx")
+	writeTestFile(t, testFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mock := &MockPlatform{}
+	resp := HandleOpen(ctx, messaging.OpenRequest{FilePath: testFile}, mock, nil, policy.Default())
+	if resp.Error != "canceled" {
+		t.Errorf("Expected error 'canceled', got '%s'", resp.Error)
+	}
+	if len(mock.OpenedFiles) != 0 {
+		t.Errorf("Expected nothing opened, got %v", mock.OpenedFiles)
+	}
+}
+
+func TestHandleOpen_Progress(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "open-with-Q4 Budget.xlsx")
+	writeTestFile(t, testFile)
+
+	var stages []string
+	ctx := nativehost.WithProgress(context.Background(), func(p nativehost.Progress) {
+		stages = append(stages, p.Stage)
+	})
+
+	resp := HandleOpen(ctx, messaging.OpenRequest{FilePath: testFile}, &MockPlatform{}, nil, policy.Default())
+	if !resp.Success {
+		t.Fatalf("Expected success, got error: %s", resp.Error)
+	}
+	want := []string{"checking", "scanning", "opening"}
+	if strings.Join(stages, ",") != strings.Join(want, ",") {
+		t.Errorf("Progress stages = %v, want %v", stages, want)
+	}
+}
+
+func TestHandleWriteFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "files")
+	req := messaging.WriteFileRequest{
+		Title:    "Meeting notes: Q4",
+		FileType: "txt",
+		Data:     base64.StdEncoding.EncodeToString([]byte("Agenda\n")),
+	}
+
+	mock := &MockPlatform{}
+	resp := HandleWriteFile(context.Background(), req, dir, mock, nil, policy.Default())
+	if !resp.Success {
+		t.Fatalf("Expected success, got error: %s", resp.Error)
+	}
+	if filepath.Base(messaging.ResultOf(resp).FilePath) != "open-with-Meeting notes Q4.txt" {
+		t.Errorf("FilePath = %q", messaging.ResultOf(resp).FilePath)
+	}
+	if data, err := os.ReadFile(messaging.ResultOf(resp).FilePath); err != nil || string(data) != "Agenda\n" {
+		t.Errorf("File holds %q, %v", data, err)
+	}
+	if len(mock.OpenedFiles) != 0 {
+		t.Errorf("Expected nothing opened without open, got %v", mock.OpenedFiles)
+	}
+
+	// The same title again gets its own file, and open launches it
+	req.Open = true
+	resp = HandleWriteFile(context.Background(), req, dir, mock, nil, policy.Default())
+	if !resp.Success {
+		t.Fatalf("Expected success, got error: %s", resp.Error)
+	}
+	if filepath.Base(messaging.ResultOf(resp).FilePath) != "open-with-Meeting notes Q4 (2).txt" {
+		t.Errorf("FilePath = %q", messaging.ResultOf(resp).FilePath)
+	}
+	if len(mock.OpenedFiles) != 1 || mock.OpenedFiles[0] != messaging.ResultOf(resp).FilePath {
+		t.Errorf("Expected %s opened, got %v", messaging.ResultOf(resp).FilePath, mock.OpenedFiles)
+	}
+}
+
+func TestHandleWriteFile_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       messaging.WriteFileRequest
+		wantError string
+		wantField string
+	}{
+		{
+			name:      "unsupported type",
+			req:       messaging.WriteFileRequest{Title: "x", FileType: "exe", Data: "AA=="},
+			wantError: "invalid_request",
+			wantField: "fileType",
+		},
+		{
+			name:      "bad base64",
+			req:       messaging.WriteFileRequest{Title: "x", FileType: "txt", Data: "not base64!"},
+			wantError: "invalid_request",
+			wantField: "data",
+		},
+		{
+			name:      "app without open",
+			req:       messaging.WriteFileRequest{Title: "x", FileType: "txt", Data: "AA==", AppID: "gedit.desktop"},
+			wantError: "invalid_request",
+			wantField: "appId",
+		},
+		{
+			name:      "content doesn't match type",
+			req:       messaging.WriteFileRequest{Title: "x", FileType: "xlsx", Data: base64.StdEncoding.EncodeToString([]byte("<html>"))},
+			wantError: "content_mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			resp := HandleWriteFile(context.Background(), tt.req, dir, &MockPlatform{}, nil, policy.Default())
+			if resp.Success || resp.Error != tt.wantError || resp.Field != tt.wantField {
+				t.Errorf("Got %+v, want error %q on field %q", resp, tt.wantError, tt.wantField)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Expected no file left behind, found %d", len(entries))
+			}
+		})
+	}
+}
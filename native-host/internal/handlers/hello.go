@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+	"github.com/reclaim/openwith/internal/messaging"
+	"github.com/reclaim/openwith/internal/version"
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// HandleHello answers the extension's handshake with the host's protocol
+// range, build and capabilities. actions lists the actions the host
+// dispatches. The host info is sent even when the versions are
+// incompatible, so the extension can tell the user what to update.
+func HandleHello(msg *nativehost.Message, actions []string) nativehost.Response {
+	info := &messaging.HostInfo{
+		ProtocolVersion:    messaging.ProtocolVersion,
+		MinProtocolVersion: messaging.MinProtocolVersion,
+		Version:            version.Version,
+		Commit:             version.BuildCommit(),
+		OS:                 runtime.GOOS,
+		Actions:            actions,
+		FileTypes:          filetypes.Extensions(),
+	}
+
+	if resp := CheckProtocolVersion(msg); resp != nil {
+		resp.Result = messaging.Result{Host: info}
+		return *resp
+	}
+
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			Host: info,
+		},
+	}
+}
+
+// CheckProtocolVersion returns the error response for a message sent with
+// a protocol version the host doesn't speak, or nil if it's compatible
+func CheckProtocolVersion(msg *nativehost.Message) *nativehost.Response {
+	if messaging.CompatibleVersion(msg.ProtocolVersion) {
+		return nil
+	}
+	return &nativehost.Response{
+		Success: false,
+		Error:   "incompatible_version",
+		Message: fmt.Sprintf("Protocol version %d is not supported; this host speaks versions %d to %d",
+			msg.ProtocolVersion, messaging.MinProtocolVersion, messaging.ProtocolVersion),
+	}
+}
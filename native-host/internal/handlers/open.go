@@ -1,27 +1,24 @@
 package handlers
 
 import (
+	"context"
+	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
+	"github.com/reclaim/openwith/internal/filetypes"
 	"github.com/reclaim/openwith/internal/messaging"
 	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/internal/scan"
+	"github.com/reclaim/openwith/internal/sniff"
+	"github.com/reclaim/openwith/nativehost"
 )
 
-// allowedExtensions defines the file extensions we accept
-var allowedExtensions = map[string]bool{
-	".xlsx": true,
-	".docx": true,
-	".pptx": true,
-	".txt":  true,
-	".pdf":  true,
-}
-
-// filenamePattern matches our expected filename format: open-with-{title}.{ext}
-// Title can contain alphanumeric, spaces, hyphens, underscores, and common punctuation
-var filenamePattern = regexp.MustCompile(`^open-with-.+\.(xlsx|docx|pptx|txt|pdf)$`)
+// filenamePrefix starts every file we open: open-with-{title}.{ext}
+const filenamePrefix = "open-with-"
 
 // validateFilePath ensures the file path is safe to process
 // Returns an error message if validation fails, empty string if valid
@@ -69,27 +66,28 @@ func validateFilePath(filePath string) string {
 		}
 	}
 
-	// Validate filename matches our expected pattern
+	// Validate filename matches our expected format with a non-empty title
 	filename := filepath.Base(realPath)
-	if !filenamePattern.MatchString(filename) {
+	ext := filepath.Ext(filename)
+	title := strings.TrimSuffix(strings.TrimPrefix(filename, filenamePrefix), ext)
+	if !strings.HasPrefix(filename, filenamePrefix) || title == "" || ext == "" {
 		return "Invalid filename format"
 	}
 
-	// Validate extension is allowed
-	ext := strings.ToLower(filepath.Ext(filename))
-	if !allowedExtensions[ext] {
+	// Validate extension is one the registry accepts
+	if !filetypes.Supported(ext) {
 		return "Unsupported file type"
 	}
 
 	return ""
 }
 
-// HandleOpen opens a file with the default application directly from its current location.
-// The file remains in the Downloads folder where Chrome placed it.
-func HandleOpen(msg *messaging.Message, plat platform.Platform) messaging.Response {
+// checkFile validates a requested file before it is opened.
+// Returns the error response to send, or nil if the file can be opened.
+func checkFile(filePath string) *nativehost.Response {
 	// Validate file path for security
-	if errMsg := validateFilePath(msg.FilePath); errMsg != "" {
-		return messaging.Response{
+	if errMsg := validateFilePath(filePath); errMsg != "" {
+		return &nativehost.Response{
 			Success: false,
 			Error:   "file_not_found",
 			Message: errMsg,
@@ -97,25 +95,205 @@ func HandleOpen(msg *messaging.Message, plat platform.Platform) messaging.Respon
 	}
 
 	// Validate file exists
-	if _, err := os.Stat(msg.FilePath); os.IsNotExist(err) {
-		return messaging.Response{
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return &nativehost.Response{
 			Success: false,
 			Error:   "file_not_found",
 			Message: "The requested file could not be found",
 		}
 	}
 
+	// Reject files whose bytes aren't what the extension claims, such as
+	// an HTML login page saved as .xlsx
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), ".")
+	ft, _ := filetypes.Lookup(ext)
+	if err := sniff.Check(filePath, ft); err != nil {
+		log.Printf("Content check failed for %s: %v", filePath, err)
+		if sniff.IsMismatch(err) {
+			return &nativehost.Response{
+				Success: false,
+				Error:   "content_mismatch",
+				Message: "The file's contents don't match its ." + ext + " extension",
+				Result: messaging.Result{
+					FileType: ext,
+				},
+			}
+		}
+		return &nativehost.Response{
+			Success: false,
+			Error:   "file_not_found",
+			Message: "The requested file could not be read",
+		}
+	}
+
+	return nil
+}
+
+// checkActiveContent scans a file for macros and other active content.
+// It returns the warnings to include in the response, or the error
+// response to send if the policy blocks the file.
+func checkActiveContent(filePath string, pol policy.Policy) ([]messaging.Warning, *nativehost.Response) {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filePath)), ".")
+	ft, _ := filetypes.Lookup(ext)
+
+	findings, err := scan.File(filePath, ft)
+	if err != nil {
+		log.Printf("Active content scan failed for %s: %v", filePath, err)
+		if pol.ActiveContent == policy.Block {
+			return nil, &nativehost.Response{
+				Success: false,
+				Error:   "active_content_blocked",
+				Message: "The file could not be checked for macros, so it was not opened",
+				Result: messaging.Result{
+					FileType: ext,
+				},
+			}
+		}
+		return nil, nil
+	}
+	if len(findings) == 0 {
+		return nil, nil
+	}
+
+	warnings := make([]messaging.Warning, 0, len(findings))
+	message := "The file contains macros or other active content and was not opened"
+	for _, f := range findings {
+		log.Printf("Active content in %s: %s in %s %s", filePath, f.Kind, f.Part, f.Detail)
+		warnings = append(warnings, messaging.Warning{
+			Code:    string(f.Kind),
+			Part:    f.Part,
+			Message: f.Description(),
+		})
+		if f.Kind == scan.KindIncomplete {
+			message = "The file could not be fully checked for macros, so it was not opened"
+		}
+	}
+
+	if pol.ActiveContent == policy.Block {
+		return nil, &nativehost.Response{
+			Success: false,
+			Error:   "active_content_blocked",
+			Message: message,
+			Result: messaging.Result{
+				FileType: ext,
+				Warnings: warnings,
+			},
+		}
+	}
+	return warnings, nil
+}
+
+// prepareOpen runs the checks every open goes through, reporting each
+// stage as progress. It returns the warnings to include in the response,
+// or the error response to send if the file must not be opened.
+func prepareOpen(ctx context.Context, filePath string, pol policy.Policy) ([]messaging.Warning, *nativehost.Response) {
+	nativehost.ReportProgress(ctx, "checking")
+	if resp := checkFile(filePath); resp != nil {
+		return nil, resp
+	}
+	if ctx.Err() != nil {
+		resp := nativehost.Canceled()
+		return nil, &resp
+	}
+
+	nativehost.ReportProgress(ctx, "scanning")
+	warnings, resp := checkActiveContent(filePath, pol)
+	if resp != nil {
+		return nil, resp
+	}
+	if ctx.Err() != nil {
+		resp := nativehost.Canceled()
+		return nil, &resp
+	}
+
+	nativehost.ReportProgress(ctx, "opening")
+	return warnings, nil
+}
+
+// HandleOpen opens a file with the preferred application for its type, or the
+// default application if none is set, directly from its current location.
+// The file remains in the Downloads folder where Chrome placed it.
+// Active content found in the file is reported or blocked according to pol.
+// Nothing is launched once ctx is canceled.
+func HandleOpen(ctx context.Context, req messaging.OpenRequest, plat platform.Platform, store *prefs.Store, pol policy.Policy) nativehost.Response {
+	warnings, resp := prepareOpen(ctx, req.FilePath, pol)
+	if resp != nil {
+		return *resp
+	}
+
+	// A preferred app that fails to start falls back to the default
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(req.FilePath)), ".")
+	if app, ok := preferredApp(plat, store, ext); ok {
+		err := plat.OpenWith(req.FilePath, app.Path)
+		if err == nil {
+			return nativehost.Response{
+				Success: true,
+				Result: messaging.Result{
+					Warnings: warnings,
+				},
+			}
+		}
+		log.Printf("Error opening with preferred app %s: %v", app.BundleID, err)
+	}
+
 	// Open with default application directly from Downloads
-	if err := plat.OpenWithDefault(msg.FilePath); err != nil {
-		return messaging.Response{
-			Success:  false,
-			Error:    "no_default_app",
-			FileType: msg.FileType,
-			Message:  "No application is configured to open this file type",
+	if err := plat.OpenWithDefault(req.FilePath); err != nil {
+		return nativehost.Response{
+			Success: false,
+			Error:   "no_default_app",
+			Message: "No application is configured to open this file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			Warnings: warnings,
+		},
+	}
+}
+
+// HandleOpenWith opens a file with an application chosen by the user.
+// The app is named by its ID and must be one the platform lists for the
+// file's type, so the extension can't make us launch arbitrary programs.
+func HandleOpenWith(ctx context.Context, req messaging.OpenWithRequest, plat platform.Platform, pol policy.Policy) nativehost.Response {
+	warnings, resp := prepareOpen(ctx, req.FilePath, pol)
+	if resp != nil {
+		return *resp
+	}
+
+	// The file name has already been validated, so its extension is supported
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(req.FilePath)), ".")
+	app, ok := resolveApp(plat, ext, req.AppID)
+	if !ok {
+		return nativehost.Response{
+			Success: false,
+			Error:   "app_not_found",
+			Message: "The selected application cannot open this file type",
+			Result: messaging.Result{
+				FileType: ext,
+			},
+		}
+	}
+
+	if err := plat.OpenWith(req.FilePath, app.Path); err != nil {
+		return nativehost.Response{
+			Success: false,
+			Error:   "open_failed",
+			Message: "The selected application could not be started",
+			Result: messaging.Result{
+				FileType: ext,
+			},
 		}
 	}
 
-	return messaging.Response{
+	return nativehost.Response{
 		Success: true,
+		Result: messaging.Result{
+			Warnings: warnings,
+		},
 	}
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+	"github.com/reclaim/openwith/internal/messaging"
+	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// HandleSetPreferredApp makes the chosen app the one we open a file type
+// with, without touching the OS-wide default
+func HandleSetPreferredApp(req messaging.SetPreferredAppRequest, plat platform.Platform, store *prefs.Store) nativehost.Response {
+	if !filetypes.Supported(req.FileType) {
+		return nativehost.Response{
+			Success: false,
+			Error:   "unsupported_type",
+			Message: "Unsupported file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	app, ok := resolveApp(plat, req.FileType, req.AppID)
+	if !ok {
+		return nativehost.Response{
+			Success: false,
+			Error:   "app_not_found",
+			Message: "The selected application cannot open this file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	if err := store.Set(req.FileType, prefs.Preference{AppID: app.BundleID, Name: app.Name}); err != nil {
+		log.Printf("Error saving preference for %s: %v", req.FileType, err)
+		return nativehost.Response{
+			Success: false,
+			Error:   "unknown",
+			Message: "Could not save the preferred application",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			FileType: req.FileType,
+		},
+	}
+}
+
+// HandleClearPreferredApp goes back to opening a file type with the system default
+func HandleClearPreferredApp(req messaging.ClearPreferredAppRequest, store *prefs.Store) nativehost.Response {
+	if !filetypes.Supported(req.FileType) {
+		return nativehost.Response{
+			Success: false,
+			Error:   "unsupported_type",
+			Message: "Unsupported file type",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	if err := store.Clear(req.FileType); err != nil {
+		log.Printf("Error clearing preference for %s: %v", req.FileType, err)
+		return nativehost.Response{
+			Success: false,
+			Error:   "unknown",
+			Message: "Could not clear the preferred application",
+			Result: messaging.Result{
+				FileType: req.FileType,
+			},
+		}
+	}
+
+	return nativehost.Response{
+		Success: true,
+		Result: messaging.Result{
+			FileType: req.FileType,
+		},
+	}
+}
+
+// preferredApp returns the preferred app for a file type if one is set and
+// still registered for it
+func preferredApp(plat platform.Platform, store *prefs.Store, ext string) (platform.AppInfo, bool) {
+	pref, ok := store.Get(ext)
+	if !ok {
+		return platform.AppInfo{}, false
+	}
+	return resolveApp(plat, ext, pref.AppID)
+}
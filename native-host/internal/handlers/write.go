@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/reclaim/openwith/internal/files"
+	"github.com/reclaim/openwith/internal/filetypes"
+	"github.com/reclaim/openwith/internal/messaging"
+	"github.com/reclaim/openwith/internal/platform"
+	"github.com/reclaim/openwith/internal/policy"
+	"github.com/reclaim/openwith/internal/prefs"
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// HandleWriteFile saves a document the extension generated into dir, the
+// host's own files directory, and optionally opens it the way open or
+// openWith would. The response carries the saved path, even when opening
+// fails, so the extension can point the user at the file.
+func HandleWriteFile(ctx context.Context, req messaging.WriteFileRequest, dir string, plat platform.Platform, store *prefs.Store, pol policy.Policy) nativehost.Response {
+	ext := strings.TrimPrefix(strings.ToLower(req.FileType), ".")
+	if !filetypes.Supported(ext) {
+		return nativehost.InvalidRequest(&nativehost.FieldError{Field: "fileType", Reason: "is not a supported file type"})
+	}
+	if req.AppID != "" && !req.Open {
+		return nativehost.InvalidRequest(&nativehost.FieldError{Field: "appId", Reason: "is only used with open"})
+	}
+	data, err := base64.StdEncoding.DecodeString(req.Data)
+	if err != nil {
+		return nativehost.InvalidRequest(&nativehost.FieldError{Field: "data", Reason: "must be base64"})
+	}
+
+	if dir == "" {
+		return nativehost.Response{
+			Success: false,
+			Error:   "write_failed",
+			Message: "The host has no directory to save files in",
+		}
+	}
+	if ctx.Err() != nil {
+		return nativehost.Canceled()
+	}
+
+	nativehost.ReportProgress(ctx, "writing")
+	path, err := files.Write(dir, req.Title, ext, data)
+	if err != nil {
+		log.Printf("Error writing %s file: %v", ext, err)
+		return nativehost.Response{
+			Success: false,
+			Error:   "write_failed",
+			Message: "The file could not be saved",
+			Result: messaging.Result{
+				FileType: ext,
+			},
+		}
+	}
+	log.Printf("Wrote %d bytes to %s", len(data), path)
+
+	// Don't leave behind content that isn't what its name says
+	if resp := checkFile(path); resp != nil {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Error removing rejected file %s: %v", path, err)
+		}
+		return *resp
+	}
+
+	var resp nativehost.Response
+	switch {
+	case !req.Open:
+		resp = nativehost.Response{Success: true}
+	case req.AppID != "":
+		resp = HandleOpenWith(ctx, messaging.OpenWithRequest{FilePath: path, FileType: ext, AppID: req.AppID}, plat, pol)
+	default:
+		resp = HandleOpen(ctx, messaging.OpenRequest{FilePath: path, FileType: ext}, plat, store, pol)
+	}
+	result := messaging.ResultOf(resp)
+	result.FilePath = path
+	resp.Result = result
+	return resp
+}
@@ -0,0 +1,192 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Browser is a browser the host can be installed for
+type Browser struct {
+	ID   string // Used with install --browser, e.g. "chrome"
+	Name string
+
+	// Firefox browsers read the Firefox manifest variant, which lists
+	// add-on IDs in allowed_extensions instead of allowed_origins
+	Firefox bool
+
+	// userDirs are relative to the home directory and systemDirs absolute,
+	// by GOOS. A browser without an entry isn't supported there.
+	userDirs   map[string]string
+	systemDirs map[string]string
+	// profileDirs, relative to home, exist once the browser has been
+	// used. Without an entry it's the parent of the user directory.
+	profileDirs map[string]string
+}
+
+// Browsers are the browsers the host knows, in the order they're reported
+var Browsers = []Browser{
+	{
+		ID:   "chrome",
+		Name: "Google Chrome",
+		userDirs: map[string]string{
+			"linux":  ".config/google-chrome/NativeMessagingHosts",
+			"darwin": "Library/Application Support/Google/Chrome/NativeMessagingHosts",
+		},
+		systemDirs: map[string]string{
+			"linux":  "/etc/opt/chrome/native-messaging-hosts",
+			"darwin": "/Library/Google/Chrome/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:   "chrome-beta",
+		Name: "Google Chrome Beta",
+		userDirs: map[string]string{
+			"linux":  ".config/google-chrome-beta/NativeMessagingHosts",
+			"darwin": "Library/Application Support/Google/Chrome Beta/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:   "chrome-canary",
+		Name: "Google Chrome Canary",
+		userDirs: map[string]string{
+			"darwin": "Library/Application Support/Google/Chrome Canary/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:   "chromium",
+		Name: "Chromium",
+		userDirs: map[string]string{
+			"linux":  ".config/chromium/NativeMessagingHosts",
+			"darwin": "Library/Application Support/Chromium/NativeMessagingHosts",
+		},
+		systemDirs: map[string]string{
+			"linux":  "/etc/chromium/native-messaging-hosts",
+			"darwin": "/Library/Application Support/Chromium/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:   "brave",
+		Name: "Brave",
+		userDirs: map[string]string{
+			"linux":  ".config/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+			"darwin": "Library/Application Support/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		},
+		systemDirs: map[string]string{
+			// Brave reads Chrome's system-wide directory on Linux
+			"linux":  "/etc/opt/chrome/native-messaging-hosts",
+			"darwin": "/Library/Application Support/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:   "edge",
+		Name: "Microsoft Edge",
+		userDirs: map[string]string{
+			"linux":  ".config/microsoft-edge/NativeMessagingHosts",
+			"darwin": "Library/Application Support/Microsoft Edge/NativeMessagingHosts",
+		},
+		systemDirs: map[string]string{
+			"linux":  "/etc/opt/edge/native-messaging-hosts",
+			"darwin": "/Library/Microsoft/Edge/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:   "vivaldi",
+		Name: "Vivaldi",
+		userDirs: map[string]string{
+			"linux":  ".config/vivaldi/NativeMessagingHosts",
+			"darwin": "Library/Application Support/Vivaldi/NativeMessagingHosts",
+		},
+		systemDirs: map[string]string{
+			"linux":  "/etc/opt/vivaldi/native-messaging-hosts",
+			"darwin": "/Library/Application Support/Vivaldi/NativeMessagingHosts",
+		},
+	},
+	{
+		ID:      "firefox",
+		Name:    "Firefox",
+		Firefox: true,
+		userDirs: map[string]string{
+			"linux":  ".mozilla/native-messaging-hosts",
+			"darwin": "Library/Application Support/Mozilla/NativeMessagingHosts",
+		},
+		systemDirs: map[string]string{
+			"linux":  "/usr/lib/mozilla/native-messaging-hosts",
+			"darwin": "/Library/Application Support/Mozilla/NativeMessagingHosts",
+		},
+		profileDirs: map[string]string{
+			"linux":  ".mozilla/firefox",
+			"darwin": "Library/Application Support/Firefox",
+		},
+	},
+	{
+		ID:   "arc",
+		Name: "Arc",
+		userDirs: map[string]string{
+			"darwin": "Library/Application Support/Arc/User Data/NativeMessagingHosts",
+		},
+	},
+}
+
+// systemRoot is prefixed to the system-wide directories, so tests can use
+// a temp dir
+var systemRoot = ""
+
+// LookupBrowser returns the browser with the given ID
+func LookupBrowser(id string) (Browser, bool) {
+	for _, b := range Browsers {
+		if b.ID == strings.ToLower(id) {
+			return b, true
+		}
+	}
+	return Browser{}, false
+}
+
+// BrowserIDs lists the IDs of the browsers supported on goos
+func BrowserIDs(goos string) []string {
+	var ids []string
+	for _, b := range Browsers {
+		if b.Supports(goos) {
+			ids = append(ids, b.ID)
+		}
+	}
+	return ids
+}
+
+// Supports reports whether the host can be installed for b on goos
+func (b Browser) Supports(goos string) bool {
+	return b.userDirs[goos] != ""
+}
+
+// Dir returns the directory b reads host manifests from on goos, for the
+// user with the given home directory or, if system is set, for every
+// user. It returns "" if there is no such directory.
+func (b Browser) Dir(goos, home string, system bool) string {
+	if system {
+		dir := b.systemDirs[goos]
+		if dir == "" {
+			return ""
+		}
+		return filepath.Join(systemRoot, filepath.FromSlash(dir))
+	}
+	dir := b.userDirs[goos]
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(home, filepath.FromSlash(dir))
+}
+
+// Installed reports whether b has a profile under home on goos, which is
+// taken to mean the user has it installed
+func (b Browser) Installed(goos, home string) bool {
+	dir := b.profileDirs[goos]
+	if dir != "" {
+		dir = filepath.Join(home, filepath.FromSlash(dir))
+	} else if dir = b.Dir(goos, home, false); dir != "" {
+		dir = filepath.Dir(dir)
+	} else {
+		return false
+	}
+	_, err := os.Stat(dir)
+	return err == nil
+}
@@ -0,0 +1,296 @@
+// Package manifest installs the native messaging host manifest that tells
+// a browser where the host binary is and which extensions may start it.
+// It knows where each supported browser looks for manifests, per user and
+// system-wide, on Linux and macOS.
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/reclaim/openwith/internal/atomicfile"
+	"github.com/reclaim/openwith/internal/caller"
+)
+
+// HostName is the name the extension connects to
+const HostName = "com.reclaim.openwith"
+
+// FileName is the manifest's name in every browser directory
+const FileName = HostName + ".json"
+
+// Manifest is a native messaging host manifest
+type Manifest struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Path           string   `json:"path"`
+	Type           string   `json:"type"`
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// AllowedExtensions replaces AllowedOrigins in Firefox's variant
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+}
+
+// Parse decodes a manifest
+func Parse(data []byte) (Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Read reads the manifest at path
+func Read(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return Parse(data)
+}
+
+// Render fills in the template's binary path and the extensions allowed
+// to start the host, given by their origins. Chrome extensions go in
+// allowed_origins and Firefox add-ons in allowed_extensions; For picks the
+// list each browser reads.
+func Render(template []byte, hostPath string, origins []string) (Manifest, error) {
+	m, err := Parse(template)
+	if err != nil {
+		return Manifest{}, err
+	}
+	m.Path = hostPath
+	m.AllowedOrigins, m.AllowedExtensions = nil, nil
+	for _, origin := range origins {
+		c, err := caller.FromOrigin(origin)
+		if err != nil {
+			return Manifest{}, err
+		}
+		if c.Browser == caller.Firefox {
+			m.AllowedExtensions = append(m.AllowedExtensions, c.ExtensionID)
+		} else {
+			m.AllowedOrigins = append(m.AllowedOrigins, c.Origin)
+		}
+	}
+	return m, nil
+}
+
+// For returns the variant of m that b reads
+func (m Manifest) For(b Browser) Manifest {
+	if b.Firefox {
+		m.AllowedOrigins = nil
+	} else {
+		m.AllowedExtensions = nil
+	}
+	return m
+}
+
+// Origins returns the origins of the extensions m allows, in either list
+func (m Manifest) Origins() []string {
+	origins := append([]string(nil), m.AllowedOrigins...)
+	for _, id := range m.AllowedExtensions {
+		origins = append(origins, caller.FirefoxOrigin(id))
+	}
+	return origins
+}
+
+// allowsAny reports whether b's variant of m lets any extension start
+// the host
+func (m Manifest) allowsAny(b Browser) bool {
+	v := m.For(b)
+	return len(v.AllowedOrigins) > 0 || len(v.AllowedExtensions) > 0
+}
+
+// Options says what to install and where
+type Options struct {
+	GOOS   string
+	Home   string // Per-user installs go under this home directory
+	System bool   // Install for every user instead
+
+	// Browsers are browser IDs. When empty, every supported browser is
+	// installed for system-wide, and per user every one that has a profile
+	// directory, skipping those the manifest allows no extension for.
+	Browsers []string
+}
+
+// Installed is a manifest install wrote
+type Installed struct {
+	Browser Browser
+	Path    string
+}
+
+// Install writes m into the manifest directory of each browser opts
+// selects, and returns what it wrote. On error, the manifests written
+// before it are still returned.
+func Install(m Manifest, opts Options) ([]Installed, error) {
+	if m.Path == "" || !filepath.IsAbs(m.Path) {
+		return nil, fmt.Errorf("the host path must be absolute, got %q", m.Path)
+	}
+	browsers, err := selectBrowsers(m, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var written []Installed
+	for _, b := range browsers {
+		data, err := json.MarshalIndent(m.For(b), "", "  ")
+		if err != nil {
+			return written, fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		data = append(data, '\n')
+
+		path := filepath.Join(b.Dir(opts.GOOS, opts.Home, opts.System), FileName)
+		if err := writeFile(path, data); err != nil {
+			return written, fmt.Errorf("failed to install for %s: %w", b.Name, err)
+		}
+		written = append(written, Installed{Browser: b, Path: path})
+	}
+	return written, nil
+}
+
+// selectBrowsers returns the browsers opts asks for, checking that each
+// has a manifest directory on opts.GOOS and an extension m allows
+func selectBrowsers(m Manifest, opts Options) ([]Browser, error) {
+	if len(opts.Browsers) > 0 {
+		var browsers []Browser
+		for _, id := range opts.Browsers {
+			b, ok := LookupBrowser(id)
+			if !ok {
+				return nil, fmt.Errorf("unknown browser %q", id)
+			}
+			if b.Dir(opts.GOOS, opts.Home, opts.System) == "" {
+				return nil, fmt.Errorf("%s isn't supported here%s", b.Name, systemSuffix(opts.System))
+			}
+			if !m.allowsAny(b) {
+				return nil, fmt.Errorf("no extension ID given for %s", b.Name)
+			}
+			browsers = append(browsers, b)
+		}
+		return browsers, nil
+	}
+
+	var browsers []Browser
+	for _, b := range Browsers {
+		dir := b.Dir(opts.GOOS, opts.Home, opts.System)
+		if dir == "" || !m.allowsAny(b) {
+			continue
+		}
+		if !opts.System && !b.Installed(opts.GOOS, opts.Home) {
+			continue
+		}
+		browsers = append(browsers, b)
+	}
+	if len(browsers) == 0 {
+		if opts.System {
+			return nil, errors.New("no supported browsers on this platform")
+		}
+		return nil, errors.New("no supported browsers found; name one to install for it anyway")
+	}
+	return browsers, nil
+}
+
+func systemSuffix(system bool) string {
+	if system {
+		return " system-wide"
+	}
+	return ""
+}
+
+// writeFile writes a manifest atomically, readable by the browser whoever
+// runs it
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data, 0644)
+}
+
+// Found is a manifest in one of the browser directories
+type Found struct {
+	Browser  Browser
+	Path     string
+	System   bool
+	Manifest Manifest
+	Err      error // Why the manifest couldn't be read, if it couldn't
+}
+
+// Find returns the manifests in every browser directory on goos, both
+// per user under home and system-wide. A directory shared by several
+// browsers is reported once.
+func Find(goos, home string) []Found {
+	var found []Found
+	seen := make(map[string]bool)
+	for _, system := range []bool{false, true} {
+		for _, b := range Browsers {
+			dir := b.Dir(goos, home, system)
+			if dir == "" {
+				continue
+			}
+			path := filepath.Join(dir, FileName)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			m, err := Read(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			found = append(found, Found{Browser: b, Path: path, System: system, Manifest: m, Err: err})
+		}
+	}
+	return found
+}
+
+// PointsAt reports whether the manifest's path is hostPath, following
+// symlinks where they still resolve
+func (f Found) PointsAt(hostPath string) bool {
+	if f.Err != nil || f.Manifest.Path == "" {
+		return false
+	}
+	return resolve(f.Manifest.Path) == resolve(hostPath)
+}
+
+// InstalledOrigins returns the origins allowed by the manifests Find
+// returns that point at hostPath
+func InstalledOrigins(goos, home, hostPath string) []string {
+	var origins []string
+	for _, f := range Find(goos, home) {
+		if f.PointsAt(hostPath) {
+			origins = append(origins, f.Manifest.Origins()...)
+		}
+	}
+	return origins
+}
+
+func resolve(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// Uninstall removes the manifests Find returns that point at hostPath and
+// leaves the rest, which belong to another copy of the host. With dryRun
+// it only reports what it would remove. It returns the manifests removed
+// and kept; on error, it carries on with the others and returns the
+// first.
+func Uninstall(goos, home, hostPath string, dryRun bool) (removed, kept []Found, err error) {
+	for _, f := range Find(goos, home) {
+		if !f.PointsAt(hostPath) {
+			kept = append(kept, f)
+			continue
+		}
+		if !dryRun {
+			if rmErr := os.Remove(f.Path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+				if err == nil {
+					err = fmt.Errorf("failed to remove %s: %w", f.Path, rmErr)
+				}
+				kept = append(kept, f)
+				continue
+			}
+		}
+		removed = append(removed, f)
+	}
+	return removed, kept, err
+}
@@ -0,0 +1,277 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	openwith "github.com/reclaim/openwith"
+)
+
+const origin = "chrome-extension://abcdefghijklmnopabcdefghijklmnop/"
+
+func render(t *testing.T) Manifest {
+	t.Helper()
+	m, err := Render(openwith.ManifestTemplate, "/opt/reclaim/reclaim-openwith", []string{origin})
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	return m
+}
+
+func TestRender(t *testing.T) {
+	m := render(t)
+	want := Manifest{
+		Name:           HostName,
+		Description:    "Reclaim: Open With native helper",
+		Path:           "/opt/reclaim/reclaim-openwith",
+		Type:           "stdio",
+		AllowedOrigins: []string{origin},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Render() = %+v, want %+v", m, want)
+	}
+}
+
+func TestBrowserDirs(t *testing.T) {
+	home := "/home/alice"
+	tests := []struct {
+		browser string
+		goos    string
+		system  bool
+		want    string
+	}{
+		{"chrome", "linux", false, "/home/alice/.config/google-chrome/NativeMessagingHosts"},
+		{"chrome", "linux", true, "/etc/opt/chrome/native-messaging-hosts"},
+		{"chromium", "linux", false, "/home/alice/.config/chromium/NativeMessagingHosts"},
+		{"chromium", "linux", true, "/etc/chromium/native-messaging-hosts"},
+		{"brave", "linux", false, "/home/alice/.config/BraveSoftware/Brave-Browser/NativeMessagingHosts"},
+		{"edge", "linux", false, "/home/alice/.config/microsoft-edge/NativeMessagingHosts"},
+		{"edge", "linux", true, "/etc/opt/edge/native-messaging-hosts"},
+		{"vivaldi", "linux", false, "/home/alice/.config/vivaldi/NativeMessagingHosts"},
+		{"chrome", "darwin", false, "/home/alice/Library/Application Support/Google/Chrome/NativeMessagingHosts"},
+		{"chrome", "darwin", true, "/Library/Google/Chrome/NativeMessagingHosts"},
+		{"edge", "darwin", true, "/Library/Microsoft/Edge/NativeMessagingHosts"},
+		{"arc", "darwin", false, "/home/alice/Library/Application Support/Arc/User Data/NativeMessagingHosts"},
+		{"firefox", "linux", false, "/home/alice/.mozilla/native-messaging-hosts"},
+		{"firefox", "linux", true, "/usr/lib/mozilla/native-messaging-hosts"},
+		{"firefox", "darwin", false, "/home/alice/Library/Application Support/Mozilla/NativeMessagingHosts"},
+		{"firefox", "darwin", true, "/Library/Application Support/Mozilla/NativeMessagingHosts"},
+		{"arc", "linux", false, ""},
+		{"arc", "darwin", true, ""},
+		{"chrome", "windows", false, ""},
+	}
+
+	for _, tt := range tests {
+		b, ok := LookupBrowser(tt.browser)
+		if !ok {
+			t.Fatalf("LookupBrowser(%q) found nothing", tt.browser)
+		}
+		if got := b.Dir(tt.goos, home, tt.system); got != filepath.FromSlash(tt.want) {
+			t.Errorf("%s on %s (system %v) = %q, want %q", tt.browser, tt.goos, tt.system, got, tt.want)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	home := t.TempDir()
+	m := render(t)
+
+	// Without --browser, only browsers with a profile get a manifest
+	if _, err := Install(m, Options{GOOS: "linux", Home: home}); err == nil {
+		t.Error("Expected an error with no browsers installed")
+	}
+	os.MkdirAll(filepath.Join(home, ".config", "chromium"), 0700)
+	os.MkdirAll(filepath.Join(home, ".config", "BraveSoftware", "Brave-Browser"), 0700)
+
+	written, err := Install(m, Options{GOOS: "linux", Home: home})
+	if err != nil {
+		t.Fatalf("Install() error: %v", err)
+	}
+	var got []string
+	for _, w := range written {
+		got = append(got, w.Browser.ID+" "+w.Path)
+	}
+	want := []string{
+		"chromium " + filepath.Join(home, ".config/chromium/NativeMessagingHosts", FileName),
+		"brave " + filepath.Join(home, ".config/BraveSoftware/Brave-Browser/NativeMessagingHosts", FileName),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Install() wrote %v, want %v", got, want)
+	}
+
+	read, err := Read(written[0].Path)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("Read() = %+v, want %+v", read, m)
+	}
+	info, _ := os.Stat(written[0].Path)
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected file mode 0644, got %o", info.Mode().Perm())
+	}
+
+	// Naming a browser installs for it even without a profile
+	written, err = Install(m, Options{GOOS: "darwin", Home: home, Browsers: []string{"Vivaldi"}})
+	if err != nil || len(written) != 1 {
+		t.Fatalf("Install(vivaldi) = %v, %v", written, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "Library/Application Support/Vivaldi/NativeMessagingHosts", FileName)); err != nil {
+		t.Errorf("Vivaldi manifest missing: %v", err)
+	}
+}
+
+func TestInstall_Errors(t *testing.T) {
+	home := t.TempDir()
+	m := render(t)
+
+	tests := []struct {
+		name string
+		m    Manifest
+		opts Options
+	}{
+		{"unknown browser", m, Options{GOOS: "linux", Home: home, Browsers: []string{"netscape"}}},
+		{"unsupported here", m, Options{GOOS: "linux", Home: home, Browsers: []string{"arc"}}},
+		{"no system dir", m, Options{GOOS: "darwin", System: true, Browsers: []string{"arc"}}},
+		{"unsupported platform", m, Options{GOOS: "windows", System: true}},
+		{"relative path", Manifest{Path: "reclaim-openwith"}, Options{GOOS: "linux", Home: home, Browsers: []string{"chrome"}}},
+	}
+	for _, tt := range tests {
+		if written, err := Install(tt.m, tt.opts); err == nil {
+			t.Errorf("%s: expected an error, wrote %v", tt.name, written)
+		}
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	home := t.TempDir()
+	systemRoot = t.TempDir()
+	defer func() { systemRoot = "" }()
+	host := filepath.Join(t.TempDir(), "reclaim-openwith")
+	os.WriteFile(host, nil, 0755)
+
+	// Manifests for this binary, reached through a symlink in one case,
+	// and for another copy of the host
+	m := render(t)
+	m.Path = host
+	Install(m, Options{GOOS: "linux", Home: home, Browsers: []string{"chrome"}})
+	link := filepath.Join(t.TempDir(), "link")
+	os.Symlink(host, link)
+	m.Path = link
+	Install(m, Options{GOOS: "linux", Home: home, Browsers: []string{"brave"}})
+	m.Path = "/opt/other/reclaim-openwith"
+	Install(m, Options{GOOS: "linux", Home: home, Browsers: []string{"edge"}})
+	// System-wide too; Chrome and Brave share this directory
+	m.Path = host
+	Install(m, Options{GOOS: "linux", System: true, Browsers: []string{"chrome"}})
+	// And one that isn't a manifest at all
+	broken := filepath.Join(home, ".config/vivaldi/NativeMessagingHosts", FileName)
+	os.MkdirAll(filepath.Dir(broken), 0755)
+	os.WriteFile(broken, []byte("{oops"), 0644)
+
+	ids := func(found []Found) []string {
+		var ids []string
+		for _, f := range found {
+			ids = append(ids, f.Browser.ID)
+		}
+		return ids
+	}
+
+	removed, kept, err := Uninstall("linux", home, host, true)
+	if err != nil {
+		t.Fatalf("Uninstall(dry run) error: %v", err)
+	}
+	if got := ids(removed); !reflect.DeepEqual(got, []string{"chrome", "brave", "chrome"}) {
+		t.Errorf("Dry run would remove %v", got)
+	}
+	if got := ids(kept); !reflect.DeepEqual(got, []string{"edge", "vivaldi"}) {
+		t.Errorf("Dry run would keep %v", got)
+	}
+	if !removed[2].System {
+		t.Error("Expected the last manifest to be the system-wide one")
+	}
+	if _, err := os.Stat(removed[0].Path); err != nil {
+		t.Error("Dry run removed a manifest")
+	}
+
+	removed, _, err = Uninstall("linux", home, host, false)
+	if err != nil || len(removed) != 3 {
+		t.Fatalf("Uninstall() = %v, %v", ids(removed), err)
+	}
+	for _, f := range removed {
+		if _, err := os.Stat(f.Path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", f.Path)
+		}
+	}
+	if found := Find("linux", home); len(found) != 2 {
+		t.Errorf("Expected the other two manifests to remain, found %v", ids(found))
+	}
+}
+
+func TestInstalledOrigins(t *testing.T) {
+	home := t.TempDir()
+	host := filepath.Join(t.TempDir(), "reclaim-openwith")
+	os.WriteFile(host, nil, 0755)
+
+	m := render(t)
+	m.Path = host
+	m.AllowedExtensions = []string{"openwith@reclaim.app"}
+	Install(m, Options{GOOS: "linux", Home: home, Browsers: []string{"chrome", "firefox"}})
+	// Another copy of the host's extensions aren't this one's
+	other := m
+	other.Path = "/opt/other/reclaim-openwith"
+	other.AllowedOrigins = []string{"chrome-extension://otherotherotherotherotherotherot/"}
+	Install(other, Options{GOOS: "linux", Home: home, Browsers: []string{"edge"}})
+
+	got := InstalledOrigins("linux", home, host)
+	want := []string{origin, "firefox-extension://openwith@reclaim.app/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InstalledOrigins() = %v, want %v", got, want)
+	}
+}
+
+func TestInstall_Firefox(t *testing.T) {
+	home := t.TempDir()
+	m, err := Render(openwith.ManifestTemplate, "/opt/reclaim/reclaim-openwith",
+		[]string{origin, "firefox-extension://openwith@reclaim.app/"})
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+
+	// Firefox is found by its profile directory, not the manifest one
+	os.MkdirAll(filepath.Join(home, ".mozilla", "firefox"), 0700)
+	os.MkdirAll(filepath.Join(home, ".config", "chromium"), 0700)
+	written, err := Install(m, Options{GOOS: "linux", Home: home})
+	if err != nil || len(written) != 2 {
+		t.Fatalf("Install() = %v, %v", written, err)
+	}
+
+	chromium, _ := Read(written[0].Path)
+	if !reflect.DeepEqual(chromium.AllowedOrigins, []string{origin}) || chromium.AllowedExtensions != nil {
+		t.Errorf("Chromium manifest = %+v", chromium)
+	}
+	firefox, _ := Read(written[1].Path)
+	if written[1].Path != filepath.Join(home, ".mozilla/native-messaging-hosts", FileName) {
+		t.Errorf("Firefox manifest written to %s", written[1].Path)
+	}
+	if !reflect.DeepEqual(firefox.AllowedExtensions, []string{"openwith@reclaim.app"}) || firefox.AllowedOrigins != nil {
+		t.Errorf("Firefox manifest = %+v", firefox)
+	}
+	data, _ := os.ReadFile(written[1].Path)
+	if strings.Contains(string(data), "allowed_origins") {
+		t.Errorf("Firefox manifest has allowed_origins:\n%s", data)
+	}
+
+	// Browsers no given extension can use are skipped, or refused by name
+	chromeOnly := render(t)
+	written, err = Install(chromeOnly, Options{GOOS: "linux", Home: home})
+	if err != nil || len(written) != 1 || written[0].Browser.ID != "chromium" {
+		t.Errorf("Install(Chrome IDs only) = %v, %v", written, err)
+	}
+	if _, err := Install(chromeOnly, Options{GOOS: "linux", Home: home, Browsers: []string{"firefox"}}); err == nil {
+		t.Error("Expected an error installing for Firefox without an add-on ID")
+	}
+}
@@ -1,81 +1,89 @@
+// Package messaging defines the Reclaim host's side of the protocol with
+// the extension: its version, the payload of each action and the fields
+// its responses carry. The framing, envelope and streaming are nativehost's.
 package messaging
 
 import (
-	"encoding/binary"
 	"encoding/json"
-	"fmt"
-	"io"
+
+	"github.com/reclaim/openwith/nativehost"
 )
 
 const (
-	// MaxMessageSize is the maximum allowed message size (1MB)
-	MaxMessageSize = 1024 * 1024
+	// ProtocolVersion is the newest protocol version the host speaks.
+	// Bump it when a change would break an extension written for the
+	// previous version.
+	ProtocolVersion = 1
+	// MinProtocolVersion is the oldest protocol version the host accepts
+	MinProtocolVersion = 1
 )
 
-// Message represents a native messaging protocol message from the extension
-type Message struct {
-	Action   string                 `json:"action"`
-	FilePath string                 `json:"filePath,omitempty"`
-	FileType string                 `json:"fileType,omitempty"`
-	Data     map[string]interface{} `json:"data,omitempty"`
-}
-
-// Response represents a response to send back to the extension
-type Response struct {
-	Success  bool                   `json:"success"`
-	Error    string                 `json:"error,omitempty"`
-	FileType string                 `json:"fileType,omitempty"`
-	Message  string                 `json:"message,omitempty"`
-	Defaults map[string]interface{} `json:"defaults,omitempty"`
+// Result is the part of a response specific to this host's actions. It's
+// a nativehost.Response's Result, so its fields are sent next to the
+// envelope's.
+type Result struct {
+	FileType string                `json:"fileType,omitempty"`
+	FilePath string                `json:"filePath,omitempty"` // Where writeFile saved the file
+	Defaults map[string]DefaultApp `json:"defaults,omitempty"`
+	Apps     []App                 `json:"apps,omitempty"`
+	Warnings []Warning             `json:"warnings,omitempty"`
+	Host     *HostInfo             `json:"host,omitempty"`
 }
 
-// ReadMessage reads a length-prefixed JSON message from the given reader.
-// Chrome's native messaging protocol uses a 32-bit little-endian length prefix.
-func ReadMessage(r io.Reader) (*Message, error) {
-	var length uint32
-	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
-		if err == io.EOF {
-			return nil, err
-		}
-		return nil, fmt.Errorf("failed to read message length: %w", err)
-	}
-
-	if length == 0 {
-		return nil, fmt.Errorf("invalid message length: 0")
-	}
-	if length > MaxMessageSize {
-		return nil, fmt.Errorf("message too large: %d bytes (max %d)", length, MaxMessageSize)
-	}
-
-	buf := make([]byte, length)
-	if _, err := io.ReadFull(r, buf); err != nil {
-		return nil, fmt.Errorf("failed to read message body: %w", err)
-	}
-
-	var msg Message
-	if err := json.Unmarshal(buf, &msg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+// ResultOf returns resp's Result, whether a handler set it or it was
+// decoded from the wire. It's a zero Result if there is none.
+func ResultOf(resp nativehost.Response) Result {
+	switch r := resp.Result.(type) {
+	case Result:
+		return r
+	case json.RawMessage:
+		var result Result
+		json.Unmarshal(r, &result)
+		return result
 	}
+	return Result{}
+}
 
-	return &msg, nil
+// HostInfo describes the host in reply to a hello
+type HostInfo struct {
+	ProtocolVersion    int      `json:"protocolVersion"`
+	MinProtocolVersion int      `json:"minProtocolVersion"`
+	Version            string   `json:"version"` // Semantic version of the host
+	Commit             string   `json:"commit"`
+	OS                 string   `json:"os"`
+	Actions            []string `json:"actions"`
+	FileTypes          []string `json:"fileTypes"`
 }
 
-// WriteMessage writes a length-prefixed JSON response to the given writer.
-// Chrome's native messaging protocol uses a 32-bit little-endian length prefix.
-func WriteMessage(w io.Writer, resp Response) error {
-	data, err := json.Marshal(resp)
-	if err != nil {
-		return fmt.Errorf("failed to marshal response: %w", err)
+// CompatibleVersion reports whether the host can serve a message sent with
+// the given protocol version; 0 means the message didn't say
+func CompatibleVersion(v int) bool {
+	if v == 0 {
+		return true
 	}
+	return v >= MinProtocolVersion && v <= ProtocolVersion
+}
 
-	length := uint32(len(data))
-	if err := binary.Write(w, binary.LittleEndian, length); err != nil {
-		return fmt.Errorf("failed to write message length: %w", err)
-	}
+// DefaultApp is the getDefaults entry for one file type. Name and BundleID
+// are empty if the type has no default.
+type DefaultApp struct {
+	Name          string `json:"name"`
+	BundleID      string `json:"bundleId"`
+	PreferredName string `json:"preferredName,omitempty"` // Set when a preferred app overrides the default
+	PreferredID   string `json:"preferredId,omitempty"`
+}
 
-	if _, err := w.Write(data); err != nil {
-		return fmt.Errorf("failed to write message body: %w", err)
-	}
+// App describes an application that can open a file type
+type App struct {
+	Name      string `json:"name"`
+	ID        string `json:"id"` // Bundle ID on macOS, desktop-file ID on Linux
+	Path      string `json:"path"`
+	IsDefault bool   `json:"isDefault"`
+}
 
-	return nil
+// Warning describes active content found in a file, such as macros
+type Warning struct {
+	Code    string `json:"code"`           // Kind of content, e.g. "macros" or "dde"
+	Part    string `json:"part,omitempty"` // Where in the file it was found
+	Message string `json:"message"`
 }
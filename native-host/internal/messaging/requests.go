@@ -0,0 +1,53 @@
+package messaging
+
+// Request payloads, one per action. Fields tagged `required:"true"` must
+// be present; Decode rejects fields not listed here.
+
+// EmptyRequest is the payload of actions without parameters (getDefaults,
+// hello, ping)
+type EmptyRequest struct{}
+
+// OpenRequest is the payload of open
+type OpenRequest struct {
+	FilePath string `json:"filePath" required:"true"`
+	FileType string `json:"fileType,omitempty"` // The type the extension expects; the path's extension decides
+}
+
+// OpenWithRequest is the payload of openWith
+type OpenWithRequest struct {
+	FilePath string `json:"filePath" required:"true"`
+	FileType string `json:"fileType,omitempty"`
+	AppID    string `json:"appId" required:"true"` // An ID from listApps
+}
+
+// ListAppsRequest is the payload of listApps
+type ListAppsRequest struct {
+	FileType string `json:"fileType" required:"true"`
+}
+
+// SetSystemDefaultRequest is the payload of setSystemDefault
+type SetSystemDefaultRequest struct {
+	FileType string `json:"fileType" required:"true"`
+	AppID    string `json:"appId" required:"true"`
+}
+
+// SetPreferredAppRequest is the payload of setPreferredApp
+type SetPreferredAppRequest struct {
+	FileType string `json:"fileType" required:"true"`
+	AppID    string `json:"appId" required:"true"`
+}
+
+// ClearPreferredAppRequest is the payload of clearPreferredApp
+type ClearPreferredAppRequest struct {
+	FileType string `json:"fileType" required:"true"`
+}
+
+// WriteFileRequest is the payload of writeFile. Content over 1 MB makes the
+// message too big for one frame, so it arrives as a stream.
+type WriteFileRequest struct {
+	Title    string `json:"title"` // Document title; sanitized into the file name
+	FileType string `json:"fileType" required:"true"`
+	Data     string `json:"data" required:"true"` // File content, standard base64
+	Open     bool   `json:"open,omitempty"`       // Open the file once it's written
+	AppID    string `json:"appId,omitempty"`      // With open, an ID from listApps to open it with
+}
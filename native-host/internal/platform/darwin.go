@@ -7,7 +7,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 )
 
@@ -17,30 +16,11 @@ func newDarwinPlatform() *darwinPlatform {
 	return &darwinPlatform{}
 }
 
-// validatePath ensures a path is safe for command execution
-// Returns the cleaned absolute path and an error if validation fails
-func validatePath(path string) (string, error) {
-	if path == "" {
-		return "", fmt.Errorf("empty path")
-	}
-
-	// Get absolute path
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return "", fmt.Errorf("invalid path: %w", err)
-	}
+// Tools are the commands this platform runs to look up and open apps
+var Tools = []string{"osascript", "mdls", "open"}
 
-	// Clean the path to remove any . or .. components
-	cleanPath := filepath.Clean(absPath)
-
-	// Ensure the path doesn't contain null bytes or other control characters
-	for _, r := range cleanPath {
-		if r < 32 || r == 127 {
-			return "", fmt.Errorf("path contains invalid characters")
-		}
-	}
-
-	return cleanPath, nil
+func newPlatform() Platform {
+	return newDarwinPlatform()
 }
 
 // validateAppPath ensures an application path is valid
@@ -67,9 +47,6 @@ func validateAppPath(appPath string) (string, error) {
 	return cleanPath, nil
 }
 
-// extensionPattern validates file extensions (alphanumeric only)
-var extensionPattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
-
 // GetDefaultApp returns the default application for a file extension on macOS.
 // Uses osascript/System Events to find the default app.
 func (p *darwinPlatform) GetDefaultApp(ext string) (AppInfo, error) {
@@ -84,12 +61,10 @@ func (p *darwinPlatform) GetDefaultApp(ext string) (AppInfo, error) {
 	}
 
 	// Create a temp file to query (needs to exist for System Events)
-	tempPath := filepath.Join(os.TempDir(), "query."+ext)
-	f, err := os.Create(tempPath)
+	tempPath, err := queryFile(ext)
 	if err != nil {
-		return AppInfo{}, fmt.Errorf("failed to create temp file: %w", err)
+		return AppInfo{}, err
 	}
-	f.Close()
 	defer os.Remove(tempPath)
 
 	// Use osascript to query System Events for the default app
@@ -142,6 +117,109 @@ func (p *darwinPlatform) GetDefaultApp(ext string) (AppInfo, error) {
 	}, nil
 }
 
+// listAppsScript asks Launch Services, via NSWorkspace, for every app that
+// can open the file given as the first argument, one path per line
+const listAppsScript = `ObjC.import("AppKit");
+function run(argv) {
+	var url = $.NSURL.fileURLWithPath(argv[0]);
+	var urls = $.NSWorkspace.sharedWorkspace.URLsForApplicationsToOpenURL(url);
+	var paths = [];
+	for (var i = 0; i < urls.count; i++) {
+		paths.push(urls.objectAtIndex(i).path.js);
+	}
+	return paths.join("\n");
+}`
+
+// queryFile creates an empty file with extension ext for Launch Services
+// to match on. Each call gets its own file, so concurrent lookups don't
+// remove each other's. The caller removes it.
+func queryFile(ext string) (string, error) {
+	f, err := os.CreateTemp("", "query-*."+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// ListApps returns every application registered for a file extension on macOS.
+// Uses osascript/JXA to query NSWorkspace (macOS 12+).
+func (p *darwinPlatform) ListApps(ext string) ([]AppInfo, error) {
+	ext = strings.TrimPrefix(ext, ".")
+	if ext == "" {
+		return nil, fmt.Errorf("empty extension")
+	}
+
+	// Validate extension contains only safe characters
+	if !extensionPattern.MatchString(ext) {
+		return nil, fmt.Errorf("invalid extension format")
+	}
+
+	// Create a temp file to query (Launch Services matches on the file)
+	tempPath, err := queryFile(ext)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempPath)
+
+	// The path is passed as an argument, never interpolated into the script
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", listAppsScript, tempPath)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list apps for .%s", ext)
+	}
+
+	var apps []AppInfo
+	seen := make(map[string]bool)
+	for _, appPath := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if !strings.HasSuffix(appPath, ".app") || seen[appPath] {
+			continue
+		}
+		seen[appPath] = true
+		apps = append(apps, AppInfo{
+			Name:     strings.TrimSuffix(filepath.Base(appPath), ".app"),
+			BundleID: p.getBundleID(appPath),
+			Path:     appPath,
+		})
+	}
+	return apps, nil
+}
+
+// setDefaultScript registers the bundle ID given as the second argument as
+// the handler for the extension given as the first, for all roles
+const setDefaultScript = `ObjC.import("CoreServices");
+ObjC.import("UniformTypeIdentifiers");
+function run(argv) {
+	var type = $.UTType.typeWithFilenameExtension(argv[0]);
+	if (type.isNil()) {
+		throw new Error("unknown type");
+	}
+	var status = $.LSSetDefaultRoleHandlerForContentType(type.identifier, 0xFFFFFFFF, $(argv[1]));
+	if (status !== 0) {
+		throw new Error("Launch Services error " + status);
+	}
+	return type.identifier.js;
+}`
+
+// SetDefaultApp makes app the default for a file extension on macOS.
+// Uses osascript/JXA to call LSSetDefaultRoleHandlerForContentType.
+func (p *darwinPlatform) SetDefaultApp(ext string, app AppInfo) error {
+	ext = strings.TrimPrefix(ext, ".")
+	if !extensionPattern.MatchString(ext) {
+		return fmt.Errorf("invalid extension format")
+	}
+	if app.BundleID == "" {
+		return fmt.Errorf("application has no bundle identifier")
+	}
+
+	// Arguments are passed separately, never interpolated into the script
+	cmd := exec.Command("osascript", "-l", "JavaScript", "-e", setDefaultScript, ext, app.BundleID)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set default app for .%s: %s", ext, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
 // getBundleID extracts the bundle identifier from an app using mdls
 func (p *darwinPlatform) getBundleID(appPath string) string {
 	cmd := exec.Command("mdls", "-name", "kMDItemCFBundleIdentifier", "-raw", appPath)
@@ -195,4 +273,3 @@ func (p *darwinPlatform) OpenWith(path string, appPath string) error {
 	cmd := exec.Command("open", "-a", cleanAppPath, cleanPath)
 	return cmd.Run()
 }
-
@@ -55,6 +55,34 @@ func TestGetDefaultApp(t *testing.T) {
 	}
 }
 
+func TestListApps(t *testing.T) {
+	p := New()
+
+	t.Run("empty extension", func(t *testing.T) {
+		_, err := p.ListApps("")
+		if err == nil {
+			t.Error("ListApps(\"\") expected error, got nil")
+		}
+	})
+
+	// Test common extensions - the list may be empty on a bare system
+	for _, ext := range []string{"txt", "pdf"} {
+		t.Run("extension_"+ext, func(t *testing.T) {
+			apps, err := p.ListApps(ext)
+			if err != nil {
+				t.Logf("ListApps(%q): query failed (this is OK on older macOS): %v", ext, err)
+				return
+			}
+			for _, app := range apps {
+				if !strings.HasSuffix(app.Path, ".app") {
+					t.Errorf("ListApps(%q) Path doesn't end with .app: %s", ext, app.Path)
+				}
+				t.Logf("App for .%s: %s (%s) at %s", ext, app.Name, app.BundleID, app.Path)
+			}
+		})
+	}
+}
+
 func TestOpenWithDefault(t *testing.T) {
 	// Skip in CI environments
 	if os.Getenv("CI") != "" {
@@ -0,0 +1,406 @@
+//go:build linux
+
+package platform
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+	"github.com/reclaim/openwith/internal/xdg"
+)
+
+// linuxPlatform resolves applications from the XDG MIME association
+// files (mimeapps.list) and launches them from their .desktop entries.
+type linuxPlatform struct {
+	configHome string   // $XDG_CONFIG_HOME
+	configDirs []string // $XDG_CONFIG_DIRS
+	dataHome   string   // $XDG_DATA_HOME
+	dataDirs   []string // $XDG_DATA_DIRS
+	desktops   []string // $XDG_CURRENT_DESKTOP, lowercased
+}
+
+func newLinuxPlatform() *linuxPlatform {
+	home, _ := os.UserHomeDir()
+
+	var desktops []string
+	for _, d := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if d != "" {
+			desktops = append(desktops, strings.ToLower(d))
+		}
+	}
+
+	return &linuxPlatform{
+		configHome: xdgDir("XDG_CONFIG_HOME", filepath.Join(home, ".config")),
+		configDirs: xdgDirs("XDG_CONFIG_DIRS", "/etc/xdg"),
+		dataHome:   xdgDir("XDG_DATA_HOME", filepath.Join(home, ".local", "share")),
+		dataDirs:   xdgDirs("XDG_DATA_DIRS", "/usr/local/share:/usr/share"),
+		desktops:   desktops,
+	}
+}
+
+// Tools are the commands this platform runs to look up and open apps.
+// There are none: the XDG MIME files are read directly and apps are
+// started from their desktop entries.
+var Tools []string
+
+func newPlatform() Platform {
+	return newLinuxPlatform()
+}
+
+// xdgDir reads a single-directory XDG variable. Relative paths are invalid
+// per the Base Directory spec and are ignored.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return fallback
+}
+
+// xdgDirs reads a colon-separated XDG search path
+func xdgDirs(env, fallback string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv(env), ":") {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return strings.Split(fallback, ":")
+	}
+	return dirs
+}
+
+// mimeappsLists returns the mimeapps.list files in XDG precedence order,
+// highest first. Desktop-specific lists come before the generic one in
+// each directory.
+func (p *linuxPlatform) mimeappsLists() []string {
+	var lists []string
+	add := func(dir string) {
+		for _, desktop := range p.desktops {
+			lists = append(lists, filepath.Join(dir, desktop+"-mimeapps.list"))
+		}
+		lists = append(lists, filepath.Join(dir, "mimeapps.list"))
+	}
+
+	add(p.configHome)
+	for _, dir := range p.configDirs {
+		add(dir)
+	}
+	for _, dir := range p.applicationDirs() {
+		add(dir)
+	}
+	return lists
+}
+
+// applicationDirs returns the directories holding .desktop files, highest
+// precedence first
+func (p *linuxPlatform) applicationDirs() []string {
+	dirs := []string{filepath.Join(p.dataHome, "applications")}
+	for _, dir := range p.dataDirs {
+		dirs = append(dirs, filepath.Join(dir, "applications"))
+	}
+	return dirs
+}
+
+// desktopFiles maps every installed desktop-file ID to its path. The ID is
+// the path relative to the applications directory with "/" replaced by "-";
+// earlier directories shadow later ones.
+func (p *linuxPlatform) desktopFiles() map[string]string {
+	files := make(map[string]string)
+	for _, dir := range p.applicationDirs() {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+			id, err := xdg.DesktopFileID(dir, path)
+			if err != nil {
+				return nil
+			}
+			if _, ok := files[id]; !ok {
+				files[id] = path
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// mimeTypeForExt returns the MIME type for a file extension. Registered
+// types come first: the Office Open XML types are missing from many
+// /etc/mime.types files, so we don't rely on the system table for them.
+func mimeTypeForExt(ext string) string {
+	if t, ok := filetypes.Lookup(strings.ToLower(ext)); ok {
+		return t.MIMEType()
+	}
+	t, _, _ := strings.Cut(mime.TypeByExtension("."+ext), ";")
+	return strings.TrimSpace(t)
+}
+
+// GetDefaultApp returns the default application for a file extension on Linux.
+// The first installed default in mimeapps.list precedence order wins. Without
+// one, we fall back to the first installed handler, as xdg-mime does.
+func (p *linuxPlatform) GetDefaultApp(ext string) (AppInfo, error) {
+	ext = strings.TrimPrefix(ext, ".")
+	if ext == "" {
+		return AppInfo{}, fmt.Errorf("empty extension")
+	}
+
+	// Validate extension contains only safe characters
+	if !extensionPattern.MatchString(ext) {
+		return AppInfo{}, fmt.Errorf("invalid extension format")
+	}
+
+	mimeType := mimeTypeForExt(ext)
+	if mimeType == "" {
+		return AppInfo{}, fmt.Errorf("no default app for .%s", ext)
+	}
+
+	files := p.desktopFiles()
+	defaults, handlers := p.associations(mimeType, files)
+	for _, id := range append(defaults, handlers...) {
+		if app, ok := loadApp(files, id); ok {
+			return app, nil
+		}
+	}
+
+	return AppInfo{}, fmt.Errorf("no default app for .%s", ext)
+}
+
+// ListApps returns every installed application registered for a file
+// extension, defaults first, then added associations and finally entries
+// declaring the MIME type
+func (p *linuxPlatform) ListApps(ext string) ([]AppInfo, error) {
+	ext = strings.TrimPrefix(ext, ".")
+	if ext == "" {
+		return nil, fmt.Errorf("empty extension")
+	}
+
+	// Validate extension contains only safe characters
+	if !extensionPattern.MatchString(ext) {
+		return nil, fmt.Errorf("invalid extension format")
+	}
+
+	mimeType := mimeTypeForExt(ext)
+	if mimeType == "" {
+		return nil, nil
+	}
+
+	files := p.desktopFiles()
+	defaults, handlers := p.associations(mimeType, files)
+	seen := make(map[string]bool)
+	var apps []AppInfo
+	for _, id := range append(defaults, handlers...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if app, ok := loadApp(files, id); ok {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
+
+// SetDefaultApp makes app the default for the extension's MIME type in the
+// user's mimeapps.list. A desktop-specific list can still override it, in
+// which case an error says so.
+func (p *linuxPlatform) SetDefaultApp(ext string, app AppInfo) error {
+	ext = strings.TrimPrefix(ext, ".")
+	if !extensionPattern.MatchString(ext) {
+		return fmt.Errorf("invalid extension format")
+	}
+
+	mimeType := mimeTypeForExt(ext)
+	if mimeType == "" {
+		return fmt.Errorf("unknown MIME type for .%s", ext)
+	}
+
+	list := filepath.Join(p.configHome, "mimeapps.list")
+	if err := xdg.SetDefaultApplication(list, mimeType, app.BundleID); err != nil {
+		return err
+	}
+
+	current, err := p.GetDefaultApp(ext)
+	if err != nil {
+		return fmt.Errorf("failed to check the default for %s: %w", mimeType, err)
+	}
+	if current.BundleID != app.BundleID {
+		return fmt.Errorf("default for %s is overridden by a desktop-specific mimeapps.list", mimeType)
+	}
+	return nil
+}
+
+// associations collects the desktop-file IDs associated with mimeType.
+// defaults lists the Default Applications entries in precedence order;
+// handlers lists added associations followed by entries that declare the
+// type. Added associations may name entries that aren't installed, so
+// callers resolve each ID with loadApp.
+func (p *linuxPlatform) associations(mimeType string, files map[string]string) (defaults []string, handlers []string) {
+	removed := make(map[string]bool)
+	var added []string
+	for _, list := range p.mimeappsLists() {
+		assoc, err := xdg.ReadMimeApps(list)
+		if err != nil {
+			continue
+		}
+		defaults = append(defaults, assoc.Defaults[mimeType]...)
+		// Removals hide associations from this and every lower-precedence
+		// list, as well as the MimeType keys of the desktop entries
+		for _, id := range assoc.Removed[mimeType] {
+			removed[id] = true
+		}
+		for _, id := range assoc.Added[mimeType] {
+			if !removed[id] {
+				added = append(added, id)
+			}
+		}
+	}
+
+	// added was filtered by precedence above; a removal anywhere hides an
+	// entry's own MimeType declaration
+	handlers = added
+	for _, id := range handlersFor(files, mimeType) {
+		if !removed[id] {
+			handlers = append(handlers, id)
+		}
+	}
+	return defaults, handlers
+}
+
+// handlersFor returns the IDs of installed desktop entries that declare
+// mimeType, sorted so the result doesn't depend on directory order
+func handlersFor(files map[string]string, mimeType string) []string {
+	var ids []string
+	for id, path := range files {
+		entry, err := xdg.ReadDesktopEntry(path)
+		if err != nil {
+			continue
+		}
+		if entry.HandlesMimeType(mimeType) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// loadApp resolves a desktop-file ID to an AppInfo. Entries that are not
+// installed, hidden, or whose TryExec program is missing are skipped.
+func loadApp(files map[string]string, id string) (AppInfo, bool) {
+	path, ok := files[id]
+	if !ok {
+		return AppInfo{}, false
+	}
+	entry, err := xdg.ReadDesktopEntry(path)
+	if err != nil || !entry.IsApplication() {
+		return AppInfo{}, false
+	}
+
+	name := entry.LocalizedName(xdg.Locale())
+	if name == "" {
+		name = strings.TrimSuffix(id, ".desktop")
+	}
+	return AppInfo{Name: name, BundleID: id, Path: path}, true
+}
+
+// OpenWithDefault opens a file with its default application
+func (p *linuxPlatform) OpenWithDefault(path string) error {
+	// Validate and clean the path before execution
+	cleanPath, err := validatePath(path)
+	if err != nil {
+		return fmt.Errorf("invalid file path: %w", err)
+	}
+
+	// Verify the file exists
+	if _, err := os.Stat(cleanPath); err != nil {
+		return fmt.Errorf("file not accessible: %w", err)
+	}
+
+	app, err := p.GetDefaultApp(filepath.Ext(cleanPath))
+	if err != nil {
+		return err
+	}
+
+	return launch(app.Path, cleanPath)
+}
+
+// OpenWith opens a file with a specific application, given its .desktop file
+func (p *linuxPlatform) OpenWith(path string, appPath string) error {
+	// Validate file path
+	cleanPath, err := validatePath(path)
+	if err != nil {
+		return fmt.Errorf("invalid file path: %w", err)
+	}
+
+	// Validate application path
+	cleanAppPath, err := validateDesktopPath(appPath)
+	if err != nil {
+		return fmt.Errorf("invalid application: %w", err)
+	}
+
+	// Verify the file exists
+	if _, err := os.Stat(cleanPath); err != nil {
+		return fmt.Errorf("file not accessible: %w", err)
+	}
+
+	return launch(cleanAppPath, cleanPath)
+}
+
+// validateDesktopPath ensures an application path is a .desktop file
+func validateDesktopPath(appPath string) (string, error) {
+	cleanPath, err := validatePath(appPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(cleanPath, ".desktop") {
+		return "", fmt.Errorf("invalid application path")
+	}
+
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		return "", fmt.Errorf("application not found")
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("invalid application")
+	}
+
+	return cleanPath, nil
+}
+
+// launch starts the application described by a .desktop file with the given
+// file as its argument. The Exec line is expanded to an argv directly; it
+// never goes through a shell.
+func launch(desktopPath string, file string) error {
+	entry, err := xdg.ReadDesktopEntry(desktopPath)
+	if err != nil {
+		return fmt.Errorf("failed to read application: %w", err)
+	}
+	if !entry.IsApplication() {
+		return fmt.Errorf("application cannot be launched")
+	}
+
+	argv, err := entry.Argv(file)
+	if err != nil {
+		return err
+	}
+
+	// Stdin/stdout stay detached so the app can't write into the native
+	// messaging pipe, and its own session keeps it alive after we exit.
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to launch %s: %w", argv[0], err)
+	}
+	go func() { _ = cmd.Wait() }()
+
+	return nil
+}
@@ -0,0 +1,327 @@
+//go:build linux
+
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeXDG points every XDG variable into a fresh temp dir and returns its root
+func fakeXDG(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	t.Setenv("XDG_CONFIG_DIRS", filepath.Join(root, "etc", "xdg"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(root, "data"))
+	t.Setenv("XDG_DATA_DIRS", filepath.Join(root, "usr", "share"))
+	t.Setenv("XDG_CURRENT_DESKTOP", "")
+	return root
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func writeDesktopEntry(t *testing.T, root, id, name, exec, mimeTypes string) string {
+	t.Helper()
+	path := filepath.Join(root, "usr", "share", "applications", id)
+	writeFile(t, path, "[Desktop Entry]\nType=Application\nName="+name+"\nExec="+exec+"\nMimeType="+mimeTypes+"\n")
+	return path
+}
+
+const xlsxMIME = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+func TestLinuxGetDefaultApp(t *testing.T) {
+	t.Run("empty extension", func(t *testing.T) {
+		fakeXDG(t)
+		if _, err := newLinuxPlatform().GetDefaultApp(""); err == nil {
+			t.Error("GetDefaultApp(\"\") expected error, got nil")
+		}
+	})
+
+	t.Run("invalid extension", func(t *testing.T) {
+		fakeXDG(t)
+		if _, err := newLinuxPlatform().GetDefaultApp("../x"); err == nil {
+			t.Error("GetDefaultApp(\"../x\") expected error, got nil")
+		}
+	})
+
+	t.Run("no handler installed", func(t *testing.T) {
+		fakeXDG(t)
+		if _, err := newLinuxPlatform().GetDefaultApp("xlsx"); err == nil {
+			t.Error("GetDefaultApp(\"xlsx\") expected error, got nil")
+		}
+	})
+
+	t.Run("user list overrides system list", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeDesktopEntry(t, root, "libreoffice-calc.desktop", "LibreOffice Calc", "libreoffice --calc %U", xlsxMIME+";")
+		gnumeric := writeDesktopEntry(t, root, "org.gnome.Gnumeric.desktop", "Gnumeric", "gnumeric %U", xlsxMIME+";")
+		writeFile(t, filepath.Join(root, "etc", "xdg", "mimeapps.list"),
+			"[Default Applications]\n"+xlsxMIME+"=libreoffice-calc.desktop\n")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Default Applications]\n"+xlsxMIME+"=org.gnome.Gnumeric.desktop\n")
+
+		info, err := newLinuxPlatform().GetDefaultApp(".xlsx")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.Name != "Gnumeric" || info.BundleID != "org.gnome.Gnumeric.desktop" || info.Path != gnumeric {
+			t.Errorf("GetDefaultApp() = %+v, want Gnumeric at %s", info, gnumeric)
+		}
+	})
+
+	t.Run("desktop-specific list overrides generic list", func(t *testing.T) {
+		root := fakeXDG(t)
+		t.Setenv("XDG_CURRENT_DESKTOP", "ubuntu:GNOME")
+		writeDesktopEntry(t, root, "libreoffice-calc.desktop", "LibreOffice Calc", "libreoffice --calc %U", xlsxMIME+";")
+		writeDesktopEntry(t, root, "org.gnome.Gnumeric.desktop", "Gnumeric", "gnumeric %U", xlsxMIME+";")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Default Applications]\n"+xlsxMIME+"=libreoffice-calc.desktop\n")
+		writeFile(t, filepath.Join(root, "config", "gnome-mimeapps.list"),
+			"[Default Applications]\n"+xlsxMIME+"=org.gnome.Gnumeric.desktop\n")
+
+		info, err := newLinuxPlatform().GetDefaultApp("xlsx")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.BundleID != "org.gnome.Gnumeric.desktop" {
+			t.Errorf("GetDefaultApp() BundleID = %q, want org.gnome.Gnumeric.desktop", info.BundleID)
+		}
+	})
+
+	t.Run("uninstalled default is skipped", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeDesktopEntry(t, root, "libreoffice-calc.desktop", "LibreOffice Calc", "libreoffice --calc %U", xlsxMIME+";")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Default Applications]\n"+xlsxMIME+"=removed-app.desktop;libreoffice-calc.desktop;\n")
+
+		info, err := newLinuxPlatform().GetDefaultApp("xlsx")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.BundleID != "libreoffice-calc.desktop" {
+			t.Errorf("GetDefaultApp() BundleID = %q, want libreoffice-calc.desktop", info.BundleID)
+		}
+	})
+
+	t.Run("falls back to declared handler", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeDesktopEntry(t, root, "org.gnome.TextEditor.desktop", "Text Editor", "gnome-text-editor %U", "text/plain;")
+
+		info, err := newLinuxPlatform().GetDefaultApp("txt")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.Name != "Text Editor" {
+			t.Errorf("GetDefaultApp() Name = %q, want Text Editor", info.Name)
+		}
+	})
+
+	t.Run("removed association is skipped", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeDesktopEntry(t, root, "libreoffice-calc.desktop", "LibreOffice Calc", "libreoffice --calc %U", xlsxMIME+";")
+		writeDesktopEntry(t, root, "org.gnome.Gnumeric.desktop", "Gnumeric", "gnumeric %U", xlsxMIME+";")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Removed Associations]\n"+xlsxMIME+"=libreoffice-calc.desktop;\n")
+
+		info, err := newLinuxPlatform().GetDefaultApp("xlsx")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.BundleID != "org.gnome.Gnumeric.desktop" {
+			t.Errorf("GetDefaultApp() BundleID = %q, want org.gnome.Gnumeric.desktop", info.BundleID)
+		}
+	})
+
+	t.Run("lower-precedence removal keeps user's added association", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeDesktopEntry(t, root, "org.gnome.Gnumeric.desktop", "Gnumeric", "gnumeric %U", "")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Added Associations]\n"+xlsxMIME+"=org.gnome.Gnumeric.desktop;\n")
+		writeFile(t, filepath.Join(root, "usr", "share", "applications", "mimeapps.list"),
+			"[Removed Associations]\n"+xlsxMIME+"=org.gnome.Gnumeric.desktop;\n")
+
+		info, err := newLinuxPlatform().GetDefaultApp("xlsx")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.BundleID != "org.gnome.Gnumeric.desktop" {
+			t.Errorf("GetDefaultApp() BundleID = %q, want org.gnome.Gnumeric.desktop", info.BundleID)
+		}
+	})
+
+	t.Run("missing TryExec program is skipped", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeFile(t, filepath.Join(root, "usr", "share", "applications", "gone.desktop"),
+			"[Desktop Entry]\nType=Application\nName=Gone\nTryExec=/nonexistent/gone\nExec=gone %f\nMimeType=application/pdf;\n")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Default Applications]\napplication/pdf=gone.desktop\n")
+
+		if info, err := newLinuxPlatform().GetDefaultApp("pdf"); err == nil {
+			t.Errorf("GetDefaultApp(\"pdf\") expected error, got %+v", info)
+		}
+	})
+
+	t.Run("desktop ID from subdirectory", func(t *testing.T) {
+		root := fakeXDG(t)
+		writeDesktopEntry(t, root, filepath.Join("kde4", "okular.desktop"), "Okular", "okular %U", "application/pdf;")
+		writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+			"[Default Applications]\napplication/pdf=kde4-okular.desktop\n")
+
+		info, err := newLinuxPlatform().GetDefaultApp("pdf")
+		if err != nil {
+			t.Fatalf("GetDefaultApp() error: %v", err)
+		}
+		if info.BundleID != "kde4-okular.desktop" {
+			t.Errorf("GetDefaultApp() BundleID = %q, want kde4-okular.desktop", info.BundleID)
+		}
+	})
+}
+
+func TestLinuxListApps(t *testing.T) {
+	root := fakeXDG(t)
+	writeDesktopEntry(t, root, "libreoffice-calc.desktop", "LibreOffice Calc", "libreoffice --calc %U", xlsxMIME+";")
+	writeDesktopEntry(t, root, "org.gnome.Gnumeric.desktop", "Gnumeric", "gnumeric %U", xlsxMIME+";")
+	writeDesktopEntry(t, root, "onlyoffice-desktopeditors.desktop", "ONLYOFFICE", "onlyoffice %U", xlsxMIME+";")
+	writeDesktopEntry(t, root, "wps-office-et.desktop", "WPS Spreadsheets", "et %f", "")
+	writeDesktopEntry(t, root, "org.gnome.TextEditor.desktop", "Text Editor", "gnome-text-editor %U", "text/plain;")
+	writeFile(t, filepath.Join(root, "config", "mimeapps.list"),
+		"[Default Applications]\n"+xlsxMIME+"=org.gnome.Gnumeric.desktop\n"+
+			"[Added Associations]\n"+xlsxMIME+"=wps-office-et.desktop;org.gnome.Gnumeric.desktop;\n"+
+			"[Removed Associations]\n"+xlsxMIME+"=onlyoffice-desktopeditors.desktop;\n")
+
+	apps, err := newLinuxPlatform().ListApps("xlsx")
+	if err != nil {
+		t.Fatalf("ListApps() error: %v", err)
+	}
+
+	var ids []string
+	for _, app := range apps {
+		ids = append(ids, app.BundleID)
+	}
+	want := "org.gnome.Gnumeric.desktop,wps-office-et.desktop,libreoffice-calc.desktop"
+	if strings.Join(ids, ",") != want {
+		t.Errorf("ListApps() IDs = %v, want %s", ids, want)
+	}
+
+	if _, err := newLinuxPlatform().ListApps(""); err == nil {
+		t.Error("ListApps(\"\") expected error, got nil")
+	}
+}
+
+func TestLinuxSetDefaultApp(t *testing.T) {
+	root := fakeXDG(t)
+	writeDesktopEntry(t, root, "libreoffice-calc.desktop", "LibreOffice Calc", "libreoffice --calc %U", xlsxMIME+";")
+	gnumeric := writeDesktopEntry(t, root, "org.gnome.Gnumeric.desktop", "Gnumeric", "gnumeric %U", xlsxMIME+";")
+	list := filepath.Join(root, "config", "mimeapps.list")
+	writeFile(t, list, "[Default Applications]\n"+xlsxMIME+"=libreoffice-calc.desktop\ntext/html=firefox.desktop\n")
+
+	p := newLinuxPlatform()
+	app := AppInfo{Name: "Gnumeric", BundleID: "org.gnome.Gnumeric.desktop", Path: gnumeric}
+	if err := p.SetDefaultApp("xlsx", app); err != nil {
+		t.Fatalf("SetDefaultApp() error: %v", err)
+	}
+
+	info, err := p.GetDefaultApp("xlsx")
+	if err != nil || info.BundleID != "org.gnome.Gnumeric.desktop" {
+		t.Errorf("GetDefaultApp() = %+v, %v, want Gnumeric", info, err)
+	}
+
+	data, _ := os.ReadFile(list)
+	if !strings.Contains(string(data), "text/html=firefox.desktop") {
+		t.Errorf("Unrelated association was lost:\n%s", data)
+	}
+
+	// A desktop-specific list shadows the one we write
+	t.Setenv("XDG_CURRENT_DESKTOP", "KDE")
+	writeFile(t, filepath.Join(root, "config", "kde-mimeapps.list"),
+		"[Default Applications]\n"+xlsxMIME+"=org.gnome.Gnumeric.desktop\n")
+	calc := AppInfo{Name: "LibreOffice Calc", BundleID: "libreoffice-calc.desktop"}
+	err = newLinuxPlatform().SetDefaultApp("xlsx", calc)
+	if err == nil || !strings.Contains(err.Error(), "overridden") {
+		t.Errorf("SetDefaultApp() error = %v, want an override error when shadowed", err)
+	}
+
+	// An app that can't be resolved isn't reported as shadowed
+	missing := AppInfo{Name: "Missing", BundleID: "missing.desktop"}
+	err = newLinuxPlatform().SetDefaultApp("pdf", missing)
+	if err == nil || strings.Contains(err.Error(), "overridden") {
+		t.Errorf("SetDefaultApp() error = %v, want the lookup error", err)
+	}
+}
+
+// fakeApp installs a script that records its arguments, one per line
+func fakeApp(t *testing.T, root string) (exe string, argsFile string) {
+	t.Helper()
+	exe = filepath.Join(root, "bin", "fake-app")
+	argsFile = filepath.Join(root, "args")
+	writeFile(t, exe, "#!/bin/sh\nprintf '%s\\n' \"$@\" > \""+argsFile+".tmp\"\nmv \""+argsFile+".tmp\" \""+argsFile+"\"\n")
+	return exe, argsFile
+}
+
+func waitForArgs(t *testing.T, argsFile string) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(argsFile); err == nil {
+			return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Application was not launched")
+	return nil
+}
+
+func TestLinuxOpenWithDefault(t *testing.T) {
+	root := fakeXDG(t)
+	exe, argsFile := fakeApp(t, root)
+	writeDesktopEntry(t, root, "fake.desktop", "Fake", exe+" --view %f", "text/plain;")
+
+	file := filepath.Join(root, "open-with-My Notes.txt")
+	writeFile(t, file, "hello")
+
+	if err := newLinuxPlatform().OpenWithDefault(file); err != nil {
+		t.Fatalf("OpenWithDefault() error: %v", err)
+	}
+
+	args := waitForArgs(t, argsFile)
+	if len(args) != 2 || args[0] != "--view" || args[1] != file {
+		t.Errorf("Application args = %q, want [--view %s]", args, file)
+	}
+}
+
+func TestLinuxOpenWith(t *testing.T) {
+	root := fakeXDG(t)
+	exe, argsFile := fakeApp(t, root)
+	desktopPath := writeDesktopEntry(t, root, "fake.desktop", "Fake", exe, "application/pdf;")
+
+	file := filepath.Join(root, "open-with-Report.pdf")
+	writeFile(t, file, "%PDF-1.7")
+
+	p := newLinuxPlatform()
+
+	if err := p.OpenWith(file, filepath.Join(root, "bin", "fake-app")); err == nil {
+		t.Error("OpenWith() with a non-.desktop path expected error, got nil")
+	}
+
+	if err := p.OpenWith(file, desktopPath); err != nil {
+		t.Fatalf("OpenWith() error: %v", err)
+	}
+
+	// No field code in Exec, so the file is appended
+	args := waitForArgs(t, argsFile)
+	if len(args) != 1 || args[0] != file {
+		t.Errorf("Application args = %q, want [%s]", args, file)
+	}
+}
@@ -1,10 +1,16 @@
 package platform
 
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
 // AppInfo contains information about an application
 type AppInfo struct {
 	Name     string // Display name (e.g., "Microsoft Excel")
-	BundleID string // Bundle identifier (e.g., "com.microsoft.Excel")
-	Path     string // Application path (e.g., "/Applications/Microsoft Excel.app")
+	BundleID string // Bundle identifier on macOS (e.g., "com.microsoft.Excel"), desktop-file ID on Linux (e.g., "libreoffice-calc.desktop")
+	Path     string // Application path (e.g., "/Applications/Microsoft Excel.app"), or the .desktop file on Linux
 }
 
 // Platform abstracts OS-specific operations for file handling
@@ -12,6 +18,12 @@ type Platform interface {
 	// GetDefaultApp returns the default application for a given file extension
 	GetDefaultApp(ext string) (AppInfo, error)
 
+	// ListApps returns every application registered to open a given file extension
+	ListApps(ext string) ([]AppInfo, error)
+
+	// SetDefaultApp makes app the system-wide default for a given file extension
+	SetDefaultApp(ext string, app AppInfo) error
+
 	// OpenWithDefault opens a file with its default application
 	OpenWithDefault(path string) error
 
@@ -21,5 +33,34 @@ type Platform interface {
 
 // New returns a Platform implementation for the current OS
 func New() Platform {
-	return newDarwinPlatform()
+	return newPlatform()
+}
+
+// validatePath ensures a path is safe for command execution
+// Returns the cleaned absolute path and an error if validation fails
+func validatePath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty path")
+	}
+
+	// Get absolute path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+
+	// Clean the path to remove any . or .. components
+	cleanPath := filepath.Clean(absPath)
+
+	// Ensure the path doesn't contain null bytes or other control characters
+	for _, r := range cleanPath {
+		if r < 32 || r == 127 {
+			return "", fmt.Errorf("path contains invalid characters")
+		}
+	}
+
+	return cleanPath, nil
 }
+
+// extensionPattern validates file extensions (alphanumeric only)
+var extensionPattern = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
@@ -0,0 +1,39 @@
+//go:build !darwin && !linux
+
+package platform
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// unsupportedPlatform keeps the host building on operating systems we don't
+// support yet. Every operation fails with a descriptive error.
+type unsupportedPlatform struct{}
+
+// Tools are the commands this platform runs to look up and open apps
+var Tools []string
+
+func newPlatform() Platform {
+	return unsupportedPlatform{}
+}
+
+func (unsupportedPlatform) GetDefaultApp(ext string) (AppInfo, error) {
+	return AppInfo{}, fmt.Errorf("%s is not supported", runtime.GOOS)
+}
+
+func (unsupportedPlatform) ListApps(ext string) ([]AppInfo, error) {
+	return nil, fmt.Errorf("%s is not supported", runtime.GOOS)
+}
+
+func (unsupportedPlatform) SetDefaultApp(ext string, app AppInfo) error {
+	return fmt.Errorf("%s is not supported", runtime.GOOS)
+}
+
+func (unsupportedPlatform) OpenWithDefault(path string) error {
+	return fmt.Errorf("%s is not supported", runtime.GOOS)
+}
+
+func (unsupportedPlatform) OpenWith(path string, appPath string) error {
+	return fmt.Errorf("%s is not supported", runtime.GOOS)
+}
@@ -0,0 +1,243 @@
+// Package policy holds the user's security settings for the native host,
+// read from a JSON file in the host's config directory.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reclaim/openwith/internal/atomicfile"
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/version"
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// fileName is the policy file inside the host's config directory
+const fileName = "policy.json"
+
+// Action is what the host does when a file has active content
+type Action string
+
+const (
+	// Warn opens the file and reports what was found
+	Warn Action = "warn"
+	// Block refuses to open the file
+	Block Action = "block"
+)
+
+// Policy is the host's security configuration
+type Policy struct {
+	// ActiveContent applies to files with macros, embedded objects,
+	// external references or other content that can run code
+	ActiveContent Action `json:"activeContent"`
+
+	// Callers are the extensions, besides the store build, that may use
+	// the host, such as unpacked development builds
+	Callers []Caller `json:"callers,omitempty"`
+}
+
+// Caller grants an extension access to the host
+type Caller struct {
+	// Origin is the extension's origin, e.g. "chrome-extension://<id>/",
+	// or "firefox-extension://<add-on id>/" for Firefox
+	Origin string `json:"origin"`
+	// Actions the extension may use. When empty it may use every action
+	// but the restricted ones; "*" allows everything.
+	Actions []string `json:"actions,omitempty"`
+}
+
+// AllActions in a caller's Actions allows every action
+const AllActions = "*"
+
+// RestrictedActions change the system or write to disk, so a caller only
+// gets them when its policy entry lists them
+var RestrictedActions = []string{"setSystemDefault", "writeFile"}
+
+// Default returns the policy used when no file is saved
+func Default() Policy {
+	return Policy{ActiveContent: Warn}
+}
+
+// DefaultPath returns the policy file under the user config dir
+// (e.g. ~/.config/reclaim-openwith/policy.json)
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "reclaim-openwith", fileName), nil
+}
+
+// Load reads the policy saved at path. A missing file is the default
+// policy, and settings the file leaves out keep their defaults.
+func Load(path string) (Policy, error) {
+	p := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read policy: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+
+	return p, nil
+}
+
+// Save writes p to path, creating its directory, for the host to load on
+// its next start
+func (p Policy) Save(path string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode policy: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create policy directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to save policy: %w", err)
+	}
+	return nil
+}
+
+// Validate reports settings with unknown values
+func (p Policy) Validate() error {
+	switch p.ActiveContent {
+	case Warn, Block:
+	default:
+		return fmt.Errorf("invalid activeContent policy %q (want %q or %q)", p.ActiveContent, Warn, Block)
+	}
+
+	for i, c := range p.Callers {
+		if c.Origin == "" {
+			return fmt.Errorf("caller %d has no origin", i+1)
+		}
+		for _, action := range c.Actions {
+			if action == "" {
+				return fmt.Errorf("caller %s has an empty action", c.Origin)
+			}
+		}
+	}
+	return nil
+}
+
+// StoreOrigin returns the origin of the store build of the extension, or
+// "" if this host was built without its ID
+func StoreOrigin() string {
+	if version.ExtensionID == "" {
+		return ""
+	}
+	return caller.ChromeOrigin(version.ExtensionID)
+}
+
+// StoreOrigins returns the origins of the published builds of the
+// extension, for Chrome and Firefox, that this host was built to know
+func StoreOrigins() []string {
+	var origins []string
+	if origin := StoreOrigin(); origin != "" {
+		origins = append(origins, origin)
+	}
+	if version.FirefoxExtensionID != "" {
+		origins = append(origins, caller.FirefoxOrigin(version.FirefoxExtensionID))
+	}
+	return origins
+}
+
+// Allows reports whether the extension with the given origin may use an
+// action. The first entry in Callers for the origin decides; the store
+// build and local socket clients need no entry and get every action but
+// the restricted ones. Unknown callers may use nothing. Any known caller
+// may open a stream, since the message it carries is checked once
+// reassembled, and cancel its own requests.
+func (p Policy) Allows(origin, action string) bool {
+	c, ok := p.caller(origin)
+	if ok && (nativehost.IsStreamAction(action) || action == nativehost.ActionCancel) {
+		return true
+	}
+	return ok && c.allows(action)
+}
+
+// Allow adds a Callers entry for origin with the default actions, unless
+// the extension is already known. It reports whether p changed.
+func (p *Policy) Allow(origin string) bool {
+	if p.Known(origin) {
+		return false
+	}
+	p.Callers = append(p.Callers, Caller{Origin: origin})
+	return true
+}
+
+// Known reports whether the extension with the given origin may use the
+// host at all
+func (p Policy) Known(origin string) bool {
+	_, ok := p.caller(origin)
+	return ok
+}
+
+// Entry returns the Callers entry that decides what the extension with the
+// given origin may do, if there is one
+func (p Policy) Entry(origin string) (Caller, bool) {
+	if origin == "" {
+		return Caller{}, false
+	}
+	for _, c := range p.Callers {
+		if sameOrigin(c.Origin, origin) {
+			return c, true
+		}
+	}
+	return Caller{}, false
+}
+
+// caller returns the rules for the extension with the given origin
+func (p Policy) caller(origin string) (Caller, bool) {
+	if origin == "" {
+		return Caller{}, false
+	}
+	if c, ok := p.Entry(origin); ok {
+		return c, true
+	}
+	for _, trusted := range StoreOrigins() {
+		if sameOrigin(trusted, origin) {
+			return Caller{Origin: trusted}, true
+		}
+	}
+	if origin == caller.SocketOrigin {
+		return Caller{Origin: origin}, true
+	}
+	return Caller{}, false
+}
+
+func (c Caller) allows(action string) bool {
+	if len(c.Actions) == 0 {
+		for _, restricted := range RestrictedActions {
+			if action == restricted {
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range c.Actions {
+		if a == AllActions || a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin compares origins, ignoring a trailing slash that hand-written
+// policy files may leave off
+func sameOrigin(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
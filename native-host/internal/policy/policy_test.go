@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/reclaim/openwith/internal/caller"
+	"github.com/reclaim/openwith/internal/version"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	p, err := Load(filepath.Join(t.TempDir(), "missing", fileName))
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !reflect.DeepEqual(p, Default()) {
+		t.Errorf("Load() = %+v, want default %+v", p, Default())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Action
+		wantErr bool
+	}{
+		{"block", `{"activeContent": "block"}`, Block, false},
+		{"warn", `{"activeContent": "warn"}`, Warn, false},
+		{"unset keeps default", `{}`, Warn, false},
+		{"unknown action", `{"activeContent": "allow"}`, "", true},
+		{"callers", `{"callers": [{"origin": "chrome-extension://dev/", "actions": ["*"]}]}`, Warn, false},
+		{"caller without origin", `{"callers": [{"actions": ["open"]}]}`, "", true},
+		{"corrupt", `{not json`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), fileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			p, err := Load(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Load() expected error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			if p.ActiveContent != tt.want {
+				t.Errorf("ActiveContent = %q, want %q", p.ActiveContent, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowAndSave(t *testing.T) {
+	const dev = "chrome-extension://devdevdevdevdevdevdevdevdevdevdevd/"
+	path := filepath.Join(t.TempDir(), "reclaim-openwith", fileName)
+
+	p := Default()
+	p.ActiveContent = Block
+	if !p.Allow(dev) {
+		t.Fatal("Allow() didn't add a new caller")
+	}
+	if p.Allow(dev) || len(p.Callers) != 1 {
+		t.Errorf("Allow() added a known caller again: %+v", p.Callers)
+	}
+	if err := p.Save(path); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Load() = %+v, want %+v", got, p)
+	}
+	if !got.Allows(dev, "open") || got.Allows(dev, "writeFile") {
+		t.Error("Expected the new caller to get the default actions")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected file mode 0600, got %o", info.Mode().Perm())
+	}
+
+	bad := Policy{ActiveContent: "allow"}
+	if err := bad.Save(path); err == nil {
+		t.Error("Save() wrote an invalid policy")
+	}
+}
+
+func TestAllows(t *testing.T) {
+	const (
+		store = "chrome-extension://storestorestorestorestorestorestor/"
+		dev   = "chrome-extension://devdevdevdevdevdevdevdevdevdevdevd/"
+		other = "chrome-extension://otherotherotherotherotherotherot/"
+	)
+	saved, savedFirefox := version.ExtensionID, version.FirefoxExtensionID
+	version.ExtensionID = "storestorestorestorestorestorestor"
+	version.FirefoxExtensionID = "openwith@reclaim.app"
+	defer func() { version.ExtensionID, version.FirefoxExtensionID = saved, savedFirefox }()
+
+	p := Default()
+	p.Callers = []Caller{
+		{Origin: "chrome-extension://devdevdevdevdevdevdevdevdevdevdevd", Actions: []string{AllActions}},
+		{Origin: other, Actions: []string{"ping"}},
+	}
+
+	tests := []struct {
+		origin string
+		action string
+		want   bool
+	}{
+		{store, "open", true},
+		{store, "writeFile", false},
+		{store, "setSystemDefault", false},
+		{"firefox-extension://openwith@reclaim.app/", "open", true},
+		{"firefox-extension://openwith@reclaim.app/", "writeFile", false},
+		{"firefox-extension://other@reclaim.app/", "open", false},
+		{dev, "writeFile", true},
+		{dev, "setSystemDefault", true},
+		{other, "ping", true},
+		{other, "open", false},
+		{other, "streamBegin", true},
+		{other, "cancel", true},
+		{caller.SocketOrigin, "open", true},
+		{caller.SocketOrigin, "writeFile", false},
+		{"chrome-extension://unknownunknownunknownunknownunkn/", "ping", false},
+		{"chrome-extension://unknownunknownunknownunknownunkn/", "streamBegin", false},
+		{"chrome-extension://unknownunknownunknownunknownunkn/", "cancel", false},
+		{"", "ping", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.origin, tt.action); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.origin, tt.action, got, tt.want)
+		}
+	}
+
+	// An entry for the store origin overrides its defaults
+	p.Callers = []Caller{{Origin: store, Actions: []string{"writeFile"}}}
+	if !p.Allows(store, "writeFile") || p.Allows(store, "open") {
+		t.Error("Expected the store entry to replace the store defaults")
+	}
+
+	// Without a built-in ID only listed callers are known
+	version.ExtensionID = ""
+	if Default().Known(store) {
+		t.Error("Expected no store caller without an extension ID")
+	}
+}
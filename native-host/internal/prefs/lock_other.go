@@ -0,0 +1,9 @@
+//go:build !unix
+
+package prefs
+
+// lockDir is a no-op where the host doesn't run; a single process still
+// serializes its own changes through Store.mu
+func lockDir(dir string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package prefs
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockDir takes an exclusive lock on dir, waiting for any other process
+// holding it, and returns a func that releases it. Locking the directory
+// rather than a file in it leaves nothing behind.
+func lockDir(dir string) (func(), error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,218 @@
+// Package prefs persists the user's preferred application per file type,
+// independent of the OS-wide default.
+package prefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/reclaim/openwith/internal/atomicfile"
+)
+
+// fileName is the preferences file inside the host's config directory
+const fileName = "preferences.json"
+
+// errCorrupt is returned by load for a file that isn't valid preferences
+var errCorrupt = errors.New("failed to parse preferences")
+
+// Preference records the application chosen for a file type
+type Preference struct {
+	AppID string `json:"appId"` // Bundle ID on macOS, desktop-file ID on Linux
+	Name  string `json:"name"`  // Display name at the time it was chosen
+}
+
+// Store holds preferences keyed by file extension and saves every change
+// to disk. Several hosts can share the file: reads pick up changes other
+// processes have saved, and each change is made to the latest saved copy
+// under a lock. A nil *Store has no preferences and cannot be changed.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	prefs map[string]Preference
+	saved os.FileInfo // The file prefs was read from, nil if there was none
+}
+
+// DefaultPath returns the preferences file under the user config dir
+// (e.g. ~/.config/reclaim-openwith/preferences.json)
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "reclaim-openwith", fileName), nil
+}
+
+// New returns an empty store that saves to path
+func New(path string) *Store {
+	return &Store{path: path, prefs: make(map[string]Preference)}
+}
+
+// Open loads the store saved at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := New(path)
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the saved file into the store. A missing file is an empty
+// store. Callers must hold s.mu.
+func (s *Store) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		s.prefs, s.saved = make(map[string]Preference), nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read preferences: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read preferences: %w", err)
+	}
+	prefs := make(map[string]Preference)
+	if err := json.NewDecoder(f).Decode(&prefs); err != nil {
+		return fmt.Errorf("%w: %v", errCorrupt, err)
+	}
+	if prefs == nil {
+		prefs = make(map[string]Preference)
+	}
+	s.prefs, s.saved = prefs, info
+	return nil
+}
+
+// refresh reloads the store if another process has saved the file since it
+// was read. Every save replaces the file, so a different file, size or
+// modification time means it changed. If it can't be read, the copy in
+// memory is kept. Callers must hold s.mu.
+func (s *Store) refresh() {
+	info, err := os.Stat(s.path)
+	switch {
+	case os.IsNotExist(err):
+		if s.saved == nil {
+			return
+		}
+	case err != nil:
+		return
+	case s.saved != nil && os.SameFile(info, s.saved) &&
+		info.Size() == s.saved.Size() && info.ModTime().Equal(s.saved.ModTime()):
+		return
+	}
+	_ = s.load()
+}
+
+// Get returns the preference for a file extension
+func (s *Store) Get(ext string) (Preference, bool) {
+	if s == nil {
+		return Preference{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+	pref, ok := s.prefs[ext]
+	return pref, ok
+}
+
+// All returns a copy of every preference, by file extension
+func (s *Store) All() map[string]Preference {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+	all := make(map[string]Preference, len(s.prefs))
+	for ext, pref := range s.prefs {
+		all[ext] = pref
+	}
+	return all
+}
+
+// Set records the preference for a file extension and saves the store
+func (s *Store) Set(ext string, pref Preference) error {
+	if s == nil {
+		return fmt.Errorf("no preferences store")
+	}
+	return s.update(func(prefs map[string]Preference) bool {
+		prefs[ext] = pref
+		return true
+	})
+}
+
+// Clear removes the preference for a file extension and saves the store.
+// Clearing a type without a preference is not an error.
+func (s *Store) Clear(ext string) error {
+	if s == nil {
+		return fmt.Errorf("no preferences store")
+	}
+	return s.update(func(prefs map[string]Preference) bool {
+		if _, ok := prefs[ext]; !ok {
+			return false
+		}
+		delete(prefs, ext)
+		return true
+	})
+}
+
+// update applies change to the latest saved preferences and saves them if
+// change reports that it changed something. The file is locked throughout,
+// so changes from other processes aren't lost. A file that can't be parsed
+// is replaced, as it is when the host starts.
+func (s *Store) update(change func(map[string]Preference) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	unlock, err := lockDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to lock preferences: %w", err)
+	}
+	defer unlock()
+
+	if err := s.load(); errors.Is(err, errCorrupt) {
+		s.prefs, s.saved = make(map[string]Preference), nil
+	} else if err != nil {
+		return err
+	}
+
+	// Change a copy, so memory stays in sync with what's on disk if the
+	// save fails
+	prefs := make(map[string]Preference, len(s.prefs)+1)
+	for ext, pref := range s.prefs {
+		prefs[ext] = pref
+	}
+	if !change(prefs) {
+		return nil
+	}
+	if err := s.save(prefs); err != nil {
+		return err
+	}
+	s.prefs = prefs
+	s.saved, _ = os.Stat(s.path)
+	return nil
+}
+
+// save writes prefs atomically, so a crash never leaves a truncated
+// file. Callers must hold s.mu and the directory lock.
+func (s *Store) save(prefs map[string]Preference) error {
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode preferences: %w", err)
+	}
+	if err := atomicfile.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package prefs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen_MissingFile(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "missing", fileName))
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if _, ok := s.Get("xlsx"); ok {
+		t.Error("Expected empty store")
+	}
+}
+
+func TestOpen_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), fileName)
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := Open(path); err == nil {
+		t.Error("Open() expected error for corrupt file, got nil")
+	}
+}
+
+func TestSetPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reclaim-openwith", fileName)
+	s := New(path)
+
+	if err := s.Set("xlsx", Preference{AppID: "org.gnome.Gnumeric.desktop", Name: "Gnumeric"}); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if err := s.Set("docx", Preference{AppID: "libreoffice-writer.desktop", Name: "LibreOffice Writer"}); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Preferences file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected file mode 0600, got %o", info.Mode().Perm())
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	pref, ok := reopened.Get("xlsx")
+	if !ok || pref.AppID != "org.gnome.Gnumeric.desktop" || pref.Name != "Gnumeric" {
+		t.Errorf("Get(xlsx) = %+v, %v after reopen", pref, ok)
+	}
+	if _, ok := reopened.Get("docx"); !ok {
+		t.Error("Expected docx preference after reopen")
+	}
+	if all := reopened.All(); len(all) != 2 || all["docx"].Name != "LibreOffice Writer" {
+		t.Errorf("All() = %+v", all)
+	}
+
+	// No temp files left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the preferences file, found %d entries", len(entries))
+	}
+}
+
+func TestClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), fileName)
+	s := New(path)
+
+	if err := s.Clear("pdf"); err != nil {
+		t.Errorf("Clear() of unset type error: %v", err)
+	}
+
+	if err := s.Set("pdf", Preference{AppID: "com.adobe.Reader", Name: "Adobe Acrobat Reader"}); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if err := s.Clear("pdf"); err != nil {
+		t.Fatalf("Clear() error: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if _, ok := reopened.Get("pdf"); ok {
+		t.Error("Expected pdf preference to be cleared on disk")
+	}
+}
+
+func TestSetFailureKeepsState(t *testing.T) {
+	// A file where the config directory should be makes saving fail
+	parent := filepath.Join(t.TempDir(), "blocked")
+	if err := os.WriteFile(parent, nil, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	s := New(filepath.Join(parent, fileName))
+
+	if err := s.Set("txt", Preference{AppID: "code.desktop"}); err == nil {
+		t.Fatal("Set() expected error, got nil")
+	}
+	if _, ok := s.Get("txt"); ok {
+		t.Error("Expected failed Set() not to change the store")
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var s *Store
+	if _, ok := s.Get("xlsx"); ok {
+		t.Error("Expected nil store to have no preferences")
+	}
+	if err := s.Set("xlsx", Preference{}); err == nil {
+		t.Error("Expected Set() on nil store to fail")
+	}
+	if all := s.All(); all != nil {
+		t.Errorf("All() = %+v on nil store", all)
+	}
+}
+
+func TestSharedFile(t *testing.T) {
+	// Two hosts with the same file, as Chrome and serve --socket have
+	path := filepath.Join(t.TempDir(), fileName)
+	a, b := New(path), New(path)
+
+	if err := a.Set("xlsx", Preference{AppID: "org.gnome.Gnumeric.desktop"}); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if err := b.Set("docx", Preference{AppID: "libreoffice-writer.desktop"}); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+
+	// b saved on top of a's change rather than over it, and a sees b's
+	if _, ok := b.Get("xlsx"); !ok {
+		t.Error("Expected b to see a's preference")
+	}
+	if _, ok := a.Get("docx"); !ok {
+		t.Error("Expected a to see b's preference")
+	}
+
+	if err := a.Clear("docx"); err != nil {
+		t.Fatalf("Clear() error: %v", err)
+	}
+	if all := b.All(); len(all) != 1 || all["xlsx"].AppID != "org.gnome.Gnumeric.desktop" {
+		t.Errorf("All() = %+v after a cleared docx", all)
+	}
+}
+
+func TestSetReplacesCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), fileName)
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	s := New(path)
+	if err := s.Set("pdf", Preference{AppID: "org.gnome.Evince.desktop"}); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if reopened, err := Open(path); err != nil {
+		t.Errorf("Open() error after Set(): %v", err)
+	} else if _, ok := reopened.Get("pdf"); !ok {
+		t.Error("Expected pdf preference after Set()")
+	}
+}
@@ -0,0 +1,283 @@
+package scan
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Variables so tests can lower them
+var (
+	// maxPartSize caps how much of one XML part is decompressed
+	maxPartSize int64 = 32 * 1024 * 1024
+	// maxScanSize caps the total decompressed across all parts, so a ZIP
+	// bomb can't stall the host
+	maxScanSize int64 = 128 * 1024 * 1024
+)
+
+// ddeFormula matches a DDE call in a spreadsheet formula: app|'topic'!item,
+// e.g. cmd|' /c calc'!A0
+var ddeFormula = regexp.MustCompile(`[A-Za-z0-9_.]+\s*\|\s*'[^']*'\s*!`)
+
+// ooxmlScanner walks one OOXML package
+type ooxmlScanner struct {
+	findings []Finding
+	budget   int64 // Bytes left to decompress
+}
+
+// scanOOXML looks for active content in an OOXML package
+// (xlsx, docx, pptx)
+func scanOOXML(name string) ([]Finding, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %w", err)
+	}
+	defer zr.Close()
+
+	s := &ooxmlScanner{budget: maxScanSize}
+	for _, zf := range zr.File {
+		if err := s.scanPart(zf); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", zf.Name, err)
+		}
+	}
+	return s.findings, nil
+}
+
+func (s *ooxmlScanner) add(kind Kind, part, detail string) {
+	s.findings = append(s.findings, Finding{Kind: kind, Part: part, Detail: detail})
+}
+
+// scanPart checks one ZIP entry by name and, for the parts that can hold
+// references or fields, by content
+func (s *ooxmlScanner) scanPart(zf *zip.File) error {
+	name := zf.Name
+	lower := strings.ToLower(name)
+	base := path.Base(lower)
+	dir := path.Base(path.Dir(lower))
+
+	switch {
+	case strings.HasPrefix(base, "vbaproject") && strings.HasSuffix(base, ".bin"):
+		s.add(KindMacros, name, "")
+	case dir == "activex":
+		if !strings.HasSuffix(base, ".rels") {
+			s.add(KindActiveX, name, "")
+		}
+	case dir == "embeddings":
+		switch path.Ext(base) {
+		case ".docm", ".xlsm", ".pptm", ".xlsb":
+			s.add(KindMacros, name, "embedded document")
+		case ".bin":
+			s.add(KindOLEObject, name, "")
+		}
+	}
+
+	switch {
+	case lower == "[content_types].xml":
+		return s.withPart(zf, s.scanContentTypes)
+	case strings.HasSuffix(lower, ".rels"):
+		return s.withPart(zf, s.scanRelationships)
+	case strings.HasPrefix(lower, "word/") && strings.HasSuffix(lower, ".xml"):
+		return s.withPart(zf, s.scanFields)
+	case strings.HasPrefix(lower, "xl/worksheets/") && strings.HasSuffix(lower, ".xml"):
+		return s.withPart(zf, s.scanFormulas)
+	case strings.HasPrefix(lower, "xl/externallinks/") && strings.HasSuffix(lower, ".xml"):
+		return s.withPart(zf, s.scanExternalLink)
+	}
+	return nil
+}
+
+// withPart decompresses a part within the size limits and hands an XML
+// decoder for it to scanFn. A part that is cut short by the limits, or
+// isn't well-formed, is reported as incomplete: whatever follows could
+// hold active content the scan didn't see.
+func (s *ooxmlScanner) withPart(zf *zip.File, scanFn func(part string, d *xml.Decoder) error) error {
+	if s.budget <= 0 {
+		s.add(KindIncomplete, zf.Name, "too much content to scan")
+		return nil
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	limit := maxPartSize
+	if s.budget < limit {
+		limit = s.budget
+	}
+	counter := &countingReader{r: io.LimitReader(rc, limit)}
+	defer func() { s.budget -= counter.n }()
+
+	d := xml.NewDecoder(counter)
+	d.Strict = false
+	err = scanFn(zf.Name, d)
+	if counter.n >= limit {
+		s.add(KindIncomplete, zf.Name, "too large to scan")
+		return nil
+	}
+	if err == io.EOF {
+		return nil
+	}
+	if _, ok := err.(*xml.SyntaxError); ok || err == io.ErrUnexpectedEOF {
+		s.add(KindIncomplete, zf.Name, "malformed XML")
+		return nil
+	}
+	return err
+}
+
+// scanContentTypes flags part content types that mark macros, ActiveX
+// controls and OLE objects. Default (per-extension) entries are skipped:
+// they declare a type without saying any part uses it.
+func (s *ooxmlScanner) scanContentTypes(_ string, d *xml.Decoder) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Override" {
+			continue
+		}
+
+		part := strings.TrimPrefix(attr(start, "PartName"), "/")
+		contentType := strings.ToLower(attr(start, "ContentType"))
+		switch {
+		case strings.Contains(contentType, "macroenabled"),
+			strings.Contains(contentType, "vbaproject"),
+			strings.Contains(contentType, "macrosheet"):
+			s.add(KindMacros, part, "")
+		case strings.Contains(contentType, "activex"):
+			s.add(KindActiveX, part, "")
+		case strings.Contains(contentType, "oleobject"):
+			s.add(KindOLEObject, part, "")
+		}
+	}
+}
+
+// scanRelationships flags relationships whose target is outside the
+// package. Hyperlinks are only followed when clicked, so they're skipped.
+func (s *ooxmlScanner) scanRelationships(part string, d *xml.Decoder) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Relationship" {
+			continue
+		}
+		if !strings.EqualFold(attr(start, "TargetMode"), "External") {
+			continue
+		}
+		relType := path.Base(attr(start, "Type"))
+		if relType == "hyperlink" {
+			continue
+		}
+		s.add(KindExternalRelationship, part, relType+": "+attr(start, "Target"))
+	}
+}
+
+// scanFields flags DDE and DDEAUTO field codes in Word parts. A field's
+// instruction can be split across several runs, so instrText is collected
+// from the field's begin marker to its separate or end marker.
+func (s *ooxmlScanner) scanFields(part string, d *xml.Decoder) error {
+	var instr strings.Builder
+	inInstr := false
+	check := func(code string) {
+		fields := strings.Fields(strings.ToUpper(code))
+		if len(fields) > 0 && (fields[0] == "DDE" || fields[0] == "DDEAUTO") {
+			s.add(KindDDE, part, strings.TrimSpace(code))
+		}
+	}
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			check(instr.String())
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "fldSimple":
+				check(attr(t, "instr"))
+			case "fldChar":
+				check(instr.String())
+				instr.Reset()
+			case "instrText":
+				inInstr = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "instrText" {
+				inInstr = false
+			}
+		case xml.CharData:
+			if inInstr {
+				instr.Write(t)
+			}
+		}
+	}
+}
+
+// scanFormulas flags DDE calls in worksheet formulas
+func (s *ooxmlScanner) scanFormulas(part string, d *xml.Decoder) error {
+	inFormula := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inFormula = t.Name.Local == "f"
+		case xml.EndElement:
+			inFormula = false
+		case xml.CharData:
+			if inFormula {
+				if match := ddeFormula.Find(t); match != nil {
+					s.add(KindDDE, part, string(match))
+				}
+			}
+		}
+	}
+}
+
+// scanExternalLink flags DDE links in workbook external link parts
+func (s *ooxmlScanner) scanExternalLink(part string, d *xml.Decoder) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if ok && start.Name.Local == "ddeLink" {
+			s.add(KindDDE, part, attr(start, "ddeService")+"|"+attr(start, "ddeTopic"))
+		}
+	}
+}
+
+// attr returns the value of the attribute with the given local name
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
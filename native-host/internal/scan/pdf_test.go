@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+)
+
+// deflate zlib-compresses s as a FlateDecode stream body
+func deflate(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// stream returns an indirect object holding a stream
+func stream(num int, dict, body string) string {
+	return fmt.Sprintf("%d 0 obj\n<< %s /Length %d >>\nstream\n%s\nendstream\nendobj\n", num, dict, len(body), body)
+}
+
+// writePDF wraps objects in a PDF header and trailer
+func writePDF(t *testing.T, objects ...string) string {
+	t.Helper()
+	content := "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n" +
+		"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\n" +
+		strings.Join(objects, "") +
+		"trailer\n<< /Root 1 0 R >>\n%%EOF\n"
+	path := filepath.Join(t.TempDir(), "doc.pdf")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScanPDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []string
+		want    []Finding
+	}{
+		{
+			name: "clean",
+			objects: []string{
+				stream(3, "/Filter /FlateDecode", deflate(t, "BT /F1 12 Tf (Hello) Tj ET")),
+			},
+			want: nil,
+		},
+		{
+			name: "open action javascript",
+			objects: []string{
+				"3 0 obj\n<< /Type /Catalog /OpenAction 4 0 R >>\nendobj\n",
+				"4 0 obj\n<< /S /JavaScript /JS (app.alert\\(1\\)) >>\nendobj\n",
+			},
+			want: []Finding{
+				{Kind: KindJavaScript, Part: "obj 4 0", Detail: "/JS"},
+				{Kind: KindJavaScript, Part: "obj 4 0", Detail: "/JavaScript"},
+				{Kind: KindOpenAction, Part: "obj 3 0", Detail: "/OpenAction"},
+			},
+		},
+		{
+			name: "hex-escaped names",
+			objects: []string{
+				"3 0 obj\n<< /S /J#61vaScript /J#53 5 0 R >>\nendobj\n",
+			},
+			want: []Finding{
+				{Kind: KindJavaScript, Part: "obj 3 0", Detail: "/JS"},
+				{Kind: KindJavaScript, Part: "obj 3 0", Detail: "/JavaScript"},
+			},
+		},
+		{
+			name: "launch in compressed object stream",
+			objects: []string{
+				stream(3, "/Type /ObjStm /N 1 /First 5 /Filter /FlateDecode",
+					deflate(t, "4 0 << /S /Launch /F (cmd.exe) >>")),
+			},
+			want: []Finding{
+				{Kind: KindLaunch, Part: "obj 3 0", Detail: "/Launch in object stream"},
+			},
+		},
+		{
+			name: "attachments, rich media and forms",
+			objects: []string{
+				"3 0 obj\n<< /Names << /EmbeddedFiles 4 0 R >> /AcroForm << /XFA 6 0 R >> >>\nendobj\n",
+				stream(4, "/Type /EmbeddedFile", "MZ\x90\x00"),
+				"5 0 obj\n<< /Subtype /RichMedia >>\nendobj\n",
+			},
+			want: []Finding{
+				{Kind: KindEmbeddedFile, Part: "obj 3 0", Detail: "/EmbeddedFiles"},
+				{Kind: KindEmbeddedFile, Part: "obj 4 0", Detail: "/EmbeddedFile"},
+				{Kind: KindRichMedia, Part: "obj 5 0", Detail: "/RichMedia"},
+				{Kind: KindXFA, Part: "obj 3 0", Detail: "/XFA"},
+			},
+		},
+		{
+			name: "names inside ordinary stream data are ignored",
+			objects: []string{
+				stream(3, "/Filter /FlateDecode", deflate(t, "/JS /Launch")),
+				stream(4, "/Subtype /Image", "\x00\x01/JS \x02"),
+			},
+			want: nil,
+		},
+		{
+			name: "names that only start like a keyword",
+			objects: []string{
+				"3 0 obj\n<< /JSON true /Launcher 1 /XFAForm 2 >>\nendobj\n",
+			},
+			want: nil,
+		},
+	}
+
+	ft, _ := filetypes.Lookup("pdf")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := File(writePDF(t, tt.objects...), ft)
+			if err != nil {
+				t.Fatalf("File() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("File() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanPDF_MissingEndstream(t *testing.T) {
+	path := writePDF(t, "3 0 obj\n<< /Type /ObjStm /Filter /FlateDecode >>\nstream\n"+
+		deflate(t, "4 0 << /S /Launch >>"))
+	ft, _ := filetypes.Lookup("pdf")
+
+	got, err := File(path, ft)
+	if err != nil {
+		t.Fatalf("File() error: %v", err)
+	}
+	if len(got) != 1 || got[0].Kind != KindLaunch {
+		t.Errorf("File() = %+v, want a launch finding", got)
+	}
+}
+
+func TestPDFInflate_Budget(t *testing.T) {
+	s := &pdfScanner{budget: 1024}
+	raw := []byte(deflate(t, strings.Repeat("A", 1<<20)))
+
+	if got, complete := s.inflate(raw); len(got) != 1024 || complete {
+		t.Errorf("inflate() returned %d bytes, %v; want 1024, false", len(got), complete)
+	}
+	if s.budget != 0 {
+		t.Errorf("budget = %d, want 0", s.budget)
+	}
+	if got, complete := s.inflate(raw); len(got) != 0 || complete {
+		t.Errorf("inflate() with no budget returned %d bytes, %v", len(got), complete)
+	}
+
+	// A stream that fits exactly is complete
+	s = &pdfScanner{budget: 1024}
+	if got, complete := s.inflate([]byte(deflate(t, strings.Repeat("A", 1024)))); len(got) != 1024 || !complete {
+		t.Errorf("inflate() returned %d bytes, %v; want 1024, true", len(got), complete)
+	}
+}
+
+func TestScanPDF_Limits(t *testing.T) {
+	defer func(read, decoded int64) { maxPDFRead, maxPDFDecoded = read, decoded }(maxPDFRead, maxPDFDecoded)
+	ft, _ := filetypes.Lookup("pdf")
+
+	// Names past the read limit aren't seen, so the file is incomplete
+	path := writePDF(t, "%"+strings.Repeat(" ", 1024)+"\n3 0 obj\n<< /S /JavaScript >>\nendobj\n")
+	maxPDFRead = 1024
+	got, err := File(path, ft)
+	if err != nil {
+		t.Fatalf("File() error: %v", err)
+	}
+	want := []Finding{{Kind: KindIncomplete, Detail: "too large to scan"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("File() = %+v, want %+v", got, want)
+	}
+
+	// So is an object stream that decompresses past the budget
+	maxPDFRead, maxPDFDecoded = 128*1024*1024, 1024
+	path = writePDF(t, "3 0 obj\n<< /Type /ObjStm /Filter /FlateDecode >>\nstream\n"+
+		deflate(t, strings.Repeat(" ", 2048)+"4 0 << /S /Launch >>")+"\nendstream\nendobj\n")
+	got, err = File(path, ft)
+	if err != nil {
+		t.Fatalf("File() error: %v", err)
+	}
+	want = []Finding{{Kind: KindIncomplete, Part: "obj 3 0", Detail: "too much compressed content to scan"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("File() = %+v, want %+v", got, want)
+	}
+}
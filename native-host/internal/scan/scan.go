@@ -0,0 +1,123 @@
+// Package scan looks inside downloaded documents for content that can run
+// code or reach out to the network when the file is opened: macros,
+// ActiveX controls, embedded OLE objects, external references and DDE in
+// Office files, and JavaScript, launch actions and attachments in PDFs.
+// It only reports what it finds; what to do about it is up to the caller.
+package scan
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+)
+
+// Kind names a type of active content
+type Kind string
+
+const (
+	// KindMacros is VBA projects, macro-enabled parts and Excel 4.0 macro sheets
+	KindMacros Kind = "macros"
+	// KindActiveX is ActiveX controls
+	KindActiveX Kind = "activex"
+	// KindOLEObject is embedded OLE objects, which can carry executables
+	KindOLEObject Kind = "ole_object"
+	// KindExternalRelationship is a part loaded from outside the file, such
+	// as a remote template
+	KindExternalRelationship Kind = "external_relationship"
+	// KindDDE is Dynamic Data Exchange fields and formulas, which can run
+	// commands
+	KindDDE Kind = "dde"
+
+	// KindJavaScript is PDF JavaScript
+	KindJavaScript Kind = "javascript"
+	// KindLaunch is a PDF action that starts another program
+	KindLaunch Kind = "launch"
+	// KindOpenAction is a PDF action run when the document opens
+	KindOpenAction Kind = "open_action"
+	// KindEmbeddedFile is a file attached inside a PDF
+	KindEmbeddedFile Kind = "embedded_file"
+	// KindRichMedia is embedded Flash or video content
+	KindRichMedia Kind = "rich_media"
+	// KindXFA is an XML Forms Architecture form, which can carry script
+	KindXFA Kind = "xfa"
+
+	// KindIncomplete is content that wasn't fully scanned because it's too
+	// large or malformed, so active content in it could have been missed
+	KindIncomplete Kind = "incomplete"
+)
+
+// descriptions are the user-facing explanation of each kind
+var descriptions = map[Kind]string{
+	KindMacros:               "Contains macros",
+	KindActiveX:              "Contains ActiveX controls",
+	KindOLEObject:            "Contains embedded OLE objects",
+	KindExternalRelationship: "Loads content from an external location",
+	KindDDE:                  "Contains DDE fields that can run commands",
+	KindJavaScript:           "Contains JavaScript",
+	KindLaunch:               "Contains an action that starts another program",
+	KindOpenAction:           "Runs an action when opened",
+	KindEmbeddedFile:         "Contains embedded files",
+	KindRichMedia:            "Contains embedded Flash or video",
+	KindXFA:                  "Contains an XFA form",
+	KindIncomplete:           "Could not be fully checked for active content",
+}
+
+// Finding is one piece of active content
+type Finding struct {
+	Kind   Kind
+	Part   string // Where it was found, e.g. the ZIP entry name
+	Detail string // Extra context, e.g. an external target URL
+}
+
+// Description returns a user-facing summary of the finding
+func (f Finding) Description() string {
+	desc := descriptions[f.Kind]
+	if f.Detail != "" {
+		desc += fmt.Sprintf(" (%s)", f.Detail)
+	}
+	return desc
+}
+
+// File scans the file at path, which has already been checked to be of
+// type ft. Types with nothing to scan return no findings.
+func File(path string, ft filetypes.FileType) ([]Finding, error) {
+	var findings []Finding
+	var err error
+
+	switch ft.Content {
+	case filetypes.ContentOOXML:
+		findings, err = scanOOXML(path)
+	default:
+		if ft.Ext == "pdf" {
+			findings, err = scanPDF(path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sortFindings(findings), nil
+}
+
+// sortFindings orders findings by kind and part and drops duplicates, so
+// responses are stable
+func sortFindings(findings []Finding) []Finding {
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Kind != findings[j].Kind {
+			return findings[i].Kind < findings[j].Kind
+		}
+		if findings[i].Part != findings[j].Part {
+			return findings[i].Part < findings[j].Part
+		}
+		return findings[i].Detail < findings[j].Detail
+	})
+	out := findings[:0]
+	for i, f := range findings {
+		if i > 0 && f == findings[i-1] {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
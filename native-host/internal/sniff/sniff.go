@@ -0,0 +1,213 @@
+// Package sniff checks that a file's bytes match the type its extension
+// claims, so a renamed blob or an HTML error page saved as .xlsx is never
+// handed to the app registered for that extension.
+package sniff
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+)
+
+const (
+	// maxTextCheck is how much of a text file is checked for valid UTF-8
+	maxTextCheck = 1024 * 1024
+	// maxManifestSize caps how much of a ZIP manifest entry we decompress
+	maxManifestSize = 1024 * 1024
+)
+
+// utf8BOM is the byte order mark some editors write at the start of text files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// MismatchError reports content that doesn't match the file's extension
+type MismatchError struct {
+	Ext    string
+	Reason string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("content does not match .%s: %s", e.Ext, e.Reason)
+}
+
+// IsMismatch reports whether err is a *MismatchError
+func IsMismatch(err error) bool {
+	var mismatch *MismatchError
+	return errors.As(err, &mismatch)
+}
+
+// Check verifies the file at path against the registered type ft.
+// It returns a *MismatchError if the content doesn't match, or another
+// error if the file can't be read.
+func Check(path string, ft filetypes.FileType) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	mismatch := func(format string, args ...interface{}) error {
+		return &MismatchError{Ext: ft.Ext, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	switch ft.Content {
+	case filetypes.ContentMagic:
+		head, err := readHead(f, 64)
+		if err != nil {
+			return err
+		}
+		if !hasMagic(head, ft.Magic) {
+			return mismatch("unexpected file header")
+		}
+		return nil
+
+	case filetypes.ContentText:
+		head, err := readHead(f, maxTextCheck)
+		if err != nil {
+			return err
+		}
+		// A file cut at the limit may end mid-character
+		if len(head) == maxTextCheck {
+			head = trimPartialRune(head)
+		}
+		if !utf8.Valid(head) || bytes.IndexByte(head, 0) >= 0 {
+			return mismatch("not UTF-8 text")
+		}
+		if len(ft.Magic) > 0 {
+			body := bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+			if !hasMagic(body, ft.Magic) {
+				return mismatch("unexpected file header")
+			}
+		}
+		return nil
+
+	case filetypes.ContentOOXML, filetypes.ContentZIPMimetype:
+		head, err := readHead(f, 4)
+		if err != nil {
+			return err
+		}
+		if !hasMagic(head, ft.Magic) {
+			return mismatch("not a ZIP container")
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return mismatch("corrupt ZIP container")
+		}
+		if ft.Content == filetypes.ContentOOXML {
+			return checkContentTypes(zr, ft, mismatch)
+		}
+		return checkMimetype(zr, ft, mismatch)
+	}
+
+	return fmt.Errorf("no content check for .%s", ft.Ext)
+}
+
+// readHead reads up to n bytes from the start of r
+func readHead(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// hasMagic reports whether data starts with one of the signatures
+func hasMagic(data []byte, magic [][]byte) bool {
+	for _, m := range magic {
+		if bytes.HasPrefix(data, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+// readEntry decompresses a ZIP entry by name, up to maxManifestSize
+func readEntry(zr *zip.Reader, name string) ([]byte, bool, error) {
+	for _, zf := range zr.File {
+		if zf.Name != name {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, true, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxManifestSize))
+		return data, true, err
+	}
+	return nil, false, nil
+}
+
+// contentTypes is the part of [Content_Types].xml we need
+type contentTypes struct {
+	Overrides []struct {
+		PartName    string `xml:"PartName,attr"`
+		ContentType string `xml:"ContentType,attr"`
+	} `xml:"Override"`
+}
+
+// checkContentTypes requires [Content_Types].xml to declare one of the
+// type's main part content types
+func checkContentTypes(zr *zip.Reader, ft filetypes.FileType, mismatch func(string, ...interface{}) error) error {
+	data, found, err := readEntry(zr, "[Content_Types].xml")
+	if !found {
+		return mismatch("missing [Content_Types].xml")
+	}
+	if err != nil {
+		return mismatch("unreadable [Content_Types].xml")
+	}
+
+	var types contentTypes
+	if err := xml.Unmarshal(data, &types); err != nil {
+		return mismatch("malformed [Content_Types].xml")
+	}
+	for _, override := range types.Overrides {
+		for _, want := range ft.ContentTypes {
+			if strings.EqualFold(strings.TrimSpace(override.ContentType), want) {
+				return nil
+			}
+		}
+	}
+	return mismatch("[Content_Types].xml does not declare a .%s document", ft.Ext)
+}
+
+// checkMimetype requires the "mimetype" entry to hold the canonical MIME type
+func checkMimetype(zr *zip.Reader, ft filetypes.FileType, mismatch func(string, ...interface{}) error) error {
+	data, found, err := readEntry(zr, "mimetype")
+	if !found {
+		return mismatch("missing mimetype entry")
+	}
+	if err != nil {
+		return mismatch("unreadable mimetype entry")
+	}
+	if got := strings.TrimSpace(string(data)); got != ft.MIMEType() {
+		return mismatch("mimetype entry is %q", got)
+	}
+	return nil
+}
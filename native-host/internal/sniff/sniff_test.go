@@ -0,0 +1,132 @@
+package sniff
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reclaim/openwith/internal/filetypes"
+)
+
+// zipFile builds a ZIP archive from name/content pairs
+func zipFile(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func contentTypesXML(types ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="xml" ContentType="application/xml"/>
+`)
+	for _, ct := range types {
+		b.WriteString(`<Override PartName="/main.xml" ContentType="` + ct + `"/>` + "\n")
+	}
+	b.WriteString("</Types>")
+	return b.String()
+}
+
+const (
+	xlsxMain = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"
+	xlsmMain = "application/vnd.ms-excel.sheet.macroEnabled.main+xml"
+	docxMain = "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		ext      string
+		content  []byte
+		mismatch bool
+	}{
+		{"pdf", "pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), false},
+		{"pdf html page", "pdf", []byte("<!DOCTYPE html>"), true},
+		{"pdf empty", "pdf", nil, true},
+		{"png", "png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), false},
+		{"png as jpg", "jpg", []byte("\x89PNG\r\n\x1a\n"), true},
+		{"rtf", "rtf", []byte(`{\rtf1\ansi Hello}`), false},
+
+		{"txt", "txt", []byte("héllo wörld\n"), false},
+		{"txt empty", "txt", nil, false},
+		{"txt with BOM", "txt", []byte("\xef\xbb\xbfhello"), false},
+		{"txt invalid UTF-8", "txt", []byte("caf\xe9"), true},
+		{"txt binary", "txt", []byte("ab\x00cd"), true},
+		{"csv", "csv", []byte("a,b\n1,2\n"), false},
+		{"ics", "ics", []byte("\xef\xbb\xbf\r\nBEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), false},
+		{"ics not a calendar", "ics", []byte("BEGIN:VCARD\r\n"), true},
+
+		{"xlsx", "xlsx", zipFile(t, "[Content_Types].xml", contentTypesXML(xlsxMain)), false},
+		{"xlsx macro-enabled", "xlsx", zipFile(t, "[Content_Types].xml", contentTypesXML(xlsmMain)), false},
+		{"docx as xlsx", "xlsx", zipFile(t, "[Content_Types].xml", contentTypesXML(docxMain)), true},
+		{"xlsx without manifest", "xlsx", zipFile(t, "xl/workbook.xml", "<workbook/>"), true},
+		{"xlsx malformed manifest", "xlsx", zipFile(t, "[Content_Types].xml", "<Types"), true},
+		{"xlsx html page", "xlsx", []byte("<!DOCTYPE html><html><body>Sign in</body></html>"), true},
+		{"xlsx truncated zip", "xlsx", []byte("PK\x03\x04garbage"), true},
+
+		{"odt", "odt", zipFile(t, "mimetype", "application/vnd.oasis.opendocument.text"), false},
+		{"ods as odt", "odt", zipFile(t, "mimetype", "application/vnd.oasis.opendocument.spreadsheet"), true},
+		{"epub", "epub", zipFile(t, "mimetype", "application/epub+zip\n"), false},
+		{"epub without mimetype", "epub", zipFile(t, "content.opf", ""), true},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft, ok := filetypes.Lookup(tt.ext)
+			if !ok {
+				t.Fatalf("%s not registered", tt.ext)
+			}
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+"."+tt.ext)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Check(path, ft)
+			if tt.mismatch && !IsMismatch(err) {
+				t.Errorf("Check() = %v, want mismatch", err)
+			}
+			if !tt.mismatch && err != nil {
+				t.Errorf("Check() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestCheck_TextLimit(t *testing.T) {
+	ft, _ := filetypes.Lookup("txt")
+	dir := t.TempDir()
+
+	// A multi-byte character split by the read limit is not an error
+	content := append(bytes.Repeat([]byte("a"), maxTextCheck-1), "é"...)
+	path := filepath.Join(dir, "long.txt")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(path, ft); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+}
+
+func TestCheck_MissingFile(t *testing.T) {
+	ft, _ := filetypes.Lookup("pdf")
+	err := Check(filepath.Join(t.TempDir(), "missing.pdf"), ft)
+	if err == nil || IsMismatch(err) {
+		t.Errorf("Check() = %v, want a read error", err)
+	}
+}
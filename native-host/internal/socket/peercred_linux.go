@@ -0,0 +1,33 @@
+//go:build linux
+
+package socket
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredSupported is true where PeerUID works
+const peerCredSupported = true
+
+// PeerUID returns the user ID of the process at the other end of conn,
+// from SO_PEERCRED
+func PeerUID(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return -1, err
+	}
+	if credErr != nil {
+		return -1, credErr
+	}
+	return int(cred.Uid), nil
+}
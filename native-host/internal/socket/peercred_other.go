@@ -0,0 +1,12 @@
+//go:build !linux
+
+package socket
+
+import "net"
+
+const peerCredSupported = false
+
+// PeerUID isn't implemented here, so every connection is refused
+func PeerUID(conn *net.UnixConn) (int, error) {
+	return -1, ErrUnsupported
+}
@@ -0,0 +1,198 @@
+// Package socket serves the host over a Unix domain socket, for local
+// clients that aren't browsers, such as editor extensions and scripts.
+// Only processes running as the same user may connect.
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileName is the socket inside the default directory
+const fileName = "reclaim-openwith.sock"
+
+// dialTimeout is how long Listen waits when checking whether an existing
+// socket is still being served
+const dialTimeout = time.Second
+
+// maxAcceptDelay caps how long Serve waits before accepting again after a
+// temporary error, such as running out of file descriptors
+const maxAcceptDelay = time.Second
+
+// ErrUnsupported is returned on platforms where the host can't tell who is
+// connecting
+var ErrUnsupported = errors.New("peer credentials aren't supported on this platform")
+
+// DefaultPath returns the socket under the user's runtime directory, or
+// under the cache directory if there isn't one
+// (e.g. /run/user/1000/reclaim-openwith/reclaim-openwith.sock)
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("no runtime or cache directory: %w", err)
+		}
+		dir = cacheDir
+	}
+	return filepath.Join(dir, "reclaim-openwith", fileName), nil
+}
+
+// Listen creates a socket at path that only the current user can use. A
+// socket left behind by a host that has exited is replaced; one that is
+// still being served is an error.
+func Listen(path string) (*net.UnixListener, error) {
+	if !peerCredSupported {
+		return nil, ErrUnsupported
+	}
+	// The socket is created with the umask's permissions before it's
+	// restricted below, so the directory keeps other users out until then.
+	// One left by an older host or made by hand may be more open.
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict socket directory permissions: %w", err)
+	}
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// Serve closes the listener, which removes the socket
+	l.SetUnlinkOnClose(true)
+
+	// Connections from other users are refused anyway, but they shouldn't
+	// be able to connect at all
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return l, nil
+}
+
+// removeStale removes a socket at path that nothing is listening on
+func removeStale(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, dialTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("another host is already serving %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// peerUID is PeerUID, replaced in tests
+var peerUID = PeerUID
+
+// Serve accepts connections on l until ctx ends, then closes l and every
+// connection and waits for their serve calls to return. Each connection is
+// served on its own goroutine; those from another user are closed without
+// being served.
+func Serve(ctx context.Context, l *net.UnixListener, serve func(ctx context.Context, conn net.Conn)) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+	)
+
+	stop := context.AfterFunc(ctx, func() {
+		l.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for conn := range conns {
+			conn.Close()
+		}
+	})
+	defer stop()
+
+	var err error
+	var delay time.Duration
+	for {
+		var conn *net.UnixConn
+		conn, err = l.AcceptUnix()
+		if ne, ok := err.(net.Error); ok && ne.Temporary() && ctx.Err() == nil {
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else {
+				delay *= 2
+			}
+			if delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			log.Printf("Socket accept error: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		if err != nil {
+			break
+		}
+		delay = 0
+
+		if !sameUser(conn) {
+			conn.Close()
+			continue
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				conn.Close()
+			}()
+			serve(ctx, conn)
+		}()
+	}
+
+	l.Close()
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// sameUser reports whether conn comes from a process running as this user
+func sameUser(conn *net.UnixConn) bool {
+	uid, err := peerUID(conn)
+	if err != nil {
+		log.Printf("Refused socket connection: %v", err)
+		return false
+	}
+	if uid != os.Getuid() {
+		log.Printf("Refused socket connection from uid %d", uid)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+//go:build linux
+
+package socket
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// echo serves a connection by writing back each line it reads
+func echo(ctx context.Context, conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(line))
+	}
+}
+
+// serve listens at a new socket and serves it with echo until the test ends
+func serve(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), fileName)
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, l, echo) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error: %v", err)
+		}
+	})
+	return path
+}
+
+func roundTrip(t *testing.T, path, line string) (string, error) {
+	t.Helper()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial() error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(line)); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestServe(t *testing.T) {
+	path := serve(t)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected socket mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// Connections are served at the same time
+	first, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if got, err := roundTrip(t, path, "hello\n"); got != "hello\n" {
+		t.Errorf("Echo = %q, %v", got, err)
+	}
+}
+
+func TestServe_OtherUser(t *testing.T) {
+	peerUID = func(*net.UnixConn) (int, error) { return os.Getuid() + 1, nil }
+	defer func() { peerUID = PeerUID }()
+
+	path := serve(t)
+	if got, err := roundTrip(t, path, "hello\n"); err == nil {
+		t.Errorf("Expected the connection to be closed, got %q, %v", got, err)
+	}
+}
+
+func TestPeerUID(t *testing.T) {
+	a, b, err := socketPair(filepath.Join(t.TempDir(), fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	defer b.Close()
+
+	uid, err := PeerUID(a)
+	if err != nil {
+		t.Fatalf("PeerUID() error: %v", err)
+	}
+	if uid != os.Getuid() {
+		t.Errorf("PeerUID() = %d, want %d", uid, os.Getuid())
+	}
+}
+
+// socketPair returns both ends of a connection over a new socket
+func socketPair(path string) (*net.UnixConn, *net.UnixConn, error) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer l.Close()
+
+	client, err := net.DialUnix("unix", nil, l.Addr().(*net.UnixAddr))
+	if err != nil {
+		return nil, nil, err
+	}
+	server, err := l.AcceptUnix()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return server, client, nil
+}
+
+func TestListen_Stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), fileName)
+
+	// A socket nothing is listening on is replaced
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetUnlinkOnClose(false)
+	l.Close()
+	l2, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() over a stale socket: %v", err)
+	}
+	defer l2.Close()
+
+	// One that is still served is not
+	if l3, err := Listen(path); err == nil {
+		l3.Close()
+		t.Error("Expected an error listening on a socket that is in use")
+	}
+
+	// Nor is a file that isn't a socket
+	file := filepath.Join(t.TempDir(), "plain")
+	os.WriteFile(file, nil, 0600)
+	if _, err := Listen(file); err == nil {
+		t.Error("Expected an error listening over a regular file")
+	}
+}
+
+func TestListen_Permissions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen(filepath.Join(dir, fileName))
+	if err != nil {
+		t.Fatalf("Listen() error: %v", err)
+	}
+	defer l.Close()
+
+	// An existing directory other users can enter is restricted
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("Socket directory mode = %o, want 700", perm)
+	}
+	info, err = os.Stat(filepath.Join(dir, fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Socket mode = %o, want 600", perm)
+	}
+}
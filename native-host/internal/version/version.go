@@ -0,0 +1,50 @@
+// Package version identifies the native host build.
+package version
+
+import "runtime/debug"
+
+// Version is the host's semantic version. Release builds set it with
+// -ldflags "-X github.com/reclaim/openwith/internal/version.Version=1.2.3".
+var Version = "1.0.0"
+
+// Commit is the source revision, set at build time like Version. When
+// unset it is read from the VCS stamp Go embeds in the binary.
+var Commit = ""
+
+// ExtensionID is the ID of the store build of the extension, which may
+// always call the host. Set at build time like Version; development builds
+// leave it empty and list their callers in the policy file.
+var ExtensionID = ""
+
+// FirefoxExtensionID is the ID of the add-on published for Firefox, set
+// like ExtensionID
+var FirefoxExtensionID = ""
+
+// BuildCommit returns the commit the host was built from, with a "-dirty"
+// suffix for builds with uncommitted changes, or "unknown"
+func BuildCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
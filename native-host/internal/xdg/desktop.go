@@ -0,0 +1,277 @@
+package xdg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DesktopEntry holds the [Desktop Entry] keys needed to list and launch an
+// application
+type DesktopEntry struct {
+	Type      string   // "Application", "Link" or "Directory"
+	Name      string   // Unlocalized name; see LocalizedName
+	Exec      string   // Command line template, string escapes already decoded
+	TryExec   string   // Program that must exist for the entry to be usable
+	Icon      string   // Icon name or absolute path
+	MimeTypes []string // MIME types the application declares it can open
+	Hidden    bool     // Entry is deleted and must be treated as not installed
+	NoDisplay bool     // Entry is not shown in menus but can still open files
+	Path      string   // Location of the .desktop file, set by ReadDesktopEntry
+
+	names map[string]string // Name[locale] values keyed by locale
+}
+
+// ReadDesktopEntry parses the .desktop file at path
+func ReadDesktopEntry(path string) (*DesktopEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entry, err := ParseDesktopEntry(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	entry.Path = path
+	return entry, nil
+}
+
+// ParseDesktopEntry parses the [Desktop Entry] group of a desktop file
+func ParseDesktopEntry(r io.Reader) (*DesktopEntry, error) {
+	kf, err := parseKeyFile(r)
+	if err != nil {
+		return nil, err
+	}
+	group := kf.group("Desktop Entry")
+	if group == nil {
+		return nil, fmt.Errorf("missing [Desktop Entry] group")
+	}
+
+	entry := &DesktopEntry{
+		Type:      group["Type"],
+		Name:      unescapeString(group["Name"]),
+		Exec:      unescapeString(group["Exec"]),
+		TryExec:   unescapeString(group["TryExec"]),
+		Icon:      unescapeString(group["Icon"]),
+		MimeTypes: splitList(group["MimeType"]),
+		Hidden:    parseBool(group["Hidden"]),
+		NoDisplay: parseBool(group["NoDisplay"]),
+		names:     make(map[string]string),
+	}
+	for key, value := range group {
+		if locale, ok := strings.CutPrefix(key, "Name["); ok && strings.HasSuffix(locale, "]") {
+			entry.names[strings.TrimSuffix(locale, "]")] = unescapeString(value)
+		}
+	}
+
+	return entry, nil
+}
+
+// LocalizedName returns the Name best matching a POSIX locale such as
+// "de_CH.UTF-8@euro", using the spec's order: lang_COUNTRY@MODIFIER,
+// lang_COUNTRY, lang@MODIFIER, lang, then the unlocalized Name.
+func (e *DesktopEntry) LocalizedName(locale string) string {
+	for _, key := range localeKeys(locale) {
+		if name, ok := e.names[key]; ok && name != "" {
+			return name
+		}
+	}
+	return e.Name
+}
+
+// localeKeys returns the Name[...] keys to try for a locale, best first
+func localeKeys(locale string) []string {
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+
+	rest, modifier, hasModifier := strings.Cut(locale, "@")
+	rest, _, _ = strings.Cut(rest, ".") // encoding is ignored
+	lang, country, hasCountry := strings.Cut(rest, "_")
+
+	var keys []string
+	if hasCountry && hasModifier {
+		keys = append(keys, lang+"_"+country+"@"+modifier)
+	}
+	if hasCountry {
+		keys = append(keys, lang+"_"+country)
+	}
+	if hasModifier {
+		keys = append(keys, lang+"@"+modifier)
+	}
+	return append(keys, lang)
+}
+
+// Locale returns the message locale from the environment, following the
+// usual LC_ALL > LC_MESSAGES > LANG precedence
+func Locale() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(env); locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
+
+// IsApplication reports whether the entry is a launchable application:
+// not hidden, of type Application, with an Exec line and, if TryExec is
+// set, an installed program.
+func (e *DesktopEntry) IsApplication() bool {
+	if e.Hidden || e.Exec == "" {
+		return false
+	}
+	if e.Type != "" && e.Type != "Application" {
+		return false
+	}
+	if e.TryExec != "" {
+		if _, err := exec.LookPath(e.TryExec); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// HandlesMimeType reports whether the entry declares mimeType
+func (e *DesktopEntry) HandlesMimeType(mimeType string) bool {
+	for _, t := range e.MimeTypes {
+		if strings.EqualFold(t, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Argv expands the Exec line into an argument vector that opens file.
+// The result is meant for exec.Command and never goes through a shell.
+//
+// %f, %F, %u and %U become the file path; %i becomes "--icon <Icon>" when
+// an icon is set; %c is the localized name and %k the entry's location.
+// Deprecated codes (%d %D %n %N %v %m) are dropped and any other code is an
+// error. If the line takes no file argument, the file is appended so it
+// still gets opened.
+func (e *DesktopEntry) Argv(file string) ([]string, error) {
+	words, err := splitExec(e.Exec)
+	if err != nil {
+		return nil, err
+	}
+
+	var argv []string
+	usedFile := false
+	for _, word := range words {
+		switch word {
+		case "%f", "%F", "%u", "%U":
+			if usedFile {
+				return nil, fmt.Errorf("invalid Exec line: more than one file field code")
+			}
+			argv = append(argv, file)
+			usedFile = true
+			continue
+		case "%i":
+			if e.Icon != "" {
+				argv = append(argv, "--icon", e.Icon)
+			}
+			continue
+		}
+
+		var b strings.Builder
+		for i := 0; i < len(word); i++ {
+			if word[i] != '%' {
+				b.WriteByte(word[i])
+				continue
+			}
+			if i+1 == len(word) {
+				return nil, fmt.Errorf("invalid Exec line: trailing %%")
+			}
+			i++
+			switch word[i] {
+			case '%':
+				b.WriteByte('%')
+			case 'f', 'u':
+				if usedFile {
+					return nil, fmt.Errorf("invalid Exec line: more than one file field code")
+				}
+				b.WriteString(file)
+				usedFile = true
+			case 'F', 'U', 'i':
+				return nil, fmt.Errorf("invalid Exec line: %%%c must be a separate argument", word[i])
+			case 'c':
+				b.WriteString(e.LocalizedName(Locale()))
+			case 'k':
+				b.WriteString(e.Path)
+			case 'd', 'D', 'n', 'N', 'v', 'm':
+				// Deprecated field codes expand to nothing
+			default:
+				return nil, fmt.Errorf("invalid Exec line: unknown field code %%%c", word[i])
+			}
+		}
+		if b.Len() > 0 {
+			argv = append(argv, b.String())
+		}
+	}
+
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("invalid Exec line: no program")
+	}
+	if !usedFile {
+		argv = append(argv, file)
+	}
+	return argv, nil
+}
+
+// splitExec splits an Exec value into words. Arguments may be enclosed in
+// double quotes, inside which \", \`, \$ and \\ are the only escapes.
+// Outside quotes a backslash escapes the next character, as GLib does;
+// Wine-generated entries rely on this for Windows paths.
+func splitExec(line string) ([]string, error) {
+	var words []string
+	var b strings.Builder
+	inWord, inQuotes := false, false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(line) && strings.IndexByte("\"`$\\", line[i+1]) >= 0:
+			i++
+			b.WriteByte(line[i])
+		case !inQuotes && c == '\\' && i+1 < len(line):
+			i++
+			b.WriteByte(line[i])
+			inWord = true
+		case c == '"':
+			inQuotes = !inQuotes
+			inWord = true
+		case !inQuotes && (c == ' ' || c == '\t' || c == '\n'):
+			if inWord {
+				words = append(words, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			b.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("invalid Exec line: unterminated quote")
+	}
+	if inWord {
+		words = append(words, b.String())
+	}
+	return words, nil
+}
+
+// DesktopFileID derives the desktop-file ID of a file below an applications
+// directory: the relative path with "/" replaced by "-", so
+// "kde4/okular.desktop" becomes "kde4-okular.desktop".
+func DesktopFileID(applicationsDir, path string) (string, error) {
+	rel, err := filepath.Rel(applicationsDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not below %s", path, applicationsDir)
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "-"), nil
+}
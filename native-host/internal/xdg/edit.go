@@ -0,0 +1,152 @@
+package xdg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reclaim/openwith/internal/atomicfile"
+)
+
+// SetDefaultApplication makes id the default application for mimeType in
+// the mimeapps.list at path, the way xdg-mime does: it becomes the Default
+// Applications entry and moves to the front of Added Associations, and any
+// Removed Associations entry for it is dropped. Every other line is kept
+// as is. The file is replaced atomically and created if missing.
+func SetDefaultApplication(path, mimeType, id string) error {
+	if mimeType == "" || strings.ContainsAny(mimeType, "=[]\n") {
+		return fmt.Errorf("invalid MIME type %q", mimeType)
+	}
+	if !strings.HasSuffix(id, ".desktop") || strings.ContainsAny(id, ";=[]/\n") {
+		return fmt.Errorf("invalid desktop-file ID %q", id)
+	}
+
+	// Edit the real file so a symlinked mimeapps.list (dotfile managers)
+	// stays a symlink
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	mode := os.FileMode(0644)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	lines := splitLines(string(data))
+	lines = editListKey(lines, DefaultApplicationsGroup, mimeType, func([]string) []string {
+		return []string{id}
+	})
+	lines = editListKey(lines, AddedAssociationsGroup, mimeType, func(items []string) []string {
+		return append([]string{id}, without(items, id)...)
+	})
+	lines = editListKey(lines, RemovedAssociationsGroup, mimeType, func(items []string) []string {
+		if items == nil {
+			return nil // don't create the key
+		}
+		return without(items, id)
+	})
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := atomicfile.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// splitLines splits file content into lines without the trailing newline
+func splitLines(content string) []string {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// editListKey rewrites the list value of key in group. update receives the
+// current items (nil if the key is missing) and returns the new ones; an
+// empty result removes the key. Missing groups and keys are appended.
+func editListKey(lines []string, group, key string, update func([]string) []string) []string {
+	start, end := findGroup(lines, group)
+
+	if start < 0 {
+		items := update(nil)
+		if len(items) == 0 {
+			return lines
+		}
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		return append(lines, "["+group+"]", formatListKey(key, items))
+	}
+
+	for i := start + 1; i < end; i++ {
+		k, value, ok := strings.Cut(lines[i], "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		items := update(splitList(value))
+		if len(items) == 0 {
+			return append(lines[:i:i], lines[i+1:]...)
+		}
+		lines[i] = formatListKey(key, items)
+		return lines
+	}
+
+	items := update(nil)
+	if len(items) == 0 {
+		return lines
+	}
+
+	// Insert after the group's last non-blank line, before any spacing
+	insert := end
+	for insert > start+1 && strings.TrimSpace(lines[insert-1]) == "" {
+		insert--
+	}
+	out := make([]string, 0, len(lines)+1)
+	out = append(out, lines[:insert]...)
+	out = append(out, formatListKey(key, items))
+	return append(out, lines[insert:]...)
+}
+
+// findGroup returns the header line of group and the index where the group
+// ends, or -1 if the group is missing
+func findGroup(lines []string, group string) (start, end int) {
+	start = -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "[") {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if trimmed == "["+group+"]" {
+			start = i
+		}
+	}
+	return start, len(lines)
+}
+
+// formatListKey writes a key with a semicolon-terminated list value
+func formatListKey(key string, items []string) string {
+	return key + "=" + strings.Join(items, ";") + ";"
+}
+
+// without returns items with every occurrence of id removed
+func without(items []string, id string) []string {
+	var out []string
+	for _, item := range items {
+		if item != id {
+			out = append(out, item)
+		}
+	}
+	return out
+}
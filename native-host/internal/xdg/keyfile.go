@@ -0,0 +1,146 @@
+// Package xdg parses the freedesktop.org files used to resolve applications
+// on Linux: Desktop Entry files (*.desktop) and MIME association lists
+// (mimeapps.list). Both share the XDG key file format.
+package xdg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineLength bounds a single key file line. Real-world files stay far
+// below this; anything longer is not a file we want to trust.
+const maxLineLength = 64 * 1024
+
+// keyFile holds the groups of an XDG key file. Keys keep their locale
+// suffix, so "Name" and "Name[de]" are stored separately.
+type keyFile struct {
+	groups map[string]map[string]string
+}
+
+// parseKeyFile reads a key file. Comments and blank lines are skipped and
+// the first occurrence of a group or key wins. Lines outside any group, or
+// without "=", are rejected as the spec requires.
+func parseKeyFile(r io.Reader) (*keyFile, error) {
+	kf := &keyFile{groups: make(map[string]map[string]string)}
+	var current map[string]string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed group header", lineNum)
+			}
+			name := line[1 : len(line)-1]
+			if _, ok := kf.groups[name]; ok {
+				// Duplicate group: ignore its keys rather than merging
+				current = make(map[string]string)
+				continue
+			}
+			current = make(map[string]string)
+			kf.groups[name] = current
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("line %d: key outside of a group", lineNum)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key=value", lineNum)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", lineNum)
+		}
+		if _, exists := current[key]; !exists {
+			current[key] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return kf, nil
+}
+
+// group returns the keys of a group, or nil if it doesn't exist
+func (kf *keyFile) group(name string) map[string]string {
+	return kf.groups[name]
+}
+
+// unescapeString decodes the escape sequences allowed in string values:
+// \s, \n, \t, \r and \\. Unknown escapes are kept verbatim.
+func unescapeString(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// splitList splits a semicolon-separated list value. "\;" is a literal
+// semicolon; empty items are dropped.
+func splitList(value string) []string {
+	var items []string
+	var b strings.Builder
+	flush := func() {
+		if item := strings.TrimSpace(unescapeString(b.String())); item != "" {
+			items = append(items, item)
+		}
+		b.Reset()
+	}
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ';':
+			i++
+			b.WriteByte(';')
+		case value[i] == ';':
+			flush()
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	flush()
+	return items
+}
+
+// parseBool reads a boolean value. Anything but "true" is false; "1" is
+// accepted for files written against older versions of the spec.
+func parseBool(value string) bool {
+	return value == "true" || value == "1"
+}
@@ -0,0 +1,55 @@
+package xdg
+
+import (
+	"io"
+	"os"
+)
+
+// Group names used in mimeapps.list
+const (
+	DefaultApplicationsGroup = "Default Applications"
+	AddedAssociationsGroup   = "Added Associations"
+	RemovedAssociationsGroup = "Removed Associations"
+)
+
+// MimeApps holds the associations from one mimeapps.list file. Each map is
+// keyed by MIME type and lists desktop-file IDs in preference order.
+type MimeApps struct {
+	Defaults map[string][]string
+	Added    map[string][]string
+	Removed  map[string][]string
+}
+
+// ReadMimeApps parses the mimeapps.list file at path
+func ReadMimeApps(path string) (*MimeApps, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseMimeApps(f)
+}
+
+// ParseMimeApps parses a mimeapps.list file. Unknown groups are ignored.
+func ParseMimeApps(r io.Reader) (*MimeApps, error) {
+	kf, err := parseKeyFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MimeApps{
+		Defaults: listGroup(kf.group(DefaultApplicationsGroup)),
+		Added:    listGroup(kf.group(AddedAssociationsGroup)),
+		Removed:  listGroup(kf.group(RemovedAssociationsGroup)),
+	}, nil
+}
+
+// listGroup splits every value of a group into a list
+func listGroup(group map[string]string) map[string][]string {
+	lists := make(map[string][]string, len(group))
+	for key, value := range group {
+		lists[key] = splitList(value)
+	}
+	return lists
+}
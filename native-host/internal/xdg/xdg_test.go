@@ -0,0 +1,468 @@
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testFile = "/home/user/Downloads/open-with-Q4 Budget.xlsx"
+
+func TestReadDesktopEntry(t *testing.T) {
+	tests := []struct {
+		file          string
+		locale        string
+		wantName      string
+		wantMimeType  string
+		wantNoDisplay bool
+		wantApp       bool
+		wantArgv      []string
+	}{
+		{
+			file:         "libreoffice-calc.desktop",
+			locale:       "de_DE.UTF-8",
+			wantName:     "LibreOffice Calc",
+			wantMimeType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			wantApp:      true,
+			wantArgv:     []string{"libreoffice", "--calc", testFile},
+		},
+		{
+			file:         "org.gnome.Evince.desktop",
+			locale:       "fr_FR.UTF-8",
+			wantName:     "Visionneur de documents",
+			wantMimeType: "application/pdf",
+			wantArgv:     []string{"evince", testFile},
+		},
+		{
+			file:         "org.gnome.Evince.desktop",
+			locale:       "sr_RS@latin",
+			wantName:     "Pregledač dokumenata",
+			wantMimeType: "application/pdf",
+			wantArgv:     []string{"evince", testFile},
+		},
+		{
+			file:         "org.gnome.Evince.desktop",
+			locale:       "C",
+			wantName:     "Document Viewer",
+			wantMimeType: "application/pdf",
+			wantArgv:     []string{"evince", testFile},
+		},
+		{
+			// Desktop Action groups must not leak into the main entry
+			file:         "code.desktop",
+			locale:       "en_US.UTF-8",
+			wantName:     "Visual Studio Code",
+			wantMimeType: "text/plain",
+			wantApp:      true,
+			wantArgv:     []string{"/usr/share/code/code", testFile},
+		},
+		{
+			file:     "wine-notepad-plus-plus.desktop",
+			wantName: "Notepad++",
+			wantApp:  true,
+			wantArgv: []string{
+				"env", "WINEPREFIX=/home/user/.wine", "wine", `C:\windows\command\start.exe`,
+				"/Unix", "/home/user/.wine/dosdevices/c:/users/Public/Desktop/Notepad++.lnk", testFile,
+			},
+		},
+		{
+			file:         "onlyoffice-desktopeditors.desktop",
+			wantName:     "ONLYOFFICE",
+			wantMimeType: "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+			wantApp:      true,
+			wantArgv:     []string{"/opt/onlyoffice/desktopeditors/DesktopEditors", testFile},
+		},
+		{
+			file:     "hidden-override.desktop",
+			wantName: "Removed Viewer",
+			wantApp:  false,
+			wantArgv: []string{"removed-viewer", testFile},
+		},
+		{
+			// NoDisplay entries are still valid handlers
+			file:          "mimeinfo-handler.desktop",
+			locale:        "de_AT",
+			wantName:      "Archivhelfer",
+			wantMimeType:  "application/x-tar",
+			wantNoDisplay: true,
+			wantApp:       true,
+			wantArgv:      []string{"sh", "-c", `archive-helper "$1"`, "sh", testFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.locale, func(t *testing.T) {
+			path := filepath.Join("testdata", tt.file)
+			entry, err := ReadDesktopEntry(path)
+			if err != nil {
+				t.Fatalf("ReadDesktopEntry() error: %v", err)
+			}
+
+			if entry.Path != path {
+				t.Errorf("Path = %q, want %q", entry.Path, path)
+			}
+			if got := entry.LocalizedName(tt.locale); got != tt.wantName {
+				t.Errorf("LocalizedName(%q) = %q, want %q", tt.locale, got, tt.wantName)
+			}
+			if tt.wantMimeType != "" && !entry.HandlesMimeType(tt.wantMimeType) {
+				t.Errorf("HandlesMimeType(%q) = false, MimeTypes = %q", tt.wantMimeType, entry.MimeTypes)
+			}
+			if entry.NoDisplay != tt.wantNoDisplay {
+				t.Errorf("NoDisplay = %v, want %v", entry.NoDisplay, tt.wantNoDisplay)
+			}
+			// TryExec results depend on what the machine has installed
+			if entry.TryExec == "" && entry.IsApplication() != tt.wantApp {
+				t.Errorf("IsApplication() = %v, want %v", entry.IsApplication(), tt.wantApp)
+			}
+
+			argv, err := entry.Argv(testFile)
+			if err != nil {
+				t.Fatalf("Argv() error: %v", err)
+			}
+			if strings.Join(argv, "\x00") != strings.Join(tt.wantArgv, "\x00") {
+				t.Errorf("Argv() = %q, want %q", argv, tt.wantArgv)
+			}
+		})
+	}
+}
+
+func TestParseDesktopEntry_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "no desktop entry group", input: "[Desktop Action new]\nName=New\n"},
+		{name: "key before group", input: "Name=Orphan\n[Desktop Entry]\n"},
+		{name: "malformed group header", input: "[Desktop Entry\nName=Broken\n"},
+		{name: "line without equals", input: "[Desktop Entry]\nName\n"},
+		{name: "empty key", input: "[Desktop Entry]\n=value\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDesktopEntry(strings.NewReader(tt.input)); err == nil {
+				t.Error("ParseDesktopEntry() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestParseDesktopEntry_Values(t *testing.T) {
+	input := "# comment\n" +
+		"[Desktop Entry]\n" +
+		"Name = Spaced\\sOut \n" +
+		"Name=Duplicate\n" +
+		"Type=Link\n" +
+		"Exec=app\n" +
+		"MimeType=text/plain;;odd\\;type;\n" +
+		"Hidden=false\n"
+
+	entry, err := ParseDesktopEntry(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDesktopEntry() error: %v", err)
+	}
+	if entry.Name != "Spaced Out" {
+		t.Errorf("Name = %q, want %q", entry.Name, "Spaced Out")
+	}
+	if got := strings.Join(entry.MimeTypes, "|"); got != "text/plain|odd;type" {
+		t.Errorf("MimeTypes = %q, want [text/plain odd;type]", entry.MimeTypes)
+	}
+	if entry.IsApplication() {
+		t.Error("IsApplication() = true for Type=Link, want false")
+	}
+}
+
+func TestIsApplication_TryExec(t *testing.T) {
+	entry := &DesktopEntry{Type: "Application", Exec: "app %f"}
+
+	entry.TryExec = "/nonexistent/app"
+	if entry.IsApplication() {
+		t.Error("IsApplication() = true with missing TryExec program, want false")
+	}
+
+	entry.TryExec = "sh"
+	if !entry.IsApplication() {
+		t.Error("IsApplication() = false with TryExec=sh, want true")
+	}
+}
+
+func TestArgv(t *testing.T) {
+	entry := &DesktopEntry{Name: "Calc", Icon: "calc", Path: "/usr/share/applications/calc.desktop"}
+	tests := []struct {
+		exec    string
+		want    []string
+		wantErr bool
+	}{
+		{exec: "libreoffice --calc %U", want: []string{"libreoffice", "--calc", testFile}},
+		{exec: `"/opt/My App/bin/app" %f`, want: []string{"/opt/My App/bin/app", testFile}},
+		{exec: `app "--title=\"%c\"" %i %u`, want: []string{"app", `--title="Calc"`, "--icon", "calc", testFile}},
+		{exec: "app --file=%f --pct=100%%", want: []string{"app", "--file=" + testFile, "--pct=100%"}},
+		{exec: "app --desktop-file=%k %F", want: []string{"app", "--desktop-file=/usr/share/applications/calc.desktop", testFile}},
+		{exec: "app %d %D %n %N %v %m %f", want: []string{"app", testFile}},
+		{exec: "app", want: []string{"app", testFile}},
+		{exec: "app; rm -rf ~ %f", want: []string{"app;", "rm", "-rf", "~", testFile}},
+		{exec: "app $(id) `id` %f", want: []string{"app", "$(id)", "`id`", testFile}},
+		{exec: "app %f %u", wantErr: true},
+		{exec: "app --files=%F", wantErr: true},
+		{exec: "app %x", wantErr: true},
+		{exec: "app 100%", wantErr: true},
+		{exec: `"app %f`, wantErr: true},
+		{exec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exec, func(t *testing.T) {
+			entry.Exec = tt.exec
+			got, err := entry.Argv(testFile)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Argv() expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Argv() unexpected error: %v", err)
+			}
+			if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+				t.Errorf("Argv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleKeys(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{locale: "", want: nil},
+		{locale: "C", want: nil},
+		{locale: "de", want: []string{"de"}},
+		{locale: "de_CH.UTF-8", want: []string{"de_CH", "de"}},
+		{locale: "sr@latin", want: []string{"sr@latin", "sr"}},
+		{locale: "sr_RS.UTF-8@latin", want: []string{"sr_RS@latin", "sr_RS", "sr@latin", "sr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			got := localeKeys(tt.locale)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("localeKeys(%q) = %q, want %q", tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMimeApps(t *testing.T) {
+	apps, err := ReadMimeApps(filepath.Join("testdata", "mimeapps.list"))
+	if err != nil {
+		t.Fatalf("ReadMimeApps() error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		group map[string][]string
+		mime  string
+		want  []string
+	}{
+		{name: "default", group: apps.Defaults, mime: "application/pdf", want: []string{"org.gnome.Evince.desktop"}},
+		{
+			name:  "default with fallback",
+			group: apps.Defaults,
+			mime:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			want:  []string{"libreoffice-calc.desktop", "onlyoffice-desktopeditors.desktop"},
+		},
+		{name: "added", group: apps.Added, mime: "text/plain", want: []string{"code.desktop", "org.gnome.TextEditor.desktop"}},
+		{name: "removed", group: apps.Removed, mime: "application/pdf", want: []string{"chromium.desktop"}},
+		{name: "missing", group: apps.Removed, mime: "text/plain", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.group[tt.mime]
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%s[%s] = %q, want %q", tt.name, tt.mime, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesktopFileID(t *testing.T) {
+	tests := []struct {
+		dir, path string
+		want      string
+		wantErr   bool
+	}{
+		{dir: "/usr/share/applications", path: "/usr/share/applications/firefox.desktop", want: "firefox.desktop"},
+		{dir: "/usr/share/applications", path: "/usr/share/applications/kde4/okular.desktop", want: "kde4-okular.desktop"},
+		{dir: "/usr/share/applications", path: "/opt/app/app.desktop", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := DesktopFileID(tt.dir, tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DesktopFileID() expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("DesktopFileID() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDefaultApplication(t *testing.T) {
+	const pdf = "application/pdf"
+	tests := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{
+			name:   "new file",
+			before: "",
+			after: "[Default Applications]\n" +
+				"application/pdf=okular.desktop;\n" +
+				"\n" +
+				"[Added Associations]\n" +
+				"application/pdf=okular.desktop;\n",
+		},
+		{
+			name: "replaces default and keeps everything else",
+			before: "# managed by hand\n" +
+				"[Default Applications]\n" +
+				"text/html=firefox.desktop\n" +
+				"application/pdf=org.gnome.Evince.desktop\n" +
+				"\n" +
+				"[Added Associations]\n" +
+				"application/pdf=org.gnome.Evince.desktop;okular.desktop;\n" +
+				"\n" +
+				"[Removed Associations]\n" +
+				"application/pdf=okular.desktop;chromium.desktop;\n" +
+				"text/plain=okular.desktop;\n",
+			after: "# managed by hand\n" +
+				"[Default Applications]\n" +
+				"text/html=firefox.desktop\n" +
+				"application/pdf=okular.desktop;\n" +
+				"\n" +
+				"[Added Associations]\n" +
+				"application/pdf=okular.desktop;org.gnome.Evince.desktop;\n" +
+				"\n" +
+				"[Removed Associations]\n" +
+				"application/pdf=chromium.desktop;\n" +
+				"text/plain=okular.desktop;\n",
+		},
+		{
+			name: "adds key to existing groups",
+			before: "[Added Associations]\n" +
+				"text/plain=code.desktop;\n" +
+				"\n" +
+				"[Default Applications]\n" +
+				"text/plain=code.desktop\n",
+			after: "[Added Associations]\n" +
+				"text/plain=code.desktop;\n" +
+				"application/pdf=okular.desktop;\n" +
+				"\n" +
+				"[Default Applications]\n" +
+				"text/plain=code.desktop\n" +
+				"application/pdf=okular.desktop;\n",
+		},
+		{
+			name: "drops removal that only named the app",
+			before: "[Removed Associations]\n" +
+				"application/pdf=okular.desktop;\n",
+			after: "[Removed Associations]\n" +
+				"\n" +
+				"[Default Applications]\n" +
+				"application/pdf=okular.desktop;\n" +
+				"\n" +
+				"[Added Associations]\n" +
+				"application/pdf=okular.desktop;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mimeapps.list")
+			if tt.before != "" {
+				if err := os.WriteFile(path, []byte(tt.before), 0600); err != nil {
+					t.Fatalf("Failed to write file: %v", err)
+				}
+			}
+
+			if err := SetDefaultApplication(path, pdf, "okular.desktop"); err != nil {
+				t.Fatalf("SetDefaultApplication() error: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(data) != tt.after {
+				t.Errorf("File after edit:\n%s\nwant:\n%s", data, tt.after)
+			}
+
+			apps, err := ReadMimeApps(path)
+			if err != nil {
+				t.Fatalf("ReadMimeApps() error: %v", err)
+			}
+			if got := apps.Defaults[pdf]; len(got) != 1 || got[0] != "okular.desktop" {
+				t.Errorf("Defaults[%s] = %q after edit", pdf, got)
+			}
+		})
+	}
+}
+
+func TestSetDefaultApplication_KeepsModeAndSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "mimeapps.list")
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("[Default Applications]\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	link := filepath.Join(dir, "mimeapps.list")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := SetDefaultApplication(link, "text/plain", "code.desktop"); err != nil {
+		t.Fatalf("SetDefaultApplication() error: %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected mimeapps.list to remain a symlink")
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Failed to stat target: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be kept, got %o", info.Mode().Perm())
+	}
+}
+
+func TestSetDefaultApplication_InvalidInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mimeapps.list")
+	tests := []struct{ mimeType, id string }{
+		{mimeType: "", id: "okular.desktop"},
+		{mimeType: "text/plain\n[Default Applications]", id: "okular.desktop"},
+		{mimeType: "text/plain", id: "okular"},
+		{mimeType: "text/plain", id: "evil;okular.desktop"},
+		{mimeType: "text/plain", id: "../okular.desktop"},
+	}
+
+	for _, tt := range tests {
+		if err := SetDefaultApplication(path, tt.mimeType, tt.id); err == nil {
+			t.Errorf("SetDefaultApplication(%q, %q) expected error, got nil", tt.mimeType, tt.id)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected no file to be written for invalid input")
+	}
+}
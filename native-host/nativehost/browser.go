@@ -0,0 +1,140 @@
+package nativehost
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteRequest writes msg the way a browser does, as one frame or, if it's
+// too big for one, as a stream. With ReadResponse, it's the browser's half
+// of the protocol, for tools and tests that drive a host without one; see
+// the client and hosttest packages.
+func WriteRequest(w io.Writer, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if len(data) <= MaxMessageSize {
+		return writeFrame(w, data)
+	}
+	return writeStream(w, data, func(action string, payload interface{}) interface{} {
+		raw, _ := json.Marshal(payload)
+		return Message{ID: msg.ID, Action: action, Payload: raw}
+	})
+}
+
+// ReadResponse reads one response written by WriteMessage, reassembling it
+// if it was sent as a stream. Progress frames are returned like any other
+// response.
+func ReadResponse(r io.Reader) (Response, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var frame struct {
+		Type   string          `json:"type"`
+		Stream json.RawMessage `json:"stream"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return Response{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if frame.Type == ActionStreamBegin {
+		var begin StreamBegin
+		if err := json.Unmarshal(frame.Stream, &begin); err != nil {
+			return Response{}, fmt.Errorf("invalid streamBegin: %w", err)
+		}
+		if data, err = readStream(r, begin); err != nil {
+			return Response{}, err
+		}
+	}
+
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return Response{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return resp, nil
+}
+
+// readStream reads the chunks and end of a stream whose begin frame has
+// been read. WriteMessage sends a stream's frames together, so nothing
+// else arrives in between.
+func readStream(r io.Reader, begin StreamBegin) ([]byte, error) {
+	if begin.Size <= 0 || begin.Size > MaxStreamSize {
+		return nil, fmt.Errorf("stream %q has invalid size %d", begin.StreamID, begin.Size)
+	}
+	var buf bytes.Buffer
+	for seq := 0; ; seq++ {
+		data, err := readFrame(r)
+		if err != nil {
+			return nil, err
+		}
+		var frame struct {
+			Type   string          `json:"type"`
+			Stream json.RawMessage `json:"stream"`
+		}
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream frame: %w", err)
+		}
+
+		switch frame.Type {
+		case ActionStreamChunk:
+			var chunk StreamChunk
+			if err := json.Unmarshal(frame.Stream, &chunk); err != nil {
+				return nil, fmt.Errorf("invalid streamChunk: %w", err)
+			}
+			if chunk.StreamID != begin.StreamID || chunk.Seq != seq {
+				return nil, fmt.Errorf("stream %q: got chunk %d of %q, expected chunk %d",
+					begin.StreamID, chunk.Seq, chunk.StreamID, seq)
+			}
+			data, err := base64.StdEncoding.DecodeString(chunk.Data)
+			if err != nil {
+				return nil, fmt.Errorf("stream %q: chunk %d is not valid base64", begin.StreamID, seq)
+			}
+			if buf.Len()+len(data) > begin.Size {
+				return nil, fmt.Errorf("stream %q is longer than the %d bytes announced", begin.StreamID, begin.Size)
+			}
+			buf.Write(data)
+		case ActionStreamEnd:
+			var end StreamEnd
+			if err := json.Unmarshal(frame.Stream, &end); err != nil {
+				return nil, fmt.Errorf("invalid streamEnd: %w", err)
+			}
+			if seq != begin.Chunks || buf.Len() != begin.Size {
+				return nil, fmt.Errorf("stream %q ended after %d of %d chunks", begin.StreamID, seq, begin.Chunks)
+			}
+			sum := sha256.Sum256(buf.Bytes())
+			if end.SHA256 != hex.EncodeToString(sum[:]) {
+				return nil, fmt.Errorf("stream %q failed its SHA-256 check", begin.StreamID)
+			}
+			return buf.Bytes(), nil
+		default:
+			return nil, fmt.Errorf("stream %q: unexpected %q frame", begin.StreamID, frame.Type)
+		}
+	}
+}
+
+// readFrame reads one length-prefixed frame
+func readFrame(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+	if length == 0 || length > MaxMessageSize {
+		return nil, fmt.Errorf("invalid message length: %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+	return buf, nil
+}
@@ -0,0 +1,86 @@
+package nativehost
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadResponse(t *testing.T) {
+	small := Response{ID: "1", Success: true, Message: "ok"}
+	large := Response{ID: "2", Success: true, Message: strings.Repeat("y", 2*MaxMessageSize)}
+
+	var buf bytes.Buffer
+	for _, resp := range []Response{small, large, small} {
+		if err := WriteMessage(&buf, resp); err != nil {
+			t.Fatalf("WriteMessage() error: %v", err)
+		}
+	}
+
+	for i, want := range []Response{small, large, small} {
+		got, err := ReadResponse(&buf)
+		if err != nil {
+			t.Fatalf("ReadResponse() #%d error: %v", i+1, err)
+		}
+		if got.ID != want.ID || got.Message != want.Message {
+			t.Errorf("ReadResponse() #%d = id %q, %d-byte message", i+1, got.ID, len(got.Message))
+		}
+	}
+	if _, err := ReadResponse(&buf); err != io.EOF {
+		t.Errorf("ReadResponse() at the end = %v, want EOF", err)
+	}
+}
+
+func TestReadResponse_CorruptStream(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, Response{Success: true, Message: strings.Repeat("z", MaxMessageSize)})
+
+	// Flip a byte in the middle of the first chunk's base64
+	data := buf.Bytes()
+	i := bytes.Index(data, []byte(`"data":"`)) + 100
+	if data[i] == 'e' {
+		data[i] = 'f'
+	} else {
+		data[i] = 'e'
+	}
+
+	if _, err := ReadResponse(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Errorf("ReadResponse() error = %v, want a checksum failure", err)
+	}
+}
+
+func TestWriteRequest_Streams(t *testing.T) {
+	payload, _ := json.Marshal(map[string]string{"data": strings.Repeat("q", MaxMessageSize)})
+	msg := Message{ID: "5", Action: "writeFile", Payload: payload}
+
+	var buf bytes.Buffer
+	if err := WriteRequest(&buf, msg); err != nil {
+		t.Fatalf("WriteRequest() error: %v", err)
+	}
+
+	// Feed the frames to the host's reassembler
+	s := newStreamTable(time.Minute)
+	defer s.Close()
+	for {
+		frame, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("ReadMessage() error: %v", err)
+		}
+		if frame.ID != "5" || !IsStreamAction(frame.Action) {
+			t.Fatalf("Got frame %s with id %q", frame.Action, frame.ID)
+		}
+		got, err := s.Handle(frame)
+		if err != nil {
+			t.Fatalf("Handle() error: %v", err)
+		}
+		if got != nil {
+			if got.ID != "5" || got.Action != "writeFile" || !bytes.Equal(got.Payload, payload) {
+				t.Errorf("Reassembled %s with id %q and a %d-byte payload", got.Action, got.ID, len(got.Payload))
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package client talks to a native messaging host the way a browser does:
+// it starts the host binary with a caller origin argument and exchanges
+// length-prefixed messages over the host's stdin and stdout. It's for
+// tools and end-to-end tests that need to drive a host without a browser.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// DefaultOrigin is the caller origin passed to the host when none is given.
+// It's shaped like a Chrome extension origin but names no real extension.
+const DefaultOrigin = "chrome-extension://aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/"
+
+// ErrClosed is returned by calls on a client whose host has exited
+var ErrClosed = errors.New("host connection closed")
+
+// Command returns the command Chrome would run to start the host at path
+// for the extension with the given origin
+func Command(path, origin string) *exec.Cmd {
+	return exec.Command(path, origin)
+}
+
+// Client is a connection to a running host. Its methods are safe to call
+// from several goroutines; each call gets its own request ID.
+type Client struct {
+	// ProtocolVersion is sent with every request, for hosts that check
+	// it. Zero sends none. Set it before the first Call.
+	ProtocolVersion int
+
+	cmd *exec.Cmd
+	in  io.WriteCloser
+
+	writeMu sync.Mutex // Serializes frames on in
+	nextID  int
+
+	mu      sync.Mutex
+	pending map[string]chan nativehost.Response // By request ID
+	err     error                               // Why the connection ended, once it has
+	done    chan struct{}
+}
+
+// Start starts cmd, which must run a host, and connects to its stdin and
+// stdout. cmd's stderr is left as it is.
+func Start(cmd *exec.Cmd) (*Client, error) {
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start host: %w", err)
+	}
+
+	c := &Client{
+		cmd:     cmd,
+		in:      in,
+		pending: make(map[string]chan nativehost.Response),
+		done:    make(chan struct{}),
+	}
+	go c.read(out)
+	return c, nil
+}
+
+// read delivers responses to the calls waiting for them until the host's
+// output ends
+func (c *Client) read(out io.Reader) {
+	var err error
+	for {
+		var resp nativehost.Response
+		resp, err = nativehost.ReadResponse(out)
+		if err != nil {
+			break
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+
+	if err == io.EOF {
+		err = ErrClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// Call sends action with payload, which may be nil or anything that
+// marshals to a JSON object, and returns the host's final response.
+// Progress frames are passed to progress, if it isn't nil. If ctx ends
+// first, the request is canceled and ctx's error returned.
+func (c *Client) Call(ctx context.Context, action string, payload interface{}, progress func(nativehost.Progress)) (nativehost.Response, error) {
+	msg := nativehost.Message{Action: action, ProtocolVersion: c.ProtocolVersion}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nativehost.Response{}, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		msg.Payload = data
+	}
+
+	// Buffered so read never blocks on a call that has given up
+	ch := make(chan nativehost.Response, 16)
+	c.mu.Lock()
+	c.nextID++
+	msg.ID = strconv.Itoa(c.nextID)
+	c.pending[msg.ID] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(msg); err != nil {
+		return nativehost.Response{}, err
+	}
+
+	for {
+		select {
+		case resp := <-ch:
+			if resp.Type == nativehost.ResponseTypeProgress {
+				if progress != nil && resp.Progress != nil {
+					progress(*resp.Progress)
+				}
+				continue
+			}
+			return resp, nil
+		case <-c.done:
+			return nativehost.Response{}, c.closedErr()
+		case <-ctx.Done():
+			c.cancel(msg.ID)
+			return nativehost.Response{}, ctx.Err()
+		}
+	}
+}
+
+// cancel asks the host to cancel a request, without waiting for a reply
+func (c *Client) cancel(id string) {
+	payload, _ := json.Marshal(nativehost.CancelRequest{RequestID: id})
+	c.send(nativehost.Message{ID: id + "-cancel", Action: nativehost.ActionCancel, Payload: payload})
+}
+
+// send writes one message, as a stream if it's too big for one frame
+func (c *Client) send(msg nativehost.Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := nativehost.WriteRequest(c.in, msg); err != nil {
+		select {
+		case <-c.done:
+			return c.closedErr()
+		default:
+		}
+		return fmt.Errorf("failed to send %s: %w", msg.Action, err)
+	}
+	return nil
+}
+
+func (c *Client) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the host's stdin, which tells it to exit, and waits for it
+func (c *Client) Close() error {
+	c.in.Close()
+	<-c.done
+	return c.cmd.Wait()
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// TestHelperHost isn't a real test: it's the host that the other tests
+// start, by running the test binary again with GO_WANT_HELPER_HOST set
+func TestHelperHost(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_HOST") != "1" {
+		return
+	}
+
+	// The origin is the first argument after "--"
+	var origin string
+	for i, arg := range os.Args {
+		if arg == "--" && i+1 < len(os.Args) {
+			origin = os.Args[i+1]
+		}
+	}
+
+	r := nativehost.NewRouter()
+	r.Handle("origin", func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		return nativehost.Response{Success: true, Message: origin}
+	})
+	r.Handle("echo", func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		return nativehost.Response{Success: true, Message: string(msg.Payload)}
+	})
+	r.Handle("version", func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		return nativehost.Response{Success: true, Message: strconv.Itoa(msg.ProtocolVersion)}
+	})
+	r.Handle("slow", func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		nativehost.ReportProgress(ctx, "waiting")
+		<-ctx.Done()
+		return nativehost.Canceled()
+	})
+	r.Serve(context.Background(), os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+func startHelper(t *testing.T) *Client {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHost$", "--", DefaultOrigin)
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_HOST=1")
+	c, err := Start(cmd)
+	if err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient_Call(t *testing.T) {
+	c := startHelper(t)
+	ctx := context.Background()
+
+	resp, err := c.Call(ctx, "origin", nil, nil)
+	if err != nil || resp.Message != DefaultOrigin {
+		t.Errorf("origin = %+v, %v; want %s", resp, err, DefaultOrigin)
+	}
+
+	// Large payloads go out and come back as streams
+	big := map[string]string{"data": strings.Repeat("c", nativehost.MaxMessageSize)}
+	resp, err = c.Call(ctx, "echo", big, nil)
+	if err != nil || len(resp.Message) < nativehost.MaxMessageSize {
+		t.Errorf("echo returned %d bytes, %v", len(resp.Message), err)
+	}
+
+	resp, err = c.Call(ctx, "version", nil, nil)
+	if err != nil || resp.Message != "0" {
+		t.Errorf("version = %+v, %v; want none sent", resp, err)
+	}
+	c.ProtocolVersion = 3
+	resp, err = c.Call(ctx, "version", nil, nil)
+	if err != nil || resp.Message != "3" {
+		t.Errorf("version = %+v, %v; want 3", resp, err)
+	}
+
+	resp, err = c.Call(ctx, "nope", nil, nil)
+	if err != nil || resp.Error != "unknown" {
+		t.Errorf("nope = %+v, %v; want an unknown action error", resp, err)
+	}
+}
+
+func TestClient_Cancel(t *testing.T) {
+	c := startHelper(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stages []string
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call(ctx, "slow", nil, func(p nativehost.Progress) {
+			stages = append(stages, p.Stage)
+			cancel()
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Call() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Call() didn't return after cancel")
+	}
+	if len(stages) != 1 || stages[0] != "waiting" {
+		t.Errorf("Progress = %v", stages)
+	}
+
+	// The connection is still usable
+	if resp, err := c.Call(context.Background(), "origin", nil, nil); err != nil || !resp.Success {
+		t.Errorf("origin after cancel = %+v, %v", resp, err)
+	}
+}
+
+func TestClient_HostExits(t *testing.T) {
+	c := startHelper(t)
+	c.in.Close()
+
+	_, err := c.Call(context.Background(), "origin", nil, nil)
+	if err == nil {
+		t.Error("Expected an error calling a host that has exited")
+	}
+}
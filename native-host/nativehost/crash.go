@@ -0,0 +1,38 @@
+package nativehost
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// writeCrashReport saves what's known about a handler panic to a new file
+// in dir and returns its path; version identifies the host build. The
+// payload is left out: it can hold file contents and paths the user
+// wouldn't want in a bug report.
+func writeCrashReport(dir, version string, msg *Message, v interface{}, stack []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// CreateTemp makes the name unique and the file 0600
+	now := time.Now()
+	f, err := os.CreateTemp(dir, "crash-"+now.Format("20060102-150405")+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(f, "Time:     %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(f, "Version:  %s\n", version)
+	fmt.Fprintf(f, "Platform: %s/%s, %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	fmt.Fprintf(f, "Action:   %s\n", msg.Action)
+	fmt.Fprintf(f, "ID:       %s\n", msg.ID)
+	fmt.Fprintf(f, "Panic:    %v\n\n", v)
+	f.Write(stack)
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,108 @@
+package nativehost
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MaxMessageSize is the largest frame a browser accepts (1MB). Larger
+// messages and responses are sent as streams.
+const MaxMessageSize = 1024 * 1024
+
+// FrameError reports a frame that was read in full but can't be served,
+// such as one that isn't JSON. The stream is still in step, so the caller
+// can answer it and read the next frame.
+type FrameError struct {
+	Reason string
+	Err    error
+}
+
+func (e *FrameError) Error() string {
+	if e.Err != nil {
+		return e.Reason + ": " + e.Err.Error()
+	}
+	return e.Reason
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// ReadMessage reads a length-prefixed JSON message from the given reader.
+// Chrome's native messaging protocol uses a 32-bit little-endian length prefix.
+// A bad frame is skipped and reported as a *FrameError; any other error,
+// such as a short read, means the stream can't be read any further.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+
+	if length == 0 {
+		return nil, &FrameError{Reason: "invalid message length: 0"}
+	}
+	if length > MaxMessageSize {
+		tooLarge := fmt.Sprintf("message too large: %d bytes (max %d)", length, MaxMessageSize)
+		// Skip the body so the next read starts at the next frame
+		if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+			return nil, fmt.Errorf("%s, and failed to skip it: %w", tooLarge, err)
+		}
+		return nil, &FrameError{Reason: tooLarge}
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+
+	var msg Message
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return nil, &FrameError{Reason: "failed to unmarshal message", Err: err}
+	}
+
+	return &msg, nil
+}
+
+// InvalidFrame is the reply to a frame ReadMessage skipped. Its ID can't
+// be known, so the reply has none.
+func InvalidFrame(err error) Response {
+	return Response{
+		Success: false,
+		Error:   "invalid_request",
+		Message: "Invalid message: " + err.Error(),
+	}
+}
+
+// WriteMessage writes a length-prefixed JSON response to the given writer.
+// Chrome's native messaging protocol uses a 32-bit little-endian length prefix.
+// A response larger than MaxMessageSize is sent as a stream of frames.
+func WriteMessage(w io.Writer, resp Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	if len(data) > MaxMessageSize {
+		return writeResponseStream(w, resp.ID, data)
+	}
+	return writeFrame(w, data)
+}
+
+// writeFrame writes one length-prefixed frame
+func writeFrame(w io.Writer, data []byte) error {
+	length := uint32(len(data))
+	if err := binary.Write(w, binary.LittleEndian, length); err != nil {
+		return fmt.Errorf("failed to write message length: %w", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message body: %w", err)
+	}
+
+	return nil
+}
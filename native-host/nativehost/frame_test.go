@@ -1,9 +1,10 @@
-package messaging
+package nativehost
 
 import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"io"
 	"testing"
 )
@@ -19,24 +20,20 @@ func TestReadMessage(t *testing.T) {
 		{
 			name: "valid message",
 			input: func() io.Reader {
-				msg := Message{Action: "open", FilePath: "/tmp/test.txt"}
+				msg := Message{Action: "open", Payload: json.RawMessage(`{"filePath":"/tmp/test.txt"}`)}
 				return createMessageReader(t, msg)
 			},
-			want:    &Message{Action: "open", FilePath: "/tmp/test.txt"},
+			want:    &Message{Action: "open", Payload: json.RawMessage(`{"filePath":"/tmp/test.txt"}`)},
 			wantErr: false,
 		},
 		{
-			name: "message with data",
+			name: "legacy flat message",
 			input: func() io.Reader {
-				msg := Message{
-					Action: "configure",
-					Data:   map[string]interface{}{"key": "value"},
-				}
-				return createMessageReader(t, msg)
+				return createRawReader([]byte(`{"action":"open","filePath":"/tmp/test.txt"}`))
 			},
 			want: &Message{
-				Action: "configure",
-				Data:   map[string]interface{}{"key": "value"},
+				Action:  "open",
+				Payload: json.RawMessage(`{"filePath":"/tmp/test.txt"}`),
 			},
 			wantErr: false,
 		},
@@ -108,7 +105,7 @@ func TestReadMessage(t *testing.T) {
 				t.Errorf("ReadMessage() unexpected error: %v", err)
 				return
 			}
-			if got.Action != tt.want.Action || got.FilePath != tt.want.FilePath {
+			if got.Action != tt.want.Action || string(got.Payload) != string(tt.want.Payload) {
 				t.Errorf("ReadMessage() = %+v, want %+v", got, tt.want)
 			}
 		})
@@ -132,10 +129,10 @@ func TestWriteMessage(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "response with defaults",
+			name: "response with a result",
 			resp: Response{
-				Success:  true,
-				Defaults: map[string]interface{}{"editor": "vim"},
+				Success: true,
+				Result:  map[string]interface{}{"defaults": map[string]string{"txt": "vim.desktop"}},
 			},
 			wantErr: false,
 		},
@@ -233,10 +230,62 @@ func createMessageReader(t *testing.T, msg Message) io.Reader {
 	if err != nil {
 		t.Fatalf("Failed to marshal test message: %v", err)
 	}
+	return createRawReader(data)
+}
 
+// Helper to frame raw JSON as it arrives from the browser
+func createRawReader(data []byte) io.Reader {
 	buf := make([]byte, 4+len(data))
 	binary.LittleEndian.PutUint32(buf[:4], uint32(len(data)))
 	copy(buf[4:], data)
 
 	return bytes.NewReader(buf)
 }
+
+func TestReadMessage_Recovers(t *testing.T) {
+	frameOf := func(data []byte) []byte {
+		buf := make([]byte, 4, 4+len(data))
+		binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+		return append(buf, data...)
+	}
+	valid := frameOf([]byte(`{"action":"ping"}`))
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"zero length", frameOf(nil)},
+		{"oversize", frameOf(bytes.Repeat([]byte("x"), MaxMessageSize+1))},
+		{"invalid JSON", frameOf([]byte("not valid json"))},
+		{"JSON that isn't an object", frameOf([]byte(`["open"]`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(append(tt.frame, valid...))
+
+			_, err := ReadMessage(r)
+			var frameErr *FrameError
+			if !errors.As(err, &frameErr) {
+				t.Fatalf("ReadMessage() error = %v, want a *FrameError", err)
+			}
+
+			msg, err := ReadMessage(r)
+			if err != nil || msg.Action != "ping" {
+				t.Errorf("Next ReadMessage() = %+v, %v; want the ping after the bad frame", msg, err)
+			}
+		})
+	}
+}
+
+func TestReadMessage_ShortReadIsFatal(t *testing.T) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, MaxMessageSize+1)
+	buf = append(buf, "short"...)
+
+	_, err := ReadMessage(bytes.NewReader(buf))
+	var frameErr *FrameError
+	if err == nil || errors.As(err, &frameErr) {
+		t.Errorf("ReadMessage() error = %v, want a fatal error", err)
+	}
+}
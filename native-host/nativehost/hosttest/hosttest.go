@@ -0,0 +1,137 @@
+// Package hosttest drives a nativehost.Router over in-memory pipes, the
+// way a browser drives a host over stdio, so handlers can be tested with
+// the real framing, streaming and middleware in the loop.
+package hosttest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/reclaim/openwith/nativehost"
+)
+
+// Timeout is how long Recv waits for a response before failing the test
+var Timeout = 5 * time.Second
+
+// Conn is a connection to a router being served on its own goroutine
+type Conn struct {
+	t      testing.TB
+	in     *io.PipeWriter
+	frames chan nativehost.Response
+	done   chan error
+}
+
+// Start serves r and returns a connection to it. The connection is closed
+// when the test ends.
+func Start(t testing.TB, r *nativehost.Router) *Conn {
+	t.Helper()
+	return StartAs(t, r, "")
+}
+
+// StartAs is Start for a caller with the given origin, as recorded by
+// nativehost.WithOrigin
+func StartAs(t testing.TB, r *nativehost.Router, origin string) *Conn {
+	t.Helper()
+	ctx := context.Background()
+	if origin != "" {
+		ctx = nativehost.WithOrigin(ctx, origin)
+	}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &Conn{
+		t:      t,
+		in:     inW,
+		frames: make(chan nativehost.Response, 256),
+		done:   make(chan error, 1),
+	}
+
+	go func() {
+		c.done <- r.Serve(ctx, inR, outW)
+		outW.Close()
+	}()
+
+	// Read responses as they're written so the router never blocks on
+	// output
+	go func() {
+		defer close(c.frames)
+		for {
+			resp, err := nativehost.ReadResponse(outR)
+			if err != nil {
+				return
+			}
+			c.frames <- resp
+		}
+	}()
+
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
+
+// Send sends msg as one frame, or as a stream if it's too big for one
+func (c *Conn) Send(msg nativehost.Message) {
+	c.t.Helper()
+	if err := nativehost.WriteRequest(c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// SendRaw sends data as one frame, whether or not it's a valid message
+func (c *Conn) SendRaw(data []byte) {
+	c.t.Helper()
+	if err := binary.Write(c.in, binary.LittleEndian, uint32(len(data))); err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.in.Write(data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Recv returns the next response, failing the test if none arrives
+// within Timeout. Progress frames are returned like any other.
+func (c *Conn) Recv() nativehost.Response {
+	c.t.Helper()
+	select {
+	case resp, ok := <-c.frames:
+		if !ok {
+			c.t.Fatal("The connection closed while waiting for a response")
+		}
+		return resp
+	case <-time.After(Timeout):
+		c.t.Fatal("Timed out waiting for a response")
+	}
+	return nativehost.Response{}
+}
+
+// Call sends action with payload, which may be nil, and returns its
+// response. It sends no ID, so the request runs in order and gets no
+// progress frames, as with a browser's one-shot sendNativeMessage.
+func (c *Conn) Call(action string, payload interface{}) nativehost.Response {
+	c.t.Helper()
+	msg := nativehost.Message{Action: action}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		msg.Payload = data
+	}
+	c.Send(msg)
+	return c.Recv()
+}
+
+// Close ends the input and returns what the router's Serve returned
+func (c *Conn) Close() error {
+	c.t.Helper()
+	c.in.Close()
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(Timeout):
+		c.t.Fatal("Timed out waiting for the router to stop")
+		return nil
+	}
+}
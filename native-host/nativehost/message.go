@@ -0,0 +1,257 @@
+package nativehost
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Message is a request from the browser. The envelope fields are common to
+// every action; the action's own fields are in Payload and read with
+// Decode.
+type Message struct {
+	ID              string          `json:"id,omitempty"` // Echoed in the response so a port can match replies
+	Action          string          `json:"action"`
+	ProtocolVersion int             `json:"protocolVersion,omitempty"` // 0 from extensions that predate a hello handshake
+	Payload         json.RawMessage `json:"payload,omitempty"`
+
+	extra []string // Top-level fields next to an explicit payload, which Decode rejects
+}
+
+// Response is a reply to the browser. The envelope fields are common to
+// every action; what an action returns goes in Result.
+type Response struct {
+	ID       string    `json:"id,omitempty"`
+	Type     string    `json:"type,omitempty"` // "progress" for interim frames, empty for the result
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Field    string    `json:"field,omitempty"`   // The payload field an invalid_request error is about
+	Actions  []string  `json:"actions,omitempty"` // The valid actions, with an "unknown" error
+	Progress *Progress `json:"progress,omitempty"`
+
+	// Result is the action's own output. It must marshal to a JSON object,
+	// whose fields are sent at the top level next to the envelope's, so
+	// they mustn't reuse an envelope field's name. A decoded Response
+	// holds the fields that aren't the envelope's as a json.RawMessage.
+	Result interface{} `json:"-"`
+}
+
+// envelope has Response's fields without its methods
+type envelope Response
+
+// envelopeFields are the JSON names of Response's own fields
+var envelopeFields = []string{"id", "type", "success", "error", "message", "field", "actions", "progress"}
+
+// MarshalJSON writes the envelope with Result's fields alongside
+func (r Response) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(envelope(r))
+	if err != nil || r.Result == nil {
+		return data, err
+	}
+	result, err := json.Marshal(r.Result)
+	if err != nil {
+		return nil, fmt.Errorf("result: %w", err)
+	}
+	result = bytes.TrimSpace(result)
+	if bytes.Equal(result, []byte("null")) {
+		return data, nil
+	}
+	if len(result) < 2 || result[0] != '{' {
+		return nil, fmt.Errorf("result is not a JSON object")
+	}
+	if len(bytes.TrimSpace(result[1:len(result)-1])) == 0 {
+		return data, nil
+	}
+	// Both are objects: splice the result's fields in before the closing brace
+	out := make([]byte, 0, len(data)+len(result))
+	out = append(out, data[:len(data)-1]...)
+	out = append(out, ',')
+	return append(out, result[1:]...), nil
+}
+
+// UnmarshalJSON reads the envelope fields and keeps the rest as Result
+func (r *Response) UnmarshalJSON(data []byte) error {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, name := range envelopeFields {
+		delete(fields, name)
+	}
+
+	*r = Response(env)
+	if len(fields) > 0 {
+		result, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		r.Result = json.RawMessage(result)
+	}
+	return nil
+}
+
+// UnmarshalJSON reads the envelope fields and keeps the rest as the raw
+// payload. Extensions may nest the payload under "payload" or, as older
+// versions do, send its fields at the top level next to "action".
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if fields == nil {
+		return fmt.Errorf("message is null")
+	}
+
+	*m = Message{}
+	targets := map[string]interface{}{
+		"id":              &m.ID,
+		"action":          &m.Action,
+		"protocolVersion": &m.ProtocolVersion,
+	}
+	for name, target := range targets {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		delete(fields, name)
+	}
+
+	if payload, ok := fields["payload"]; ok {
+		m.Payload = payload
+		delete(fields, "payload")
+		for name := range fields {
+			m.extra = append(m.extra, name)
+		}
+		sort.Strings(m.extra)
+		return nil
+	}
+	if len(fields) > 0 {
+		payload, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		m.Payload = payload
+	}
+	return nil
+}
+
+// FieldError reports a payload field that failed validation
+type FieldError struct {
+	Field  string
+	Reason string // Reads after the field name, e.g. "is required"
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Reason
+}
+
+// Decode reads the message's payload into v, a pointer to an action's
+// request struct. Unknown fields are rejected, and fields tagged
+// `required:"true"` must be present and non-empty. Errors are *FieldError.
+func Decode(msg *Message, v interface{}) error {
+	if len(msg.extra) > 0 {
+		return &FieldError{Field: msg.extra[0], Reason: "is not a known field"}
+	}
+
+	payload := bytes.TrimSpace(msg.Payload)
+	if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		payload = []byte("{}")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fieldError(err)
+	}
+	if dec.More() {
+		return &FieldError{Field: "payload", Reason: "has trailing data"}
+	}
+
+	return checkRequired(v)
+}
+
+// fieldError turns a JSON decoding error into a *FieldError
+func fieldError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := typeErr.Field
+		if field == "" {
+			field = "payload"
+		}
+		return &FieldError{Field: field, Reason: "must be " + jsonTypeName(typeErr.Type)}
+	}
+
+	// encoding/json has no type for unknown fields
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &FieldError{Field: strings.Trim(name, `"`), Reason: "is not a known field"}
+	}
+
+	return &FieldError{Field: "payload", Reason: "is not a valid JSON object"}
+}
+
+// jsonTypeName describes a Go type the way the extension sees it
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// checkRequired reports the first field tagged `required:"true"` that has
+// its zero value
+func checkRequired(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.Tag.Get("required") != "true" || !rv.Field(i).IsZero() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		return &FieldError{Field: name, Reason: "is required"}
+	}
+	return nil
+}
+
+// InvalidRequest is the reply to a message whose payload failed Decode
+func InvalidRequest(err error) Response {
+	resp := Response{
+		Success: false,
+		Error:   "invalid_request",
+		Message: "Invalid request: " + err.Error(),
+	}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		resp.Field = fieldErr.Field
+	}
+	return resp
+}
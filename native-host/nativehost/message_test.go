@@ -0,0 +1,242 @@
+package nativehost
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMessage_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantPayload string
+		wantErr     bool
+	}{
+		{
+			name:        "nested payload",
+			input:       `{"id":"1","action":"open","protocolVersion":1,"payload":{"filePath":"/tmp/a.txt"}}`,
+			wantPayload: `{"filePath":"/tmp/a.txt"}`,
+		},
+		{
+			name:        "legacy flat fields",
+			input:       `{"action":"open","filePath":"/tmp/a.txt"}`,
+			wantPayload: `{"filePath":"/tmp/a.txt"}`,
+		},
+		{
+			name:        "no payload",
+			input:       `{"action":"ping"}`,
+			wantPayload: ``,
+		},
+		{
+			name:    "action is not a string",
+			input:   `{"action":1}`,
+			wantErr: true,
+		},
+		{
+			name:    "null",
+			input:   `null`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			err := json.Unmarshal([]byte(tt.input), &msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unmarshal() expected error, got %+v", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if string(msg.Payload) != tt.wantPayload {
+				t.Errorf("Payload = %s, want %s", msg.Payload, tt.wantPayload)
+			}
+		})
+	}
+}
+
+// openRequest is a payload with required and optional fields
+type openRequest struct {
+	FilePath string `json:"filePath" required:"true"`
+	FileType string `json:"fileType,omitempty"`
+	AppID    string `json:"appId" required:"true"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		want       openRequest
+		wantField  string
+		wantReason string
+	}{
+		{
+			name:  "nested payload",
+			input: `{"action":"openWith","payload":{"filePath":"/tmp/a.docx","appId":"word"}}`,
+			want:  openRequest{FilePath: "/tmp/a.docx", AppID: "word"},
+		},
+		{
+			name:  "legacy flat fields",
+			input: `{"action":"openWith","filePath":"/tmp/a.docx","fileType":"docx","appId":"word"}`,
+			want:  openRequest{FilePath: "/tmp/a.docx", FileType: "docx", AppID: "word"},
+		},
+		{
+			name:       "missing required field",
+			input:      `{"action":"openWith","payload":{"filePath":"/tmp/a.docx"}}`,
+			wantField:  "appId",
+			wantReason: "is required",
+		},
+		{
+			name:       "empty required field",
+			input:      `{"action":"openWith","payload":{"filePath":"","appId":"word"}}`,
+			wantField:  "filePath",
+			wantReason: "is required",
+		},
+		{
+			name:       "wrong type",
+			input:      `{"action":"openWith","payload":{"filePath":42,"appId":"word"}}`,
+			wantField:  "filePath",
+			wantReason: "must be a string",
+		},
+		{
+			name:       "unknown field",
+			input:      `{"action":"openWith","payload":{"filePath":"/tmp/a.docx","appId":"word","app":"x"}}`,
+			wantField:  "app",
+			wantReason: "is not a known field",
+		},
+		{
+			name:       "top-level field next to payload",
+			input:      `{"action":"openWith","appId":"word","payload":{"filePath":"/tmp/a.docx"}}`,
+			wantField:  "appId",
+			wantReason: "is not a known field",
+		},
+		{
+			name:       "payload is not an object",
+			input:      `{"action":"openWith","payload":"/tmp/a.docx"}`,
+			wantField:  "payload",
+			wantReason: "must be an object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			if err := json.Unmarshal([]byte(tt.input), &msg); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+
+			var got openRequest
+			err := Decode(&msg, &got)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("Decode() error: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("Decode() error = %v, want a *FieldError", err)
+			}
+			if fieldErr.Field != tt.wantField || fieldErr.Reason != tt.wantReason {
+				t.Errorf("Decode() error = %q, want %q", err, tt.wantField+" "+tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestDecode_EmptyPayload(t *testing.T) {
+	msg := Message{Action: "ping"}
+	if err := Decode(&msg, &struct{}{}); err != nil {
+		t.Errorf("Decode() error: %v", err)
+	}
+
+	msg = Message{Action: "ping", Payload: json.RawMessage(`{"extra":true}`)}
+	if err := Decode(&msg, &struct{}{}); err == nil {
+		t.Error("Decode() accepted an unknown field")
+	}
+}
+
+func TestInvalidRequest(t *testing.T) {
+	resp := InvalidRequest(&FieldError{Field: "appId", Reason: "is required"})
+	if resp.Success || resp.Error != "invalid_request" || resp.Field != "appId" {
+		t.Errorf("InvalidRequest() = %+v", resp)
+	}
+	if resp.Message != "Invalid request: appId is required" {
+		t.Errorf("Message = %q", resp.Message)
+	}
+}
+
+func TestResponse_JSON(t *testing.T) {
+	type result struct {
+		FileType string `json:"fileType"`
+	}
+	tests := []struct {
+		name       string
+		resp       Response
+		want       string
+		wantResult bool // Whether the decoded response has a Result
+	}{
+		{
+			name: "no result",
+			resp: Response{ID: "1", Success: true},
+			want: `{"id":"1","success":true}`,
+		},
+		{
+			name:       "result fields next to the envelope",
+			resp:       Response{Success: false, Error: "unsupported_type", Result: result{FileType: "exe"}},
+			want:       `{"success":false,"error":"unsupported_type","fileType":"exe"}`,
+			wantResult: true,
+		},
+		{
+			name: "empty result",
+			resp: Response{Success: true, Result: struct{}{}},
+			want: `{"success":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.resp)
+			if err != nil {
+				t.Fatalf("Marshal() error: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", data, tt.want)
+			}
+
+			var got Response
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if got.Success != tt.resp.Success || got.Error != tt.resp.Error {
+				t.Errorf("Unmarshal() envelope = %+v", got)
+			}
+			if !tt.wantResult {
+				if got.Result != nil {
+					t.Errorf("Unmarshal() Result = %s, want none", got.Result)
+				}
+				return
+			}
+			var r result
+			raw, _ := got.Result.(json.RawMessage)
+			if err := json.Unmarshal(raw, &r); err != nil || r != tt.resp.Result {
+				t.Errorf("Unmarshal() Result = %s, want %+v", raw, tt.resp.Result)
+			}
+		})
+	}
+}
+
+func TestResponse_MarshalJSON_NotAnObject(t *testing.T) {
+	if _, err := json.Marshal(Response{Success: true, Result: []string{"a"}}); err == nil {
+		t.Error("Marshal() accepted a result that isn't an object")
+	}
+}
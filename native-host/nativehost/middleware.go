@@ -0,0 +1,154 @@
+package nativehost
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// label names a message in log lines
+func label(msg *Message) string {
+	if msg.ID == "" {
+		return msg.Action
+	}
+	return fmt.Sprintf("%s (id %s)", msg.Action, msg.ID)
+}
+
+// Logging logs each message's action and whether it succeeded
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) Response {
+			resp := next(ctx, msg)
+			if resp.Success {
+				log.Printf("%s: ok", label(msg))
+			} else {
+				log.Printf("%s: %s", label(msg), resp.Error)
+			}
+			return resp
+		}
+	}
+}
+
+// Timing logs messages that take longer than slow to serve
+func Timing(slow time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) Response {
+			start := time.Now()
+			resp := next(ctx, msg)
+			if elapsed := time.Since(start); elapsed > slow {
+				log.Printf("%s took %v", label(msg), elapsed.Round(time.Millisecond))
+			}
+			return resp
+		}
+	}
+}
+
+// Recover turns a handler panic into an "internal" error, so one bad
+// request can't take down the host, and writes a crash report naming the
+// host's version to crashDir. If crashDir is empty, the panic is only
+// logged.
+func Recover(crashDir, version string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) (resp Response) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				stack := debug.Stack()
+				log.Printf("Panic handling %s: %v", label(msg), v)
+				if crashDir != "" {
+					path, err := writeCrashReport(crashDir, version, msg, v, stack)
+					if err != nil {
+						log.Printf("Error writing crash report: %v\n%s", err, stack)
+					} else {
+						log.Printf("Crash report written to %s", path)
+					}
+				} else {
+					log.Printf("%s", stack)
+				}
+				resp = Response{
+					Success: false,
+					Error:   "internal",
+					Message: "The native host hit an internal error; details are in its log directory",
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// originKey is the context key for the caller's origin
+type originKey struct{}
+
+// WithOrigin returns a context recording the origin of the caller, such
+// as "chrome-extension://<id>/", for Authorize
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// Origin returns the caller's origin recorded by WithOrigin, or ""
+func Origin(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
+
+// Authorize refuses messages whose caller allow rejects for the action
+func Authorize(allow func(origin, action string) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) Response {
+			origin := Origin(ctx)
+			if !allow(origin, msg.Action) {
+				log.Printf("Refused %s from %q", label(msg), origin)
+				return Response{
+					Success: false,
+					Error:   "forbidden",
+					Message: "This caller is not allowed to use " + msg.Action,
+				}
+			}
+			return next(ctx, msg)
+		}
+	}
+}
+
+// RateLimit refuses messages beyond perSecond on average, allowing bursts
+// of up to burst at once
+func RateLimit(perSecond float64, burst int) Middleware {
+	return rateLimit(perSecond, burst, time.Now)
+}
+
+func rateLimit(perSecond float64, burst int, now func() time.Time) Middleware {
+	var (
+		mu     sync.Mutex
+		tokens = float64(burst)
+		last   = now()
+	)
+	take := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		t := now()
+		tokens = min(float64(burst), tokens+t.Sub(last).Seconds()*perSecond)
+		last = t
+		if tokens < 1 {
+			return false
+		}
+		tokens--
+		return true
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) Response {
+			if !take() {
+				return Response{
+					Success: false,
+					Error:   "rate_limited",
+					Message: "Too many requests; try again shortly",
+				}
+			}
+			return next(ctx, msg)
+		}
+	}
+}
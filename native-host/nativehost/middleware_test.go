@@ -0,0 +1,108 @@
+package nativehost
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ok is a handler that always succeeds
+func ok(ctx context.Context, msg *Message) Response {
+	return Response{Success: true}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	h := Recover(dir, "1.2.3 (abc123)")(func(ctx context.Context, msg *Message) Response {
+		panic("something broke")
+	})
+
+	resp := h(context.Background(), &Message{ID: "1", Action: "boom"})
+	if resp.Success || resp.Error != "internal" {
+		t.Errorf("Expected an internal error, got %+v", resp)
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(dir, "crash-*.txt"))
+	if len(reports) != 1 {
+		t.Fatalf("Expected one crash report, found %d", len(reports))
+	}
+	data, _ := os.ReadFile(reports[0])
+	for _, want := range []string{"Version:  1.2.3 (abc123)", "Action:   boom", "ID:       1", "Panic:    something broke", "middleware_test.go"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Crash report is missing %q:\n%s", want, data)
+		}
+	}
+	info, _ := os.Stat(reports[0])
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected file mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	allow := func(origin, action string) bool {
+		return origin == "chrome-extension://good/" || action == "ping"
+	}
+	h := Authorize(allow)(ok)
+
+	tests := []struct {
+		origin string
+		action string
+		want   bool
+	}{
+		{"chrome-extension://good/", "open", true},
+		{"chrome-extension://evil/", "open", false},
+		{"chrome-extension://evil/", "ping", true},
+		{"", "open", false},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.origin != "" {
+			ctx = WithOrigin(ctx, tt.origin)
+		}
+		resp := h(ctx, &Message{Action: tt.action})
+		if resp.Success != tt.want {
+			t.Errorf("%s from %q: got %+v, want success %v", tt.action, tt.origin, resp, tt.want)
+		}
+		if !tt.want && resp.Error != "forbidden" {
+			t.Errorf("Expected error 'forbidden', got %q", resp.Error)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	h := rateLimit(2, 3, func() time.Time { return now })(ok)
+	call := func() bool {
+		return h(context.Background(), &Message{Action: "ping"}).Success
+	}
+
+	// The burst is available at once, then nothing until time passes
+	for i := 0; i < 3; i++ {
+		if !call() {
+			t.Fatalf("Request %d of the burst was refused", i+1)
+		}
+	}
+	if resp := h(context.Background(), &Message{Action: "ping"}); resp.Error != "rate_limited" {
+		t.Errorf("Expected rate_limited after the burst, got %+v", resp)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !call() {
+		t.Error("Expected one request after half a second at 2/s")
+	}
+	if call() {
+		t.Error("Expected the refilled token to be used up")
+	}
+
+	// Tokens never build up past the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		call()
+	}
+	if call() {
+		t.Error("Expected at most a burst of 3 after a long idle")
+	}
+}
@@ -0,0 +1,37 @@
+package nativehost
+
+import "context"
+
+// ResponseTypeProgress marks an interim frame sent before a request's result
+const ResponseTypeProgress = "progress"
+
+// Progress reports how far a long-running request has got
+type Progress struct {
+	Stage string `json:"stage"` // e.g. "scanning" or "opening"
+}
+
+// progressKey is the context key for a request's progress reporter
+type progressKey struct{}
+
+// WithProgress returns a context whose ReportProgress calls go to report
+func WithProgress(ctx context.Context, report func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// ReportProgress sends an interim progress frame for the request ctx
+// belongs to. It does nothing if the caller can't receive them: only
+// requests with an ID, sent over a long-lived port, get progress frames.
+func ReportProgress(ctx context.Context, stage string) {
+	if report, ok := ctx.Value(progressKey{}).(func(Progress)); ok {
+		report(Progress{Stage: stage})
+	}
+}
+
+// Canceled is the reply to a request that was canceled before it finished
+func Canceled() Response {
+	return Response{
+		Success: false,
+		Error:   "canceled",
+		Message: "The request was canceled",
+	}
+}
@@ -0,0 +1,130 @@
+// Package nativehost is the reusable core of a browser native messaging
+// host: length-prefixed framing, a router that dispatches messages by
+// action name, and middleware for logging, timing, panic recovery, caller
+// authorization and rate limiting. The Reclaim host is built on it, and
+// other hosts can register their own actions the same way.
+package nativehost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Handler serves one message. ctx is canceled when the caller cancels the
+// request; handlers with side effects should check it before acting.
+type Handler func(ctx context.Context, msg *Message) Response
+
+// Middleware wraps a handler. It sees every message the router receives,
+// including those for unknown actions.
+type Middleware func(next Handler) Handler
+
+// Router dispatches messages to the handler registered for their action
+type Router struct {
+	mu         sync.RWMutex
+	handlers   map[string]Handler
+	middleware []Middleware
+}
+
+// NewRouter returns a router with no actions
+func NewRouter() *Router {
+	return &Router{handlers: make(map[string]Handler)}
+}
+
+// Handle registers the handler for an action, replacing any before it
+func (r *Router) Handle(action string, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[action] = h
+}
+
+// Use adds middleware. The first added is outermost: it sees a message
+// first and the response last.
+func (r *Router) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Actions returns the registered action names, sorted
+func (r *Router) Actions() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatch runs msg through the middleware to its action's handler
+func (r *Router) Dispatch(ctx context.Context, msg *Message) Response {
+	return r.chain(r.route)(ctx, msg)
+}
+
+// admit runs a streamBegin or cancel frame through the middleware, so the
+// server only opens a stream or cancels a request for a caller that may
+// send messages and isn't over its rate
+func (r *Router) admit(ctx context.Context, msg *Message) Response {
+	return r.chain(func(ctx context.Context, msg *Message) Response {
+		return Response{Success: true}
+	})(ctx, msg)
+}
+
+// chain wraps h in the middleware
+func (r *Router) chain(h Handler) Handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h
+}
+
+// route calls the handler for msg's action, or answers with the actions
+// there are
+func (r *Router) route(ctx context.Context, msg *Message) Response {
+	r.mu.RLock()
+	h, ok := r.handlers[msg.Action]
+	r.mu.RUnlock()
+	if ok {
+		return h(ctx, msg)
+	}
+
+	actions := r.Actions()
+	return Response{
+		Success: false,
+		Error:   "unknown",
+		Message: fmt.Sprintf("Unknown action: %s; valid actions are %s", msg.Action, strings.Join(actions, ", ")),
+		Actions: actions,
+	}
+}
+
+// Serve answers messages read from in on out until in reaches EOF or can't
+// be read. Messages with an ID run concurrently and can be canceled;
+// messages too big for one frame arrive as streams, and the middleware
+// sees each stream's streamBegin frame before any data is accepted, and
+// each cancel before it's acted on.
+// Handlers' contexts derive from ctx; see WithOrigin.
+func (r *Router) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s := newServer(r.Dispatch, out, defaultWorkers)
+	s.Admit(r.admit)
+	return s.Serve(ctx, in)
+}
+
+// Typed adapts a handler for one action's request type. The payload is
+// decoded strictly into T, and a payload that doesn't fit is answered
+// with invalid_request before the handler runs.
+func Typed[T any](fn func(ctx context.Context, req T) Response) Handler {
+	return func(ctx context.Context, msg *Message) Response {
+		var req T
+		if err := Decode(msg, &req); err != nil {
+			return InvalidRequest(err)
+		}
+		return fn(ctx, req)
+	}
+}
@@ -0,0 +1,133 @@
+package nativehost_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reclaim/openwith/nativehost"
+	"github.com/reclaim/openwith/nativehost/hosttest"
+)
+
+// echoRequest is the payload of the test router's echo action
+type echoRequest struct {
+	Text string `json:"text" required:"true"`
+}
+
+func newTestRouter() *nativehost.Router {
+	r := nativehost.NewRouter()
+	r.Handle("echo", nativehost.Typed(func(ctx context.Context, req echoRequest) nativehost.Response {
+		return nativehost.Response{Success: true, Message: req.Text}
+	}))
+	r.Handle("ping", func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+		return nativehost.Response{Success: true, Message: "pong"}
+	})
+	return r
+}
+
+func TestRouter_Dispatch(t *testing.T) {
+	r := newTestRouter()
+
+	resp := r.Dispatch(context.Background(), &nativehost.Message{Action: "echo", Payload: json.RawMessage(`{"text":"hi"}`)})
+	if !resp.Success || resp.Message != "hi" {
+		t.Errorf("echo = %+v", resp)
+	}
+
+	resp = r.Dispatch(context.Background(), &nativehost.Message{Action: "echo", Payload: json.RawMessage(`{}`)})
+	if resp.Error != "invalid_request" || resp.Field != "text" {
+		t.Errorf("echo without text = %+v, want invalid_request on text", resp)
+	}
+}
+
+func TestRouter_UnknownAction(t *testing.T) {
+	r := newTestRouter()
+
+	resp := r.Dispatch(context.Background(), &nativehost.Message{Action: "launch"})
+	if resp.Error != "unknown" {
+		t.Fatalf("Expected error 'unknown', got %+v", resp)
+	}
+	if want := []string{"echo", "ping"}; !reflect.DeepEqual(resp.Actions, want) {
+		t.Errorf("Actions = %v, want %v", resp.Actions, want)
+	}
+	if !strings.Contains(resp.Message, "echo, ping") {
+		t.Errorf("Message = %q, want it to list the actions", resp.Message)
+	}
+}
+
+func TestRouter_MiddlewareOrder(t *testing.T) {
+	r := newTestRouter()
+
+	var order []string
+	trace := func(name string) nativehost.Middleware {
+		return func(next nativehost.Handler) nativehost.Handler {
+			return func(ctx context.Context, msg *nativehost.Message) nativehost.Response {
+				order = append(order, name+" in")
+				resp := next(ctx, msg)
+				order = append(order, name+" out")
+				return resp
+			}
+		}
+	}
+	r.Use(trace("outer"), trace("inner"))
+
+	// Middleware sees unknown actions too
+	r.Dispatch(context.Background(), &nativehost.Message{Action: "nope"})
+
+	want := []string{"outer in", "inner in", "inner out", "outer out"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Order = %v, want %v", order, want)
+	}
+}
+
+func TestRouter_Serve(t *testing.T) {
+	c := hosttest.Start(t, newTestRouter())
+
+	if resp := c.Call("ping", nil); resp.Message != "pong" {
+		t.Errorf("ping = %+v", resp)
+	}
+
+	// A request and reply too big for one frame are streamed both ways
+	big := strings.Repeat("b", nativehost.MaxMessageSize+1)
+	if resp := c.Call("echo", echoRequest{Text: big}); resp.Message != big {
+		t.Errorf("echo of %d bytes came back with %d", len(big), len(resp.Message))
+	}
+
+	c.SendRaw([]byte("{oops"))
+	if resp := c.Recv(); resp.Error != "invalid_request" {
+		t.Errorf("Expected invalid_request for bad JSON, got %+v", resp)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Serve() error: %v", err)
+	}
+}
+
+func TestRouter_ServeOrigin(t *testing.T) {
+	r := newTestRouter()
+	r.Use(nativehost.Authorize(func(origin, action string) bool {
+		return origin == "chrome-extension://good/"
+	}))
+
+	if resp := hosttest.StartAs(t, r, "chrome-extension://good/").Call("ping", nil); !resp.Success {
+		t.Errorf("ping from an allowed origin = %+v", resp)
+	}
+	if resp := hosttest.Start(t, r).Call("ping", nil); resp.Error != "forbidden" {
+		t.Errorf("ping without an origin = %+v, want forbidden", resp)
+	}
+
+	// A refused caller can't open a stream either, so the host never
+	// buffers its data
+	c := hosttest.Start(t, r)
+	c.Send(nativehost.Message{Action: "echo", Payload: json.RawMessage(`{"text":"` + strings.Repeat("b", nativehost.MaxMessageSize) + `"}`)})
+	if resp := c.Recv(); resp.Error != "forbidden" || !strings.Contains(resp.Message, nativehost.ActionStreamBegin) {
+		t.Errorf("Stream from a refused caller = %+v, want forbidden for streamBegin", resp)
+	}
+
+	// Nor cancel requests
+	cancel := map[string]string{"requestId": "1"}
+	if resp := hosttest.Start(t, r).Call(nativehost.ActionCancel, cancel); resp.Error != "forbidden" {
+		t.Errorf("cancel from a refused caller = %+v, want forbidden", resp)
+	}
+}
@@ -0,0 +1,266 @@
+package nativehost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+const (
+	// defaultWorkers is how many requests with an ID run at once
+	defaultWorkers = 4
+	// queueSize is how many requests can wait for a worker before new
+	// ones are turned away as busy
+	queueSize = 32
+)
+
+// ActionCancel cancels a running request. The server answers it itself.
+const ActionCancel = "cancel"
+
+// CancelRequest is the payload of cancel
+type CancelRequest struct {
+	RequestID string `json:"requestId" required:"true"` // ID of the request to cancel
+}
+
+// job is a request waiting for a worker
+type job struct {
+	ctx context.Context
+	msg *Message
+}
+
+// server runs the native messaging loop for one connection. It reads
+// requests, runs those with an ID on a bounded pool of workers so a slow
+// request doesn't hold up the rest, and serializes every reply onto the
+// output stream.
+type server struct {
+	handle  Handler
+	admit   Handler // Checks streamBegin and cancel frames, if set
+	workers int
+	out     io.Writer
+	writeMu sync.Mutex // Serializes frames on out
+	queue   chan job
+	streams *streamTable
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc // By request ID
+}
+
+// newServer returns a server that dispatches to handle and writes replies to out
+func newServer(handle Handler, out io.Writer, workers int) *server {
+	if workers < 1 {
+		workers = 1
+	}
+	return &server{
+		handle:   handle,
+		workers:  workers,
+		out:      out,
+		queue:    make(chan job, queueSize),
+		streams:  newStreamTable(streamTimeout),
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// Admit sets a check run on the frames the server acts on without the
+// handler: every streamBegin, before its stream is opened, and every
+// cancel. A frame admit doesn't answer with success gets admit's response
+// instead, so a caller the host would refuse can't make it buffer stream
+// data or cancel requests. It must be called before Serve.
+func (s *server) Admit(admit Handler) {
+	s.admit = admit
+}
+
+// refused runs msg through admit and returns the response to send in its
+// place, or false if admit lets it through
+func (s *server) refused(ctx context.Context, msg *Message) (Response, bool) {
+	if s.admit == nil {
+		return Response{}, false
+	}
+	resp := s.admit(ctx, msg)
+	if resp.Success {
+		return Response{}, false
+	}
+	resp.ID = msg.ID
+	return resp, true
+}
+
+// Serve reads requests from in until EOF or a read error, then waits for
+// running requests to finish. Requests without an ID are handled in order
+// on the reading goroutine, as a one-shot sendNativeMessage expects.
+// Requests with an ID are queued for the workers and answered as they
+// finish, in any order; "cancel" is answered immediately. A message too
+// big for one frame arrives as a stream and is served once reassembled.
+// Every request's context derives from ctx, so values on ctx, such as the
+// caller's identity, reach the handler.
+func (s *server) Serve(ctx context.Context, in io.Reader) error {
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range s.queue {
+				s.run(j)
+			}
+		}()
+	}
+	defer func() {
+		s.streams.Close()
+		close(s.queue)
+		wg.Wait()
+	}()
+
+	for {
+		msg, err := ReadMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		var frameErr *FrameError
+		if errors.As(err, &frameErr) {
+			log.Printf("Skipping bad message: %v", err)
+			s.write(InvalidFrame(err))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if IsStreamAction(msg.Action) {
+			if msg.Action == ActionStreamBegin {
+				if resp, ok := s.refused(ctx, msg); ok {
+					s.write(resp)
+					continue
+				}
+			}
+			full, err := s.streams.Handle(msg)
+			if err != nil {
+				s.write(StreamFailed(msg.ID, err))
+				continue
+			}
+			if full == nil {
+				// More frames to come
+				continue
+			}
+			msg = full
+		}
+
+		switch {
+		case msg.Action == ActionCancel:
+			if resp, ok := s.refused(ctx, msg); ok {
+				s.write(resp)
+				continue
+			}
+			s.write(s.cancel(msg))
+		case msg.ID == "":
+			s.write(s.handle(ctx, msg))
+		default:
+			s.enqueue(ctx, msg)
+		}
+	}
+}
+
+// enqueue hands a request with an ID to the workers, or answers it with
+// an error if the ID is already in use or the queue is full
+func (s *server) enqueue(parent context.Context, msg *Message) {
+	ctx, cancel := context.WithCancel(parent)
+
+	s.mu.Lock()
+	if _, dup := s.inflight[msg.ID]; dup {
+		s.mu.Unlock()
+		cancel()
+		s.write(Response{
+			ID:      msg.ID,
+			Success: false,
+			Error:   "duplicate_id",
+			Message: fmt.Sprintf("A request with id %q is already running", msg.ID),
+		})
+		return
+	}
+	s.inflight[msg.ID] = cancel
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- job{ctx: ctx, msg: msg}:
+	default:
+		s.finish(msg.ID)
+		s.write(Response{
+			ID:      msg.ID,
+			Success: false,
+			Error:   "busy",
+			Message: "Too many requests are in progress; try again shortly",
+		})
+	}
+}
+
+// run serves one queued request on a worker
+func (s *server) run(j job) {
+	id := j.msg.ID
+	defer s.finish(id)
+
+	var resp Response
+	if j.ctx.Err() != nil {
+		// Canceled while waiting in the queue
+		resp = Canceled()
+	} else {
+		ctx := WithProgress(j.ctx, func(p Progress) {
+			s.write(Response{
+				ID:       id,
+				Type:     ResponseTypeProgress,
+				Success:  true,
+				Progress: &p,
+			})
+		})
+		resp = s.handle(ctx, j.msg)
+	}
+
+	resp.ID = id
+	s.write(resp)
+}
+
+// finish releases a request's ID and context
+func (s *server) finish(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.inflight[id]; ok {
+		cancel()
+		delete(s.inflight, id)
+	}
+}
+
+// cancel cancels the request named by the cancel message's requestId. The
+// canceled request still gets its own reply, normally a "canceled" error.
+func (s *server) cancel(msg *Message) Response {
+	var req CancelRequest
+	if err := Decode(msg, &req); err != nil {
+		resp := InvalidRequest(err)
+		resp.ID = msg.ID
+		return resp
+	}
+	target := req.RequestID
+
+	s.mu.Lock()
+	cancel, ok := s.inflight[target]
+	s.mu.Unlock()
+	if !ok {
+		return Response{
+			ID:      msg.ID,
+			Success: false,
+			Error:   "not_found",
+			Message: fmt.Sprintf("No request with id %q is running", target),
+		}
+	}
+
+	cancel()
+	return Response{ID: msg.ID, Success: true}
+}
+
+// write sends one response, as a stream if it's too big for one frame.
+// Frames from different workers never interleave.
+func (s *server) write(resp Response) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := WriteMessage(s.out, resp); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
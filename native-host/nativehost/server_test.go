@@ -0,0 +1,378 @@
+package nativehost
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// conn is a running server with a pipe for its input and a channel of
+// the frames it has written
+type conn struct {
+	in     *io.PipeWriter
+	frames chan Response
+	done   chan error
+}
+
+func start(t *testing.T, handle Handler, workers int) *conn {
+	t.Helper()
+	return startWith(t, func(out io.Writer) *server {
+		return newServer(handle, out, workers)
+	})
+}
+
+// startWith serves the server build returns for the output it's given
+func startWith(t *testing.T, build func(out io.Writer) *server) *conn {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &conn{in: inW, frames: make(chan Response, 256), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- build(outW).Serve(context.Background(), inR)
+		outW.Close()
+	}()
+
+	// Read frames as they're written so the server never blocks on output
+	go func() {
+		for {
+			var length uint32
+			if err := binary.Read(outR, binary.LittleEndian, &length); err != nil {
+				return
+			}
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(outR, buf); err != nil {
+				return
+			}
+			var resp Response
+			if err := json.Unmarshal(buf, &resp); err != nil {
+				return
+			}
+			c.frames <- resp
+		}
+	}()
+
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
+
+func (c *conn) send(t *testing.T, msg Message) {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendRaw(t, data)
+}
+
+// sendRaw sends data as one frame, whether or not it's a valid message
+func (c *conn) sendRaw(t *testing.T, data []byte) {
+	t.Helper()
+	if err := binary.Write(c.in, binary.LittleEndian, uint32(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.in.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *conn) recv(t *testing.T) Response {
+	t.Helper()
+	select {
+	case resp := <-c.frames:
+		return resp
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a response")
+		return Response{}
+	}
+}
+
+// echo replies with the action as the message
+func echo(ctx context.Context, msg *Message) Response {
+	return Response{Success: true, Message: msg.Action}
+}
+
+func TestServe_WithoutID(t *testing.T) {
+	c := start(t, echo, 2)
+
+	c.send(t, Message{Action: "first"})
+	c.send(t, Message{Action: "second"})
+
+	for _, want := range []string{"first", "second"} {
+		resp := c.recv(t)
+		if resp.Message != want || resp.ID != "" {
+			t.Errorf("Got %+v, want %q with no id", resp, want)
+		}
+	}
+
+	c.in.Close()
+	if err := <-c.done; err != nil {
+		t.Errorf("Serve() error: %v", err)
+	}
+}
+
+func TestServe_SlowRequestDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	handle := func(ctx context.Context, msg *Message) Response {
+		if msg.Action == "slow" {
+			<-release
+		}
+		return echo(ctx, msg)
+	}
+	c := start(t, handle, 2)
+
+	c.send(t, Message{ID: "1", Action: "slow"})
+	c.send(t, Message{ID: "2", Action: "fast"})
+
+	if resp := c.recv(t); resp.ID != "2" || resp.Message != "fast" {
+		t.Fatalf("Expected the fast reply first, got %+v", resp)
+	}
+	close(release)
+	if resp := c.recv(t); resp.ID != "1" || resp.Message != "slow" {
+		t.Errorf("Expected the slow reply, got %+v", resp)
+	}
+}
+
+func TestServe_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	handle := func(ctx context.Context, msg *Message) Response {
+		close(started)
+		<-ctx.Done()
+		return Canceled()
+	}
+	c := start(t, handle, 1)
+
+	c.send(t, Message{ID: "1", Action: "open"})
+	<-started
+	c.send(t, Message{ID: "c1", Action: "cancel", Payload: json.RawMessage(`{"requestId":"1"}`)})
+
+	got := map[string]Response{}
+	for i := 0; i < 2; i++ {
+		resp := c.recv(t)
+		got[resp.ID] = resp
+	}
+	if !got["c1"].Success {
+		t.Errorf("Expected cancel to succeed, got %+v", got["c1"])
+	}
+	if got["1"].Error != "canceled" {
+		t.Errorf("Expected the request to be canceled, got %+v", got["1"])
+	}
+}
+
+func TestServe_CancelErrors(t *testing.T) {
+	c := start(t, echo, 1)
+
+	c.send(t, Message{ID: "c1", Action: "cancel", Payload: json.RawMessage(`{"requestId":"missing"}`)})
+	if resp := c.recv(t); resp.Error != "not_found" || resp.ID != "c1" {
+		t.Errorf("Expected not_found, got %+v", resp)
+	}
+
+	c.send(t, Message{ID: "c2", Action: "cancel"})
+	if resp := c.recv(t); resp.Error != "invalid_request" {
+		t.Errorf("Expected invalid_request, got %+v", resp)
+	}
+}
+
+func TestServe_Progress(t *testing.T) {
+	handle := func(ctx context.Context, msg *Message) Response {
+		ReportProgress(ctx, "scanning")
+		return echo(ctx, msg)
+	}
+	c := start(t, handle, 1)
+
+	c.send(t, Message{ID: "1", Action: "open"})
+	resp := c.recv(t)
+	if resp.ID != "1" || resp.Type != ResponseTypeProgress || resp.Progress == nil || resp.Progress.Stage != "scanning" {
+		t.Errorf("Expected a progress frame, got %+v", resp)
+	}
+	resp = c.recv(t)
+	if resp.ID != "1" || resp.Type != "" || resp.Message != "open" {
+		t.Errorf("Expected the result, got %+v", resp)
+	}
+
+	// A one-shot request gets only its result
+	c.send(t, Message{Action: "open"})
+	if resp := c.recv(t); resp.Type != "" || resp.Message != "open" {
+		t.Errorf("Expected the result without progress, got %+v", resp)
+	}
+}
+
+func TestServe_DuplicateID(t *testing.T) {
+	release := make(chan struct{})
+	handle := func(ctx context.Context, msg *Message) Response {
+		<-release
+		return echo(ctx, msg)
+	}
+	c := start(t, handle, 1)
+
+	c.send(t, Message{ID: "1", Action: "open"})
+	c.send(t, Message{ID: "1", Action: "open"})
+	if resp := c.recv(t); resp.Error != "duplicate_id" {
+		t.Errorf("Expected duplicate_id, got %+v", resp)
+	}
+	close(release)
+	if resp := c.recv(t); !resp.Success {
+		t.Errorf("Expected the first request to succeed, got %+v", resp)
+	}
+}
+
+func TestServe_Busy(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	handle := func(ctx context.Context, msg *Message) Response {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return echo(ctx, msg)
+	}
+	c := start(t, handle, 1)
+
+	// One running, queueSize waiting; the next is turned away. Let the
+	// first reach the worker so the queue count is exact.
+	c.send(t, Message{ID: "running", Action: "open"})
+	<-started
+	for i := 0; i < queueSize; i++ {
+		c.send(t, Message{ID: string(rune('A' + i)), Action: "open"})
+	}
+	c.send(t, Message{ID: "extra", Action: "open"})
+
+	if resp := c.recv(t); resp.ID != "extra" || resp.Error != "busy" {
+		t.Errorf("Expected busy for the extra request, got %+v", resp)
+	}
+	close(release)
+	for i := 0; i < queueSize+1; i++ {
+		if resp := c.recv(t); !resp.Success {
+			t.Errorf("Expected queued requests to succeed, got %+v", resp)
+		}
+	}
+}
+
+func TestServe_Stream(t *testing.T) {
+	handle := func(ctx context.Context, msg *Message) Response {
+		return Response{Success: true, Message: string(msg.Payload)}
+	}
+	c := start(t, handle, 1)
+
+	// A request over the frame limit, sent as a stream
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":      "big",
+		"action":  "open",
+		"payload": map[string]string{"data": strings.Repeat("x", MaxMessageSize)},
+	})
+	payload := func(v interface{}) json.RawMessage {
+		data, _ := json.Marshal(v)
+		return data
+	}
+	const chunkSize = 256 * 1024
+	chunks := (len(body) + chunkSize - 1) / chunkSize
+
+	c.send(t, Message{Action: ActionStreamBegin, Payload: payload(StreamBegin{
+		StreamID: "s1", Size: len(body), Chunks: chunks,
+	})})
+	for seq := 0; seq < chunks; seq++ {
+		end := min((seq+1)*chunkSize, len(body))
+		c.send(t, Message{Action: ActionStreamChunk, Payload: payload(StreamChunk{
+			StreamID: "s1", Seq: seq, Data: base64.StdEncoding.EncodeToString(body[seq*chunkSize : end]),
+		})})
+	}
+	sum := sha256.Sum256(body)
+	c.send(t, Message{Action: ActionStreamEnd, Payload: payload(StreamEnd{
+		StreamID: "s1", SHA256: hex.EncodeToString(sum[:]),
+	})})
+
+	// The reply echoes the payload, so it comes back as a stream too
+	var frames []Response
+	for {
+		resp := c.recv(t)
+		frames = append(frames, resp)
+		if resp.Type == ActionStreamEnd {
+			break
+		}
+	}
+	if len(frames) < 3 || frames[0].Type != ActionStreamBegin || frames[0].ID != "big" {
+		t.Errorf("Expected the reply as a stream, got %d frames starting %+v", len(frames), frames[0])
+	}
+
+	// A broken stream is refused without reaching the handler
+	c.send(t, Message{ID: "e1", Action: ActionStreamChunk, Payload: payload(StreamChunk{
+		StreamID: "nope", Seq: 0, Data: "AA==",
+	})})
+	if resp := c.recv(t); resp.ID != "e1" || resp.Error != "stream_failed" {
+		t.Errorf("Expected stream_failed, got %+v", resp)
+	}
+}
+
+func TestServe_Admit(t *testing.T) {
+	c := startWith(t, func(out io.Writer) *server {
+		s := newServer(echo, out, 1)
+		s.Admit(func(ctx context.Context, msg *Message) Response {
+			return Response{Success: false, Error: "forbidden"}
+		})
+		return s
+	})
+
+	// The stream is refused at its begin frame, so its chunk finds
+	// nothing open
+	c.send(t, Message{ID: "b", Action: ActionStreamBegin,
+		Payload: json.RawMessage(`{"streamId":"s1","size":2,"chunks":1}`)})
+	if resp := c.recv(t); resp.ID != "b" || resp.Error != "forbidden" {
+		t.Errorf("streamBegin = %+v, want forbidden", resp)
+	}
+	c.send(t, Message{ID: "c", Action: ActionStreamChunk,
+		Payload: json.RawMessage(`{"streamId":"s1","seq":0,"data":"AAA="}`)})
+	if resp := c.recv(t); resp.ID != "c" || resp.Error != "stream_failed" {
+		t.Errorf("streamChunk = %+v, want stream_failed", resp)
+	}
+
+	// A cancel is refused before it's looked at
+	c.send(t, Message{ID: "x", Action: ActionCancel, Payload: json.RawMessage(`{"requestId":"1"}`)})
+	if resp := c.recv(t); resp.ID != "x" || resp.Error != "forbidden" {
+		t.Errorf("cancel = %+v, want forbidden", resp)
+	}
+}
+
+func TestServe_BadFrames(t *testing.T) {
+	c := start(t, echo, 1)
+
+	c.sendRaw(t, []byte("not valid json"))
+	if resp := c.recv(t); resp.Error != "invalid_request" {
+		t.Errorf("Expected invalid_request for bad JSON, got %+v", resp)
+	}
+	c.sendRaw(t, []byte(strings.Repeat("x", MaxMessageSize+1)))
+	if resp := c.recv(t); resp.Error != "invalid_request" {
+		t.Errorf("Expected invalid_request for an oversize frame, got %+v", resp)
+	}
+
+	// The connection is still usable
+	c.send(t, Message{Action: "after"})
+	if resp := c.recv(t); resp.Message != "after" {
+		t.Errorf("Expected the next message to be served, got %+v", resp)
+	}
+}
+
+func TestServe_ShortReadEnds(t *testing.T) {
+	c := start(t, echo, 1)
+
+	// A length prefix promising more than ever arrives
+	binary.Write(c.in, binary.LittleEndian, uint32(100))
+	c.in.Write([]byte("short"))
+	c.in.Close()
+
+	select {
+	case err := <-c.done:
+		if err == nil {
+			t.Error("Expected Serve() to fail on a short read")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() kept running after a short read")
+	}
+}
@@ -0,0 +1,330 @@
+package nativehost
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chrome caps a single message at 1 MB in each direction. Anything larger
+// crosses the pipe as a stream: a streamBegin frame, numbered streamChunk
+// frames carrying base64 data, and a streamEnd frame with the SHA-256 of
+// the whole. The reassembled bytes are one ordinary message (inbound) or
+// response (outbound).
+const (
+	ActionStreamBegin = "streamBegin"
+	ActionStreamChunk = "streamChunk"
+	ActionStreamEnd   = "streamEnd"
+
+	// MaxStreamSize is the largest message the host will reassemble (64MB)
+	MaxStreamSize = 64 * 1024 * 1024
+	// StreamChunkSize is how many bytes each outbound chunk carries. Base64
+	// and the frame's JSON keep the frame well under MaxMessageSize.
+	StreamChunkSize = 512 * 1024
+	// streamTimeout is how long an inbound stream may go without a frame
+	// before it's abandoned and its data freed
+	streamTimeout = 30 * time.Second
+
+	// maxOpenStreams bounds how many inbound streams can be in progress
+	maxOpenStreams = 4
+)
+
+// StreamBegin opens a stream of Size bytes split into Chunks chunks
+type StreamBegin struct {
+	StreamID string `json:"streamId" required:"true"`
+	Size     int    `json:"size"`
+	Chunks   int    `json:"chunks"`
+}
+
+// StreamChunk carries one piece of a stream. Seq counts from 0 and chunks
+// must arrive in order.
+type StreamChunk struct {
+	StreamID string `json:"streamId" required:"true"`
+	Seq      int    `json:"seq"`
+	Data     string `json:"data" required:"true"` // Standard base64
+}
+
+// StreamEnd closes a stream
+type StreamEnd struct {
+	StreamID string `json:"streamId" required:"true"`
+	SHA256   string `json:"sha256" required:"true"` // Hex digest of the reassembled bytes
+}
+
+// IsStreamAction reports whether action is part of the stream sub-protocol
+func IsStreamAction(action string) bool {
+	switch action {
+	case ActionStreamBegin, ActionStreamChunk, ActionStreamEnd:
+		return true
+	}
+	return false
+}
+
+// StreamError reports a stream that failed and was discarded
+type StreamError struct {
+	StreamID string
+	Reason   string
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream %q %s", e.StreamID, e.Reason)
+}
+
+// StreamFailed is the reply to a stream frame that streamTable rejected, sent
+// with the frame's own ID
+func StreamFailed(id string, err error) Response {
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) {
+		resp := InvalidRequest(err)
+		resp.ID = id
+		return resp
+	}
+	return Response{
+		ID:      id,
+		Success: false,
+		Error:   "stream_failed",
+		Message: "Stream failed: " + err.Error(),
+	}
+}
+
+// inStream is an inbound stream being reassembled
+type inStream struct {
+	size   int
+	chunks int
+	next   int // Seq of the next chunk expected
+	buf    bytes.Buffer
+	timer  *time.Timer
+}
+
+// streamTable reassembles inbound streams for one connection
+type streamTable struct {
+	timeout time.Duration
+
+	mu   sync.Mutex
+	open map[string]*inStream // By stream ID
+}
+
+// newStreamTable returns a reassembler that abandons streams idle for longer
+// than timeout
+func newStreamTable(timeout time.Duration) *streamTable {
+	return &streamTable{
+		timeout: timeout,
+		open:    make(map[string]*inStream),
+	}
+}
+
+// Handle takes one stream frame. It returns the reassembled message when
+// msg is a streamEnd whose stream checks out, and nil until then. On any
+// error the stream is discarded; the error is a *FieldError for a frame
+// that doesn't decode and a *StreamError otherwise.
+func (s *streamTable) Handle(msg *Message) (*Message, error) {
+	switch msg.Action {
+	case ActionStreamBegin:
+		var req StreamBegin
+		if err := Decode(msg, &req); err != nil {
+			return nil, err
+		}
+		return nil, s.begin(req)
+	case ActionStreamChunk:
+		var req StreamChunk
+		if err := Decode(msg, &req); err != nil {
+			return nil, err
+		}
+		return nil, s.chunk(req)
+	case ActionStreamEnd:
+		var req StreamEnd
+		if err := Decode(msg, &req); err != nil {
+			return nil, err
+		}
+		return s.end(req)
+	}
+	return nil, fmt.Errorf("%s is not a stream action", msg.Action)
+}
+
+func (s *streamTable) begin(req StreamBegin) error {
+	fail := func(reason string) error {
+		return &StreamError{StreamID: req.StreamID, Reason: reason}
+	}
+	if req.Size <= 0 || req.Size > MaxStreamSize {
+		return fail(fmt.Sprintf("has size %d; streams must be 1 to %d bytes", req.Size, MaxStreamSize))
+	}
+	if req.Chunks <= 0 || req.Chunks > req.Size {
+		return fail(fmt.Sprintf("has %d chunks for %d bytes", req.Chunks, req.Size))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, dup := s.open[req.StreamID]; dup {
+		return fail("is already open")
+	}
+	if len(s.open) >= maxOpenStreams {
+		return fail(fmt.Sprintf("can't open; %d streams are already in progress", maxOpenStreams))
+	}
+
+	st := &inStream{size: req.Size, chunks: req.Chunks}
+	st.timer = time.AfterFunc(s.timeout, func() { s.abandon(req.StreamID, st) })
+	s.open[req.StreamID] = st
+	return nil
+}
+
+func (s *streamTable) chunk(req StreamChunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.open[req.StreamID]
+	if !ok {
+		return &StreamError{StreamID: req.StreamID, Reason: "is not open"}
+	}
+	fail := func(reason string) error {
+		s.dropLocked(req.StreamID, st)
+		return &StreamError{StreamID: req.StreamID, Reason: reason}
+	}
+
+	if req.Seq != st.next {
+		return fail(fmt.Sprintf("got chunk %d, expected chunk %d", req.Seq, st.next))
+	}
+	if st.next >= st.chunks {
+		return fail(fmt.Sprintf("got more than the %d chunks announced", st.chunks))
+	}
+	data, err := base64.StdEncoding.DecodeString(req.Data)
+	if err != nil {
+		return fail(fmt.Sprintf("chunk %d is not valid base64", req.Seq))
+	}
+	if st.buf.Len()+len(data) > st.size {
+		return fail(fmt.Sprintf("is longer than the %d bytes announced", st.size))
+	}
+
+	st.buf.Write(data)
+	st.next++
+	st.timer.Reset(s.timeout)
+	return nil
+}
+
+func (s *streamTable) end(req StreamEnd) (*Message, error) {
+	s.mu.Lock()
+	st, ok := s.open[req.StreamID]
+	if ok {
+		s.dropLocked(req.StreamID, st)
+	}
+	s.mu.Unlock()
+
+	fail := func(reason string) (*Message, error) {
+		return nil, &StreamError{StreamID: req.StreamID, Reason: reason}
+	}
+	if !ok {
+		return fail("is not open")
+	}
+	if st.next != st.chunks {
+		return fail(fmt.Sprintf("ended after %d of %d chunks", st.next, st.chunks))
+	}
+	if st.buf.Len() != st.size {
+		return fail(fmt.Sprintf("ended after %d of %d bytes", st.buf.Len(), st.size))
+	}
+	sum := sha256.Sum256(st.buf.Bytes())
+	if want, err := hex.DecodeString(req.SHA256); err != nil || !bytes.Equal(want, sum[:]) {
+		return fail("failed its SHA-256 check")
+	}
+
+	var msg Message
+	if err := json.Unmarshal(st.buf.Bytes(), &msg); err != nil {
+		return fail(fmt.Sprintf("does not hold a valid message: %v", err))
+	}
+	if IsStreamAction(msg.Action) {
+		return fail("holds another stream frame")
+	}
+	return &msg, nil
+}
+
+// abandon discards a stream that timed out, unless it has since finished
+// and its ID been reused
+func (s *streamTable) abandon(id string, st *inStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[id] != st {
+		return
+	}
+	log.Printf("Abandoning stream %q after %v without a frame (%d of %d chunks received)",
+		id, s.timeout, st.next, st.chunks)
+	s.dropLocked(id, st)
+}
+
+// dropLocked discards a stream; s.mu must be held
+func (s *streamTable) dropLocked(id string, st *inStream) {
+	st.timer.Stop()
+	delete(s.open, id)
+}
+
+// Close discards every open stream
+func (s *streamTable) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, st := range s.open {
+		s.dropLocked(id, st)
+	}
+}
+
+// streamFrame is one frame of an outbound stream. Type is the stream
+// action and Stream its StreamBegin, StreamChunk or StreamEnd.
+type streamFrame struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Success bool        `json:"success"`
+	Stream  interface{} `json:"stream"`
+}
+
+// streamID numbers the streams this process sends
+var streamID atomic.Uint64
+
+// writeStream sends data, JSON too big for one frame, as a stream. frame
+// wraps each stream action and its payload in the frame to send.
+func writeStream(w io.Writer, data []byte, frame func(action string, payload interface{}) interface{}) error {
+	if len(data) > MaxStreamSize {
+		return fmt.Errorf("message too large: %d bytes (max %d)", len(data), MaxStreamSize)
+	}
+
+	id := "stream-" + strconv.FormatUint(streamID.Add(1), 10)
+	chunks := (len(data) + StreamChunkSize - 1) / StreamChunkSize
+
+	send := func(action string, payload interface{}) error {
+		body, err := json.Marshal(frame(action, payload))
+		if err != nil {
+			return fmt.Errorf("failed to marshal stream frame: %w", err)
+		}
+		return writeFrame(w, body)
+	}
+
+	err := send(ActionStreamBegin, StreamBegin{StreamID: id, Size: len(data), Chunks: chunks})
+	if err != nil {
+		return err
+	}
+	for seq := 0; seq < chunks; seq++ {
+		end := min((seq+1)*StreamChunkSize, len(data))
+		err := send(ActionStreamChunk, StreamChunk{
+			StreamID: id,
+			Seq:      seq,
+			Data:     base64.StdEncoding.EncodeToString(data[seq*StreamChunkSize : end]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	sum := sha256.Sum256(data)
+	return send(ActionStreamEnd, StreamEnd{StreamID: id, SHA256: hex.EncodeToString(sum[:])})
+}
+
+// writeResponseStream sends a response as a stream. Every frame carries
+// the response's ID.
+func writeResponseStream(w io.Writer, id string, data []byte) error {
+	return writeStream(w, data, func(action string, payload interface{}) interface{} {
+		return streamFrame{ID: id, Type: action, Success: true, Stream: payload}
+	})
+}
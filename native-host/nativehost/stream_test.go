@@ -0,0 +1,275 @@
+package nativehost
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame builds a stream frame message with the given payload
+func frame(t *testing.T, action string, payload interface{}) *Message {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Message{Action: action, Payload: data}
+}
+
+// streamFrames splits data into the frames an extension would send
+func streamFrames(t *testing.T, id string, data []byte, chunkSize int) []*Message {
+	t.Helper()
+	chunks := (len(data) + chunkSize - 1) / chunkSize
+	frames := []*Message{frame(t, ActionStreamBegin, StreamBegin{StreamID: id, Size: len(data), Chunks: chunks})}
+	for seq := 0; seq < chunks; seq++ {
+		end := min((seq+1)*chunkSize, len(data))
+		frames = append(frames, frame(t, ActionStreamChunk, StreamChunk{
+			StreamID: id,
+			Seq:      seq,
+			Data:     base64.StdEncoding.EncodeToString(data[seq*chunkSize : end]),
+		}))
+	}
+	sum := sha256.Sum256(data)
+	return append(frames, frame(t, ActionStreamEnd, StreamEnd{StreamID: id, SHA256: hex.EncodeToString(sum[:])}))
+}
+
+// feed passes frames to s, failing on any error, and returns the result
+// of the last
+func feed(t *testing.T, s *streamTable, frames []*Message) (*Message, error) {
+	t.Helper()
+	for _, f := range frames[:len(frames)-1] {
+		got, err := s.Handle(f)
+		if err != nil {
+			t.Fatalf("Handle(%s) error: %v", f.Action, err)
+		}
+		if got != nil {
+			t.Fatalf("Handle(%s) returned a message before streamEnd", f.Action)
+		}
+	}
+	return s.Handle(frames[len(frames)-1])
+}
+
+func TestStreams_Reassemble(t *testing.T) {
+	body := `{"id":"7","action":"open","payload":{"filePath":"/tmp/` + strings.Repeat("a", 5000) + `"}}`
+	s := newStreamTable(time.Minute)
+	defer s.Close()
+
+	got, err := feed(t, s, streamFrames(t, "s1", []byte(body), 1000))
+	if err != nil {
+		t.Fatalf("Handle(streamEnd) error: %v", err)
+	}
+	if got.ID != "7" || got.Action != "open" || !bytes.Contains(got.Payload, []byte("aaaa")) {
+		t.Errorf("Reassembled %+v", got)
+	}
+	if len(s.open) != 0 {
+		t.Errorf("%d streams still open", len(s.open))
+	}
+}
+
+func TestStreams_Errors(t *testing.T) {
+	body := []byte(`{"action":"open","payload":{"filePath":"/tmp/a.txt"}}`)
+
+	tests := []struct {
+		name   string
+		frames func(frames []*Message) []*Message
+		reason string
+	}{
+		{
+			name: "out of order",
+			frames: func(f []*Message) []*Message {
+				f[1], f[2] = f[2], f[1]
+				return f
+			},
+			reason: "got chunk 1, expected chunk 0",
+		},
+		{
+			name: "missing chunk",
+			frames: func(f []*Message) []*Message {
+				return append(f[:2], f[3:]...)
+			},
+			reason: "got chunk 2, expected chunk 1",
+		},
+		{
+			name: "ended early",
+			frames: func(f []*Message) []*Message {
+				return append(f[:2], f[len(f)-1])
+			},
+			reason: "ended after 1 of",
+		},
+		{
+			name: "checksum mismatch",
+			frames: func(f []*Message) []*Message {
+				sum := sha256.Sum256([]byte("something else"))
+				f[len(f)-1] = frame(t, ActionStreamEnd, StreamEnd{StreamID: "s1", SHA256: hex.EncodeToString(sum[:])})
+				return f
+			},
+			reason: "failed its SHA-256 check",
+		},
+		{
+			name: "bad base64",
+			frames: func(f []*Message) []*Message {
+				f[1] = frame(t, ActionStreamChunk, StreamChunk{StreamID: "s1", Seq: 0, Data: "not base64!"})
+				return f
+			},
+			reason: "chunk 0 is not valid base64",
+		},
+		{
+			name: "unknown stream",
+			frames: func(f []*Message) []*Message {
+				return f[1:]
+			},
+			reason: "is not open",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStreamTable(time.Minute)
+			defer s.Close()
+
+			var err error
+			for _, f := range tt.frames(streamFrames(t, "s1", body, 10)) {
+				if _, err = s.Handle(f); err != nil {
+					break
+				}
+			}
+
+			var streamErr *StreamError
+			if !errors.As(err, &streamErr) {
+				t.Fatalf("Expected a *StreamError, got %v", err)
+			}
+			if !strings.Contains(streamErr.Reason, tt.reason) {
+				t.Errorf("Reason = %q, want it to contain %q", streamErr.Reason, tt.reason)
+			}
+			if len(s.open) != 0 {
+				t.Errorf("The failed stream is still open")
+			}
+		})
+	}
+}
+
+func TestStreams_RejectsOversizeAndNested(t *testing.T) {
+	s := newStreamTable(time.Minute)
+	defer s.Close()
+
+	_, err := s.Handle(frame(t, ActionStreamBegin, StreamBegin{StreamID: "big", Size: MaxStreamSize + 1, Chunks: 200}))
+	if err == nil {
+		t.Error("Expected a stream over MaxStreamSize to be refused")
+	}
+
+	nested, _ := json.Marshal(frame(t, ActionStreamBegin, StreamBegin{StreamID: "inner", Size: 10, Chunks: 1}))
+	if _, err := feed(t, s, streamFrames(t, "outer", nested, 100)); err == nil {
+		t.Error("Expected a stream holding a stream frame to be refused")
+	}
+
+	_, err = s.Handle(frame(t, ActionStreamChunk, map[string]interface{}{"streamId": "s1", "seq": 0}))
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "data" {
+		t.Errorf("Expected a *FieldError for data, got %v", err)
+	}
+}
+
+func TestStreams_Timeout(t *testing.T) {
+	s := newStreamTable(20 * time.Millisecond)
+	defer s.Close()
+
+	frames := streamFrames(t, "s1", []byte(`{"action":"ping"}`), 4)
+	if _, err := s.Handle(frames[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.open)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The abandoned stream was never cleaned up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := s.Handle(frames[1]); err == nil {
+		t.Error("Expected chunks of an abandoned stream to be refused")
+	}
+}
+
+func TestWriteMessage_Streams(t *testing.T) {
+	resp := Response{ID: "9", Success: true, Message: strings.Repeat("x", MaxMessageSize+StreamChunkSize)}
+
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, resp); err != nil {
+		t.Fatalf("WriteMessage() error: %v", err)
+	}
+
+	// Read the frames back the way the extension would
+	var (
+		begin     StreamBegin
+		assembled []byte
+		end       StreamEnd
+		n         int
+	)
+	for {
+		var length uint32
+		if err := binary.Read(&buf, binary.LittleEndian, &length); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if length > MaxMessageSize {
+			t.Fatalf("Frame %d is %d bytes, over MaxMessageSize", n, length)
+		}
+		var f struct {
+			ID     string          `json:"id"`
+			Type   string          `json:"type"`
+			Stream json.RawMessage `json:"stream"`
+		}
+		if err := json.Unmarshal(buf.Next(int(length)), &f); err != nil {
+			t.Fatal(err)
+		}
+		if f.ID != "9" {
+			t.Errorf("Frame %d has id %q, want 9", n, f.ID)
+		}
+
+		switch f.Type {
+		case ActionStreamBegin:
+			json.Unmarshal(f.Stream, &begin)
+		case ActionStreamChunk:
+			var c StreamChunk
+			json.Unmarshal(f.Stream, &c)
+			if c.Seq != n-1 {
+				t.Errorf("Chunk %d has seq %d", n-1, c.Seq)
+			}
+			data, _ := base64.StdEncoding.DecodeString(c.Data)
+			assembled = append(assembled, data...)
+		case ActionStreamEnd:
+			json.Unmarshal(f.Stream, &end)
+		default:
+			t.Fatalf("Unexpected frame type %q", f.Type)
+		}
+		n++
+	}
+
+	if begin.Chunks != n-2 || begin.Size != len(assembled) {
+		t.Errorf("streamBegin = %+v, got %d chunks and %d bytes", begin, n-2, len(assembled))
+	}
+	sum := sha256.Sum256(assembled)
+	if end.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("streamEnd checksum doesn't match the data")
+	}
+	var got Response
+	if err := json.Unmarshal(assembled, &got); err != nil || got.Message != resp.Message {
+		t.Errorf("Reassembled response doesn't match (err %v)", err)
+	}
+}